@@ -1,93 +1,147 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"time"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/cart"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/config"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/handlers"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository/memory"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/session"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/storage"
 )
 
 /*** Global Variables ***/
 var db *sql.DB // Database instance
 
+/*** Constants ***/
+const uploadsURL = "/static/uploads/"      // URL the upload directory is served from (local storage)
+const demoAdminEmail = "admin@example.com" // First admin of the demo mode (unless ADMIN_EMAIL and ADMIN_PASSWORD are set)
+const demoAdminPassword = "demo"           // Password of the demo admin
+
+// Creates the first admin (owner) from the ADMIN_EMAIL and ADMIN_PASSWORD environment variables if there are no admins yet.
+// In demo mode the demo admin is created when they are not set, so the dashboard can be tried right away.
+func createFirstAdmin(repo *repository.Repository, demo bool) {
+	count, err := repo.Admin.GetTotalAdminsCount()
+	if err != nil { log.Fatal(err) }
+	if count > 0 { return }
+
+	email, password := os.Getenv("ADMIN_EMAIL"), os.Getenv("ADMIN_PASSWORD")
+	if demo && (email == "" || password == "") {
+		email, password = demoAdminEmail, demoAdminPassword
+		log.Printf("Demo mode: log in to the dashboard as %s with the password %q", email, password)
+	}
+	if email == "" || password == "" {
+		log.Println("There are no admins, set ADMIN_EMAIL and ADMIN_PASSWORD to create the first one (owner)")
+		return
+	}
+
+	admin := models.AdminUser{Email: email, FullName: "Owner", Role: models.RoleOwner}
+	if err = repo.Admin.CreateAdmin(&admin, password); err != nil { log.Fatal(err) }
+	log.Println("Created the first admin (owner):", admin.Email)
+}
+
+// Returns the storage of the uploaded images selected in the settings (local disk or an S3 compatible service). The
+// upload directory of the local storage is created if it does not exist.
+func newStorage(cfg *config.Config) storage.Storage {
+	if cfg.Storage == "local" {
+		if err := os.MkdirAll(cfg.UploadDir, 0755); err != nil { log.Fatal(err) }
+		return storage.NewLocal(cfg.UploadDir, uploadsURL)
+	}
+
+	store, err := storage.NewS3(storage.S3Options{
+		Endpoint:  cfg.S3Endpoint,
+		Region:    cfg.S3Region,
+		Bucket:    cfg.S3Bucket,
+		AccessKey: cfg.S3AccessKey,
+		SecretKey: cfg.S3SecretKey,
+		UseSSL:    cfg.S3UseSSL,
+		PublicURL: cfg.S3PublicURL,
+	})
+	if err != nil { log.Fatal(err) }
+	return store
+}
+
 // Initialize the database
-func initDB() {
+func initDB(dsn string) {
 	var err error
-	db, err = sql.Open("mysql", "root:toor@(127.0.0.1:3306)/ecommerce?parseTime=true")
+	db, err = sql.Open("mysql", dsn)
 	if err != nil { log.Fatal(err)}
 
 	if err = db.Ping(); err != nil { log.Fatal(err)}
 }
 
 func main() {
+	// Load the settings (defaults, config file, environment variables and flags)
+	cfg, args, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp { return }
+	if err != nil { log.Fatal(err) }
+
+	store := newStorage(cfg)
+	if err = handlers.LoadTemplates(cfg.TemplateDir, store); err != nil { log.Fatal(err) }
+
 	r := mux.NewRouter()
 
-	//Setup MySQL
-	initDB()
-	defer db.Close()
+	// Setup the repository: MySQL, or the in-memory stores in demo mode
+	var repo *repository.Repository
+	if cfg.Demo {
+		if len(args) > 0 && args[0] == "migrate" { log.Fatal("The migrate command needs a database, it can not run in demo mode") }
+		log.Println("Demo mode: the data is kept in memory and lost when the server stops")
+		repo = memory.NewRepository()
+	} else {
+		initDB(cfg.DSN)
+		defer db.Close()
+
+		// Run the migrate subcommand instead of the server (e.g. "go run . migrate up")
+		if len(args) > 0 && args[0] == "migrate" {
+			runMigrateCommand(args[1:])
+			return
+		}
+		if cfg.Migrate { migrateOnStartup() }
+		repo = repository.NewRepository(db)
+	}
+
+	var secrets [][]byte
+	for _, secret := range cfg.SessionSecrets {
+		secrets = append(secrets, []byte(secret))
+	}
+	if len(secrets) == 0 {
+		log.Println("No session secret set, generating a random one (sessions will not survive a restart)")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil { log.Fatal(err) }
+		secrets = append(secrets, secret)
+	}
 
-	// Setup Static folder for static files and images
+	// Setup Static folder for static files and the upload directory for the product images (local storage)
+	if cfg.Storage == "local" {
+		uploads := http.FileServer(http.Dir(cfg.UploadDir))
+		r.PathPrefix(uploadsURL).Handler(http.StripPrefix(uploadsURL, uploads))
+	}
 	fs := http.FileServer(http.Dir("./static"))
 	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", fs))
 
-	repo := repository.NewRepository(db)
-	handler := handlers.NewHandler(repo)
-
-	/*** User Routes ***/
-
-	// Endpoint to display the home page (user shop view)
-	r.HandleFunc("/", handler.ShoppingHomepage).Methods("GET")
-	// Endpoint to display the products in the home page
-	r.HandleFunc("/shoppingitems", handler.ShoppingItemsView).Methods("GET")
-	// Endpoint to display the cart view in the home page
-	r.HandleFunc("/cartitems", handler.CartView).Methods("GET")
-	// Endpoint to add a product to the cart
-	r.HandleFunc("/addtocart/{product_id}", handler.AddToCart).Methods("POST")
-	// Endpoint to display the checkout view
-	r.HandleFunc("/gotocart", handler.ShoppingCartView).Methods("GET")
-	// Endpoint to update the quantity of a product in the cart
-	r.HandleFunc("/updateorderitem", handler.UpdateOrderItemQuantity).Methods("PUT")
-	// Endpoint to display the order complete view
-	r.HandleFunc("/ordercomplete", handler.PlaceOrder).Methods("GET")
-
-	/*** Admin Routes ***/
-	
-	// Utility Routes
-	// Endpoint to seed (feed/create) 20 dummy products in the database (each time the endpoint is called)
-	r.HandleFunc("/seed-products", handler.SeedProducts).Methods("POST")
-
-	// Products Routes
-	// Endpoint to display the products page
-	r.HandleFunc("/manageproducts", handler.ProductsPage).Methods("GET")
-	// Endpoint to display the all products view (table with all products)
-	r.HandleFunc("/allproducts", handler.AllProductsView).Methods("GET")
-	// Endpoint to display the rows of the all products view (table with all products)
-	r.HandleFunc("/products", handler.ListProducts).Methods("GET")
-	// Endpoint to display the details of a product
-	r.HandleFunc("/products/{id}", handler.GetProduct).Methods("GET")
-	// Endpoint to create a new product in the database
-	r.HandleFunc("/products", handler.CreateProduct).Methods("POST")
-	// Endpoint to update a product in the database
-	r.HandleFunc("/products/{id}", handler.UpdateProduct).Methods("PUT")
-	// Endpoint to delete a product from the database
-	r.HandleFunc("/products/{id}", handler.DeleteProduct).Methods("DELETE")
-	// Endpoint to display the form to add a new product
-	r.HandleFunc("/createproduct", handler.CreateProductView).Methods("GET")
-	// Endpoint to display the form to edit a product
-	r.HandleFunc("/editproduct/{id}", handler.EditProductView).Methods("GET")
-
-	// Orders Routes
-	// Endpoint to display the orders page
-	r.HandleFunc("/manageorders", handler.OrdersPage).Methods("GET")
-	// Endpoint to load all the orders from the database in the table
-	r.HandleFunc("/allorders", handler.AllOrdersView).Methods("GET")
-	// Endpoint to load the rows of the orders table
-	r.HandleFunc("/orders", handler.ListOrders).Methods("GET")
-	// Endpoint to display the details of an order
-	r.HandleFunc("/orders/{id}", handler.GetOrder).Methods("GET")
-
-	http.ListenAndServe(":8080", r)
+	createFirstAdmin(repo, cfg.Demo)
+	carts := cart.NewStore(repo.Cart, cfg.CartIdleTimeout)
+	handler := handlers.NewHandler(repo, carts, session.NewManager(secrets...), store, cfg)
+
+	// Delete the expired carts in the background
+	go carts.ExpireIdleCarts(time.Hour)
+
+	// Register the routes of the web pages, the admin dashboard and the JSON API
+	handler.RegisterRoutes(r)
+
+	// Describe the routes for the OpenAPI document (fails if the JSON API routes and their descriptions differ)
+	if err = handlers.LoadOpenAPI(r); err != nil { log.Fatal(err) }
+
+	log.Println("Listening on", cfg.ListenAddr)
+	log.Fatal(http.ListenAndServe(cfg.ListenAddr, r))
 }
\ No newline at end of file
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/migrations"
+)
+
+// Usage of the migrate subcommand.
+const migrateUsage = `Usage: go-htmx-ecommerce [flags] migrate <command>
+
+Commands:
+  status        list every migration and whether it has been applied
+  up            apply every pending migration
+  down          revert the latest applied migration
+  to <version>  apply or revert migrations until the schema is at the version (0 reverts everything)`
+
+// Runs the migrate subcommand (status, up, down or to <version>) and exits.
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil { log.Fatal(err) }
+
+	switch args[0] {
+		case "status":
+			statuses, err := migrator.Status()
+			if err != nil { log.Fatal(err) }
+			for _, status := range statuses {
+				applied := "pending"
+				if status.Applied { applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05") }
+				fmt.Printf("%04d  %-40s %s\n", status.Version, status.Name, applied)
+			}
+		case "up":
+			count, err := migrator.Up()
+			if err != nil { log.Fatal(err) }
+			fmt.Printf("Applied %d migrations\n", count)
+		case "down":
+			count, err := migrator.Down()
+			if err != nil { log.Fatal(err) }
+			fmt.Printf("Reverted %d migrations\n", count)
+		case "to":
+			if len(args) < 2 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				os.Exit(2)
+			}
+			version, err := strconv.Atoi(args[1])
+			if err != nil { log.Fatalf("Invalid version %q", args[1]) }
+			count, err := migrator.To(version)
+			if err != nil { log.Fatal(err) }
+			fmt.Printf("Migrated %d migrations, schema is at version %d\n", count, version)
+		default:
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			os.Exit(2)
+	}
+}
+
+// Applies the pending migrations when the server starts.
+func migrateOnStartup() {
+	migrator, err := migrations.NewMigrator(db)
+	if err != nil { log.Fatal(err) }
+
+	count, err := migrator.Up()
+	if err != nil { log.Fatal(err) }
+	if count > 0 { log.Printf("Applied %d migrations", count) }
+}
@@ -0,0 +1,293 @@
+package cart
+
+import (
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Errors ***/
+var ErrItemNotFound = errors.New("product not found in cart") // Returned when the product is not in the visitor's cart
+var ErrInvalidAction = errors.New("invalid action")           // Returned when the quantity action is not add, subtract or remove
+var ErrOutOfStock = errors.New("not enough stock")            // Returned when adding more units than there are in stock
+var ErrVariantRequired = errors.New("choose a variant")       // Returned when adding a product sold in variants without a (valid) variant
+var ErrCartChanged = errors.New("the cart changed")            // Returned when checking out with the idempotency key of another (or no) cart
+var ErrEmptyCart = errors.New("the cart is empty")             // Returned when checking out a cart without items
+
+/*** Constants ***/
+const lockStripes = 64 // Number of locks shared by the sessions (a session always uses the same lock)
+
+/*** Structs ***/
+
+// Custom type that identifies a line of a cart: a product and its variant (uuid.Nil for products without variants).
+type Line struct {
+	ProductID uuid.UUID
+	VariantID uuid.UUID
+}
+
+// Method that returns the line as "<product ID>/<variant ID>" (e.g. for the names of form fields).
+func (l Line) String() string {
+	return l.ProductID.String() + "/" + l.VariantID.String()
+}
+
+// Custom type that contains the prices of a unit the shopper confirmed at checkout after they changed, by line. The
+// items are ordered at these prices instead of the ones in the cart, so an order is only placed at prices the shopper saw.
+type ConfirmedPrices map[Line]models.Money
+
+// Method that sets the confirmed price of the items that have one.
+func (p ConfirmedPrices) Apply(items []models.OrderItem) {
+	for i := range items {
+		if price, ok := p[Line{ProductID: items[i].ProductID, VariantID: items[i].VariantID}]; ok { items[i].Product.Price = price }
+	}
+}
+
+// Method that adds the new prices of the changed lines of a refused checkout, which the shopper is asked to confirm.
+func (p ConfirmedPrices) Add(changes []repository.PriceChange) {
+	for _, change := range changes {
+		p[Line{ProductID: change.ProductID, VariantID: change.VariantID}] = change.NewPrice
+	}
+}
+
+// Custom type that manages the carts of every visitor keyed by their session ID. Every change is written through to the
+// database, so carts survive server restarts. It is safe for concurrent use.
+type Store struct {
+	locks [lockStripes]sync.Mutex
+	Repo  repository.CartStore
+	Idle  time.Duration // Time after which a cart that has not been modified is deleted
+}
+
+// Function that returns a new Store that persists the carts with the CartStore and expires them after the idle period.
+func NewStore(repo repository.CartStore, idle time.Duration) *Store {
+	return &Store{Repo: repo, Idle: idle}
+}
+
+// Method that locks the cart of a session and returns the function that unlocks it.
+func (s *Store) lock(sessionID string) func() {
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	mu := &s.locks[h.Sum32()%lockStripes]
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Method that loads the cart of a session from the database. A session without a stored cart gets an empty (unsaved) cart.
+func (s *Store) load(sessionID string) (*models.Cart, error) {
+	c, err := s.Repo.GetCartBySession(sessionID)
+	if err == sql.ErrNoRows { return &models.Cart{SessionID: sessionID}, nil }
+	return c, err
+}
+
+// Method that returns the items in the cart of a session.
+func (s *Store) Items(sessionID string) ([]models.OrderItem, error) {
+	unlock := s.lock(sessionID)
+	defer unlock()
+
+	c, err := s.load(sessionID)
+	if err != nil { return nil, err }
+	return c.Items, nil
+}
+
+// Method that adds a product (quantity 1) to the cart of a session. Products sold in variants need the ID of the chosen
+// variant (uuid.Nil for the other products). The user ID of the logged in customer (empty for guests) is stored with a new
+// cart, and a session of a customer without a cart takes the customer's cart (e.g. after they logged in on another
+// browser, which moved it there). It returns false if the product (variant) was already in the cart, ErrVariantRequired
+// if the variant is missing and ErrOutOfStock if the product (variant) is sold out.
+func (s *Store) AddItem(sessionID, userID string, product models.Product, variantID uuid.UUID) ([]models.OrderItem, bool, error) {
+	unlock := s.lock(sessionID)
+	defer unlock()
+
+	c, err := s.load(sessionID)
+	if err != nil { return nil, false, err }
+
+	// A customer has a single cart, so it is moved to the session instead of creating another one
+	if c.CartID == uuid.Nil && userID != "" {
+		userCart, err := s.Repo.GetCartByUser(userID)
+		if err != nil && err != sql.ErrNoRows { return nil, false, err }
+		if err == nil {
+			if err = s.Repo.AssignCart(userCart.CartID, sessionID, userID); err != nil { return nil, false, err }
+			userCart.SessionID = sessionID
+			c = userCart
+		}
+	}
+
+	// The item gets the price and stock of the variant
+	var variant *models.ProductVariant
+	if product.HasVariants() {
+		var ok bool
+		product, variant, ok = product.WithVariant(variantID)
+		if !ok { return c.Items, false, ErrVariantRequired }
+	} else {
+		variantID = uuid.Nil
+	}
+
+	for _, item := range c.Items {
+		if item.ProductID == product.ProductID && item.VariantID == variantID { return c.Items, false, nil }
+	}
+	if product.Stock < 1 { return c.Items, false, ErrOutOfStock }
+
+	// Store a new cart row for the session if one does not exist
+	if c.CartID == uuid.Nil {
+		c.UserID = userID
+		if err = s.Repo.CreateCart(c); err != nil { return nil, false, err }
+	}
+
+	// The item keeps the price the shopper sees now, so a checkout can tell them if it changes
+	if err = s.Repo.AddCartItem(c.CartID, product.ProductID, variantID, 1, product.Price); err != nil { return nil, false, err }
+
+	c.Items = append(c.Items, models.OrderItem{
+		OrderID:   c.CartID,
+		ProductID: product.ProductID,
+		VariantID: variantID,
+		Quantity:  1, // Initial quantity of 1
+		Product:   product,
+		Variant:   variant,
+	})
+	return c.Items, true, nil
+}
+
+// Method that updates the quantity of a product (variant) in the cart of a session based on an action (add, subtract or
+// remove). It returns the updated items and whether the product was removed from the cart, or ErrOutOfStock if adding a
+// unit would exceed the stock of the product.
+func (s *Store) UpdateQuantity(sessionID string, productID, variantID uuid.UUID, action string) ([]models.OrderItem, bool, error) {
+	unlock := s.lock(sessionID)
+	defer unlock()
+
+	c, err := s.load(sessionID)
+	if err != nil { return nil, false, err }
+
+	itemIndex := -1
+	for i, item := range c.Items {
+		if item.ProductID == productID && item.VariantID == variantID {
+			itemIndex = i
+			break
+		}
+	}
+	if itemIndex == -1 { return c.Items, false, ErrItemNotFound }
+
+	removed := false
+	switch action {
+		case "add":
+			if c.Items[itemIndex].Quantity >= c.Items[itemIndex].Product.Stock { return c.Items, false, ErrOutOfStock }
+			c.Items[itemIndex].Quantity++
+		case "subtract":
+			c.Items[itemIndex].Quantity--
+			// Remove item if quantity is 0
+			removed = c.Items[itemIndex].Quantity == 0
+		case "remove":
+			// Remove item regardless of quantity
+			removed = true
+		default:
+			return c.Items, false, ErrInvalidAction
+	}
+
+	if removed {
+		err = s.Repo.RemoveCartItem(c.CartID, productID, variantID)
+		c.Items = append(c.Items[:itemIndex], c.Items[itemIndex+1:]...)
+	} else {
+		err = s.Repo.UpdateCartItemQuantity(c.CartID, productID, variantID, c.Items[itemIndex].Quantity)
+	}
+	if err != nil { return nil, false, err }
+
+	return c.Items, removed, nil
+}
+
+// Method that merges the cart of a guest session into the cart of the customer that logs in with it, so the customer keeps
+// both the items saved in their account and the items added before logging in. The merged cart becomes the cart of the
+// new session the customer gets when logging in (so a session ID planted before the login never holds their cart).
+func (s *Store) MergeCarts(guestSessionID, sessionID, userID string) error {
+	unlock := s.lock(guestSessionID)
+	defer unlock()
+
+	guestCart, err := s.load(guestSessionID)
+	if err != nil { return err }
+
+	userCart, err := s.Repo.GetCartByUser(userID)
+	if err == sql.ErrNoRows {
+		// The customer has no saved cart, the guest cart (if any) becomes their cart
+		if guestCart.CartID == uuid.Nil { return nil }
+		return s.Repo.AssignCart(guestCart.CartID, sessionID, userID)
+	}
+	if err != nil { return err }
+
+	if guestCart.CartID != uuid.Nil && guestCart.CartID != userCart.CartID {
+		for _, guestItem := range guestCart.Items {
+			merged := false
+			for _, userItem := range userCart.Items {
+				if userItem.ProductID != guestItem.ProductID || userItem.VariantID != guestItem.VariantID { continue }
+				err = s.Repo.UpdateCartItemQuantity(userCart.CartID, userItem.ProductID, userItem.VariantID, userItem.Quantity+guestItem.Quantity)
+				if err != nil { return err }
+				merged = true
+				break
+			}
+			if !merged {
+				err = s.Repo.AddCartItem(userCart.CartID, guestItem.ProductID, guestItem.VariantID, guestItem.Quantity, guestItem.Product.Price)
+				if err != nil { return err }
+			}
+		}
+		if err = s.Repo.DeleteCart(guestCart.CartID); err != nil { return err }
+	}
+
+	return s.Repo.AssignCart(userCart.CartID, sessionID, userID)
+}
+
+// Method that places the order of a session with the given function and deletes the cart if it succeeds. The idempotency
+// key must be the key of the cart (see CheckoutKey), otherwise it returns ErrCartChanged (e.g. the cart was already checked
+// out or replaced by the customer's cart when logging in), and the cart must have items (ErrEmptyCart). The items are
+// ordered at the prices in the cart, or the ones the shopper confirmed: if the order is refused with a
+// *repository.PriceChangedError, the error is returned and the cart is not changed, so the order is only placed once the
+// shopper confirms the new prices. If placeOrder returns repository.ErrOrderAlreadyPlaced the cart is deleted before the
+// error is returned. The cart stays locked while the order is placed, so concurrent checkouts of the same cart cannot
+// place it twice.
+func (s *Store) Checkout(sessionID, idempotencyKey string, confirmed ConfirmedPrices, placeOrder func(items []models.OrderItem) error) ([]models.OrderItem, error) {
+	unlock := s.lock(sessionID)
+	defer unlock()
+
+	c, err := s.load(sessionID)
+	if err != nil { return nil, err }
+	if c.CartID == uuid.Nil || c.CartID.String() != idempotencyKey { return nil, ErrCartChanged }
+	if len(c.Items) == 0 { return nil, ErrEmptyCart }
+
+	confirmed.Apply(c.Items)
+	for i := range c.Items {
+		c.Items[i].Cost = c.Items[i].Product.Price.Times(c.Items[i].Quantity)
+	}
+
+	// An order already placed with the key (e.g. the cart could not be deleted after it, or another instance placed it)
+	// is a placed order too: the cart is emptied and the error returned, so the caller shows that order
+	err = placeOrder(c.Items)
+	if err != nil && err != repository.ErrOrderAlreadyPlaced { return nil, err }
+
+	//Empty the cart
+	if deleteErr := s.Repo.DeleteCart(c.CartID); deleteErr != nil { return nil, deleteErr }
+	if err != nil { return nil, err }
+	return c.Items, nil
+}
+
+// Function that returns the idempotency key of the checkout of a cart from its items: the ID of the cart, which is only
+// checked out once (empty for an empty cart).
+func CheckoutKey(items []models.OrderItem) string {
+	if len(items) == 0 { return "" }
+	return items[0].OrderID.String()
+}
+
+// Method that deletes the carts that have been idle for longer than the idle period every interval. It blocks, so it
+// should be run in its own goroutine.
+func (s *Store) ExpireIdleCarts(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		deleted, err := s.Repo.DeleteExpiredCarts(s.Idle)
+		if err != nil {
+			log.Println("Error deleting expired carts:", err)
+			continue
+		}
+		if deleted > 0 { log.Printf("Deleted %d expired carts", deleted) }
+	}
+}
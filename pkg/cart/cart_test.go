@@ -0,0 +1,70 @@
+package cart
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository/memory"
+)
+
+/*** Helper Functions ***/
+
+// Returns a cart store on the in-memory repository, and the repository.
+func newTestStore() (*Store, *repository.Repository) {
+	repo := memory.NewRepository()
+	return NewStore(repo.Cart, time.Hour), repo
+}
+
+// Creates a product (in stock) in the repository.
+func createTestProduct(t *testing.T, repo *repository.Repository, name string) models.Product {
+	t.Helper()
+	product := models.Product{ProductName: name, Price: 1000, Stock: 5, Weight: 1000, Length: 20, Width: 10, Height: 5}
+	if err := repo.Product.CreateProduct(&product); err != nil { t.Fatal(err) }
+	return product
+}
+
+/*** Tests ***/
+
+// Tests that a customer logged in on two browsers can keep adding products on the first one after logging in on the
+// second one moved their cart there: the first session takes the customer's cart back instead of creating another one.
+func TestAddItemCustomerOnTwoSessions(t *testing.T) {
+	store, repo := newTestStore()
+	laptop, mouse := createTestProduct(t, repo, "Laptop"), createTestProduct(t, repo, "Mouse")
+
+	if _, _, err := store.AddItem("A", "u1", laptop, uuid.Nil); err != nil { t.Fatalf("adding on session A: %v", err) }
+	if err := store.MergeCarts("B0", "B", "u1"); err != nil { t.Fatalf("logging in on session B: %v", err) }
+	items, added, err := store.AddItem("A", "u1", mouse, uuid.Nil)
+	if err != nil || !added { t.Fatalf("adding on session A again: added %t, error %v", added, err) }
+	if len(items) != 2 { t.Errorf("%d items in the cart of session A, want the laptop and the mouse", len(items)) }
+
+	c, err := repo.Cart.GetCartByUser("u1")
+	if err != nil { t.Fatal(err) }
+	if c.SessionID != "A" || len(c.Items) != 2 { t.Errorf("the customer's cart has session %q and %d items, want A and 2", c.SessionID, len(c.Items)) }
+	if items, _ := store.Items("B"); len(items) != 0 { t.Errorf("session B still has %d items, want the cart moved to A", len(items)) }
+
+	// Guests still get a cart of their own
+	if _, _, err := store.AddItem("C", "", laptop, uuid.Nil); err != nil { t.Errorf("adding as a guest: %v", err) }
+}
+
+// Tests that a checkout whose order was already placed with its key (e.g. deleting the cart failed after the order was
+// committed) empties the cart and returns repository.ErrOrderAlreadyPlaced, so later checkouts do not find the cart again.
+func TestCheckoutOrderAlreadyPlaced(t *testing.T) {
+	store, repo := newTestStore()
+	items, _, err := store.AddItem("A", "", createTestProduct(t, repo, "Laptop"), uuid.Nil)
+	if err != nil { t.Fatal(err) }
+	key := CheckoutKey(items)
+
+	_, err = store.Checkout("A", key, ConfirmedPrices{}, func(items []models.OrderItem) error { return repository.ErrOrderAlreadyPlaced })
+	if err != repository.ErrOrderAlreadyPlaced { t.Fatalf("checkout: error %v, want ErrOrderAlreadyPlaced", err) }
+	if items, _ := store.Items("A"); len(items) != 0 { t.Errorf("the cart has %d items, want it deleted", len(items)) }
+
+	// Any other error keeps the cart
+	items, _, err = store.AddItem("B", "", createTestProduct(t, repo, "Mouse"), uuid.Nil)
+	if err != nil { t.Fatal(err) }
+	_, err = store.Checkout("B", CheckoutKey(items), ConfirmedPrices{}, func(items []models.OrderItem) error { return repository.ErrEmptyOrder })
+	if err != repository.ErrEmptyOrder { t.Fatalf("checkout: error %v, want ErrEmptyOrder", err) }
+	if items, _ := store.Items("B"); len(items) != 1 { t.Errorf("the cart has %d items after a failed checkout, want 1", len(items)) }
+}
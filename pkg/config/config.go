@@ -0,0 +1,319 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/shipping"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/tax"
+)
+
+/*** Constants ***/
+const envPrefix = "ECOMMERCE_"    // Prefix of the environment variables (e.g. ECOMMERCE_DSN)
+const minSessionSecretLength = 32 // Minimum length (bytes) of a session secret
+
+// Custom type that contains the settings of the server. They are loaded (lowest precedence first) from the defaults,
+// a JSON config file, environment variables and command-line flags.
+type Config struct {
+	DSN             string            // MySQL data source name
+	ListenAddr      string            // Address the HTTP server listens on
+	Storage         string            // Where the uploaded product images are kept: "local" (UploadDir) or "s3"
+	UploadDir       string            // Directory where the uploaded product images are saved (local storage)
+	S3Endpoint      string            // Host (and port) of the S3 compatible service (s3 storage)
+	S3Region        string            // Region of the bucket (s3 storage)
+	S3Bucket        string            // Bucket where the uploaded product images are saved (s3 storage)
+	S3AccessKey     string            // Access key of the S3 compatible service (s3 storage)
+	S3SecretKey     string            // Secret key of the S3 compatible service (s3 storage)
+	S3UseSSL        bool              // Connect to the S3 compatible service with HTTPS (s3 storage)
+	S3PublicURL     string            // URL the objects of the bucket are served from, the endpoint if empty (s3 storage)
+	TemplateDir     string            // Directory with the html templates
+	MaxUploadSize   int64             // Maximum size (bytes) of a multipart upload
+	SessionSecrets  []string          // Secrets that sign the session cookies, the first one signs new cookies
+	CartIdleTimeout time.Duration     // Time after which a cart that has not been modified is deleted
+	Migrate         bool              // Apply the pending database migrations at startup
+	Demo            bool              // Keep the data in memory instead of MySQL (lost when the server stops)
+	ShippingMethods []shipping.Method // Shipping methods offered at checkout (only set in the config file)
+	TaxMode         string            // Whether the prices include the tax: "exclusive" (added at checkout) or "inclusive"
+	TaxRules        []tax.Rule        // Tax rates by region and tax class (only set in the config file, no tax if empty)
+}
+
+// Function that returns the default settings (a local development setup).
+func Default() *Config {
+	return &Config{
+		DSN:             "root:toor@(127.0.0.1:3306)/ecommerce?parseTime=true",
+		ListenAddr:      ":8080",
+		Storage:         "local",
+		UploadDir:       "static/uploads",
+		S3UseSSL:        true,
+		TemplateDir:     "templates",
+		MaxUploadSize:   10 << 20, // 10 MB
+		CartIdleTimeout: 7 * 24 * time.Hour,
+		ShippingMethods: shipping.DefaultMethods(),
+		TaxMode:         tax.ModeExclusive,
+	}
+}
+
+// Custom type that describes a setting that can be set (as text) from an environment variable or a flag, so both sources
+// are parsed the same way.
+type setting struct {
+	name  string // Name of the flag (the environment variable is the name in upper case with the prefix)
+	usage string
+	set   func(c *Config, value string) error
+}
+
+// Custom type (flag.Value) that keeps the text of a flag so it can be parsed by its setting.
+type textFlag struct {
+	value  string
+	isBool bool // Boolean flags can be set without a value (e.g. -migrate)
+}
+
+func (f *textFlag) String() string     { return f.value }
+func (f *textFlag) Set(v string) error { f.value = v; return nil }
+func (f *textFlag) IsBoolFlag() bool   { return f.isBool }
+
+// Settings that can be set from environment variables and flags.
+var settings = []setting{
+	{"dsn", "MySQL data source name", func(c *Config, v string) error { c.DSN = v; return nil }},
+	{"listen-addr", "address the HTTP server listens on", func(c *Config, v string) error { c.ListenAddr = v; return nil }},
+	{"storage", `where the uploaded product images are kept ("local" or "s3")`, func(c *Config, v string) error { c.Storage = v; return nil }},
+	{"upload-dir", "directory where the uploaded product images are saved (local storage)", func(c *Config, v string) error { c.UploadDir = v; return nil }},
+	{"s3-endpoint", "host (and port) of the S3 compatible service", func(c *Config, v string) error { c.S3Endpoint = v; return nil }},
+	{"s3-region", "region of the S3 bucket", func(c *Config, v string) error { c.S3Region = v; return nil }},
+	{"s3-bucket", "bucket where the uploaded product images are saved", func(c *Config, v string) error { c.S3Bucket = v; return nil }},
+	{"s3-access-key", "access key of the S3 compatible service", func(c *Config, v string) error { c.S3AccessKey = v; return nil }},
+	{"s3-secret-key", "secret key of the S3 compatible service", func(c *Config, v string) error { c.S3SecretKey = v; return nil }},
+	{"s3-use-ssl", "connect to the S3 compatible service with HTTPS", func(c *Config, v string) (err error) {
+		c.S3UseSSL, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"s3-public-url", "URL the objects of the bucket are served from (the endpoint if empty)", func(c *Config, v string) error { c.S3PublicURL = v; return nil }},
+	{"template-dir", "directory with the html templates", func(c *Config, v string) error { c.TemplateDir = v; return nil }},
+	{"max-upload-size", "maximum size of an upload (e.g. 10MB)", func(c *Config, v string) (err error) {
+		c.MaxUploadSize, err = ParseSize(v)
+		return err
+	}},
+	{"session-secrets", "comma separated secrets that sign the session cookies (the first one signs new cookies)", func(c *Config, v string) error {
+		c.SessionSecrets = nil
+		for _, secret := range strings.Split(v, ",") {
+			if secret = strings.TrimSpace(secret); secret != "" { c.SessionSecrets = append(c.SessionSecrets, secret) }
+		}
+		return nil
+	}},
+	{"cart-idle-timeout", "delete carts that have not been modified for this long", func(c *Config, v string) (err error) {
+		c.CartIdleTimeout, err = time.ParseDuration(v)
+		return err
+	}},
+	{"migrate", "apply the pending database migrations at startup", func(c *Config, v string) (err error) {
+		c.Migrate, err = strconv.ParseBool(v)
+		return err
+	}},
+	{"tax-mode", `whether the prices include the tax ("exclusive" or "inclusive")`, func(c *Config, v string) error { c.TaxMode = v; return nil }},
+	{"demo", "keep the data in memory instead of MySQL (demo mode, the data is lost when the server stops)", func(c *Config, v string) (err error) {
+		c.Demo, err = strconv.ParseBool(v)
+		return err
+	}},
+}
+
+// Function that loads the settings from the defaults, the config file (-config flag or ECOMMERCE_CONFIG), the environment
+// variables and the command-line flags (in increasing order of precedence) and validates them. It returns the arguments
+// left after the flags (e.g. a subcommand).
+func Load(args []string) (*Config, []string, error) {
+	fs := flag.NewFlagSet("go-htmx-ecommerce", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "path of a JSON config file")
+	flagValues := map[string]*textFlag{}
+	for _, s := range settings {
+		flagValues[s.name] = &textFlag{isBool: s.name == "migrate" || s.name == "demo" || s.name == "s3-use-ssl"}
+		fs.Var(flagValues[s.name], s.name, s.usage+" (env "+envName(s.name)+")")
+	}
+	if err := fs.Parse(args); err != nil { return nil, nil, err }
+
+	cfg := Default()
+
+	// Config file
+	if *configPath != "" {
+		if err := cfg.loadFile(*configPath); err != nil { return nil, nil, err }
+	}
+
+	// Environment variables
+	for _, s := range settings {
+		value, ok := os.LookupEnv(envName(s.name))
+		if !ok { continue }
+		if err := s.set(cfg, value); err != nil { return nil, nil, fmt.Errorf("config: %s: %v", envName(s.name), err) }
+	}
+
+	// Flags (only the ones set explicitly, so they do not reset the other sources to empty values)
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.name != f.Name || flagErr != nil { continue }
+			if err := s.set(cfg, flagValues[s.name].value); err != nil { flagErr = fmt.Errorf("config: -%s: %v", s.name, err) }
+		}
+	})
+	if flagErr != nil { return nil, nil, flagErr }
+
+	cfg.DSN = parseTimeDSN(cfg.DSN)
+	if err := cfg.Validate(); err != nil { return nil, nil, err }
+	return cfg, fs.Args(), nil
+}
+
+// Method that reads the settings of a JSON config file. Durations and sizes are written as text (e.g. "72h", "10MB").
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil { return fmt.Errorf("config: %v", err) }
+	defer f.Close()
+
+	var file struct {
+		DSN             *string           `json:"dsn"`
+		ListenAddr      *string           `json:"listen_addr"`
+		Storage         *string           `json:"storage"`
+		UploadDir       *string           `json:"upload_dir"`
+		S3Endpoint      *string           `json:"s3_endpoint"`
+		S3Region        *string           `json:"s3_region"`
+		S3Bucket        *string           `json:"s3_bucket"`
+		S3AccessKey     *string           `json:"s3_access_key"`
+		S3SecretKey     *string           `json:"s3_secret_key"`
+		S3UseSSL        *bool             `json:"s3_use_ssl"`
+		S3PublicURL     *string           `json:"s3_public_url"`
+		TemplateDir     *string           `json:"template_dir"`
+		MaxUploadSize   *string           `json:"max_upload_size"`
+		SessionSecrets  []string          `json:"session_secrets"`
+		CartIdleTimeout *string           `json:"cart_idle_timeout"`
+		Migrate         *bool             `json:"migrate"`
+		Demo            *bool             `json:"demo"`
+		ShippingMethods []shipping.Method `json:"shipping_methods"`
+		TaxMode         *string           `json:"tax_mode"`
+		TaxRules        []tax.Rule        `json:"tax_rules"`
+	}
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&file); err != nil && err != io.EOF { return fmt.Errorf("config: %s: %v", path, err) }
+
+	if file.DSN != nil { c.DSN = *file.DSN }
+	if file.ListenAddr != nil { c.ListenAddr = *file.ListenAddr }
+	if file.Storage != nil { c.Storage = *file.Storage }
+	if file.UploadDir != nil { c.UploadDir = *file.UploadDir }
+	if file.S3Endpoint != nil { c.S3Endpoint = *file.S3Endpoint }
+	if file.S3Region != nil { c.S3Region = *file.S3Region }
+	if file.S3Bucket != nil { c.S3Bucket = *file.S3Bucket }
+	if file.S3AccessKey != nil { c.S3AccessKey = *file.S3AccessKey }
+	if file.S3SecretKey != nil { c.S3SecretKey = *file.S3SecretKey }
+	if file.S3UseSSL != nil { c.S3UseSSL = *file.S3UseSSL }
+	if file.S3PublicURL != nil { c.S3PublicURL = *file.S3PublicURL }
+	if file.TemplateDir != nil { c.TemplateDir = *file.TemplateDir }
+	if file.SessionSecrets != nil { c.SessionSecrets = file.SessionSecrets }
+	if file.Migrate != nil { c.Migrate = *file.Migrate }
+	if file.Demo != nil { c.Demo = *file.Demo }
+	if file.ShippingMethods != nil { c.ShippingMethods = file.ShippingMethods }
+	if file.TaxMode != nil { c.TaxMode = *file.TaxMode }
+	if file.TaxRules != nil { c.TaxRules = file.TaxRules }
+	if file.MaxUploadSize != nil {
+		if c.MaxUploadSize, err = ParseSize(*file.MaxUploadSize); err != nil { return fmt.Errorf("config: %s: max_upload_size: %v", path, err) }
+	}
+	if file.CartIdleTimeout != nil {
+		if c.CartIdleTimeout, err = time.ParseDuration(*file.CartIdleTimeout); err != nil { return fmt.Errorf("config: %s: cart_idle_timeout: %v", path, err) }
+	}
+	return nil
+}
+
+// Method that checks every setting and returns an error listing all the invalid ones. It does not change the settings nor
+// create anything (the upload directory of the local storage is created at startup).
+func (c *Config) Validate() error {
+	var problems []string
+
+	if _, err := mysql.ParseDSN(c.DSN); err != nil {
+		problems = append(problems, "dsn: "+err.Error())
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		problems = append(problems, "listen address: "+err.Error())
+	}
+
+	if info, err := os.Stat(c.TemplateDir); err != nil || !info.IsDir() {
+		problems = append(problems, "template directory: "+c.TemplateDir+" is not a directory")
+	}
+
+	switch c.Storage {
+		case "local":
+			if c.UploadDir == "" { problems = append(problems, "upload directory: can not be empty") }
+		case "s3":
+			for _, required := range []struct{ name, value string }{
+				{"s3 endpoint", c.S3Endpoint}, {"s3 bucket", c.S3Bucket}, {"s3 access key", c.S3AccessKey}, {"s3 secret key", c.S3SecretKey},
+			} {
+				if required.value == "" { problems = append(problems, required.name+": required by the s3 storage") }
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("storage: must be local or s3, not %q", c.Storage))
+	}
+
+	if c.MaxUploadSize <= 0 {
+		problems = append(problems, "max upload size: must be greater than 0")
+	}
+
+	for i, secret := range c.SessionSecrets {
+		if len(secret) < minSessionSecretLength {
+			problems = append(problems, fmt.Sprintf("session secret %d: must have at least %d characters", i+1, minSessionSecretLength))
+		}
+	}
+
+	if c.CartIdleTimeout <= 0 {
+		problems = append(problems, "cart idle timeout: must be greater than 0")
+	}
+
+	if c.Demo && c.Migrate {
+		problems = append(problems, "migrate: there is no database to migrate in demo mode")
+	}
+
+	problems = append(problems, shipping.Validate(c.ShippingMethods)...)
+	problems = append(problems, tax.Validate(c.TaxMode, c.TaxRules)...)
+
+	if len(problems) > 0 { return errors.New("config: invalid settings:\n  - " + strings.Join(problems, "\n  - ")) }
+	return nil
+}
+
+// Method that returns whether the prices of the products include their tax.
+func (c *Config) PricesIncludeTax() bool {
+	return c.TaxMode == tax.ModeInclusive
+}
+
+// Function that parses a size in bytes with an optional unit (B, KB, MB or GB, powers of 1024), e.g. "10MB" or "1048576".
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}} {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.bytes
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil { return 0, fmt.Errorf("invalid size %q", s) }
+	return n * multiplier, nil
+}
+
+// Returns the DSN with parseTime set (the repositories scan DATETIME columns into time.Time), or the DSN as it is if it
+// does not parse (Validate reports it).
+func parseTimeDSN(dsn string) string {
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil { return dsn }
+	config.ParseTime = true
+	return config.FormatDSN()
+}
+
+// Returns the environment variable of a setting (e.g. "max-upload-size" is ECOMMERCE_MAX_UPLOAD_SIZE).
+func envName(name string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+/*** Constants ***/
+const testTemplateDir = "../../templates" // Template directory of the repository (Validate requires an existing one)
+
+/*** Helper Functions ***/
+
+// Returns the default settings with the template directory of the repository, which are valid.
+func testConfig() *Config {
+	cfg := Default()
+	cfg.TemplateDir = testTemplateDir
+	return cfg
+}
+
+// Writes a config file in a temporary directory and returns its path.
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil { t.Fatal(err) }
+	return path
+}
+
+/*** Tests ***/
+
+// Tests that every source overrides the ones with a lower precedence (defaults < file < environment variables < flags),
+// and that a source that does not set a setting keeps the value of the lower ones.
+func TestLoadPrecedence(t *testing.T) {
+	// The variables are restored when the test ends
+	t.Setenv(envPrefix+"CONFIG", "")
+	t.Setenv(envName("listen-addr"), "")
+	t.Setenv(envName("cart-idle-timeout"), "")
+	os.Unsetenv(envName("cart-idle-timeout"))
+
+	tests := []struct {
+		file string // listen_addr of the config file, none if empty
+		env  string // ECOMMERCE_LISTEN_ADDR, unset if empty
+		flag string // -listen-addr, not set if empty
+		want string
+	}{
+		{want: ":8080"},
+		{file: ":8081", want: ":8081"},
+		{env: ":8082", want: ":8082"},
+		{flag: ":8083", want: ":8083"},
+		{file: ":8081", env: ":8082", want: ":8082"},
+		{file: ":8081", flag: ":8083", want: ":8083"},
+		{env: ":8082", flag: ":8083", want: ":8083"},
+		{file: ":8081", env: ":8082", flag: ":8083", want: ":8083"},
+	}
+	for _, test := range tests {
+		args := []string{"-template-dir", testTemplateDir}
+		if test.file != "" { args = append(args, "-config", writeConfigFile(t, `{"listen_addr": "`+test.file+`"}`)) }
+		if test.flag != "" { args = append(args, "-listen-addr", test.flag) }
+		os.Unsetenv(envName("listen-addr"))
+		if test.env != "" { os.Setenv(envName("listen-addr"), test.env) }
+
+		cfg, _, err := Load(args)
+		if err != nil { t.Fatalf("file %q, env %q, flag %q: %v", test.file, test.env, test.flag, err) }
+		if cfg.ListenAddr != test.want { t.Errorf("file %q, env %q, flag %q: listen address %q, want %q", test.file, test.env, test.flag, cfg.ListenAddr, test.want) }
+	}
+
+	// Durations and sizes are parsed the same way by every source, the config file is also found with ECOMMERCE_CONFIG
+	os.Setenv(envPrefix+"CONFIG", writeConfigFile(t, `{"cart_idle_timeout": "72h", "max_upload_size": "2MB", "session_secrets": ["`+strings.Repeat("f", 32)+`"]}`))
+	os.Setenv(envName("cart-idle-timeout"), "48h")
+	cfg, args, err := Load([]string{"-template-dir", testTemplateDir, "-max-upload-size", "5 mb", "migrate", "up"})
+	if err != nil { t.Fatal(err) }
+	if cfg.CartIdleTimeout != 48*time.Hour { t.Errorf("cart idle timeout %s, want the one of the environment (48h)", cfg.CartIdleTimeout) }
+	if cfg.MaxUploadSize != 5<<20 { t.Errorf("max upload size %d, want the one of the flag (5 MB)", cfg.MaxUploadSize) }
+	if len(cfg.SessionSecrets) != 1 { t.Errorf("%d session secrets, want the one of the file", len(cfg.SessionSecrets)) }
+	if strings.Join(args, " ") != "migrate up" { t.Errorf("arguments %q, want the subcommand", args) }
+	if !strings.Contains(cfg.DSN, "parseTime=true") { t.Errorf("the DSN %q does not parse times", cfg.DSN) }
+}
+
+// Tests that the values of the sources that can not be parsed are reported with the source they come from.
+func TestLoadParseErrors(t *testing.T) {
+	t.Setenv(envPrefix+"CONFIG", "")
+	t.Setenv(envName("migrate"), "")
+	os.Unsetenv(envName("migrate"))
+
+	tests := []struct {
+		args []string
+		env  string // ECOMMERCE_MIGRATE, unset if empty
+		file string // Content of the config file, none if empty
+		want string // Part of the error
+	}{
+		{args: []string{"-cart-idle-timeout", "soon"}, want: "config: -cart-idle-timeout:"},
+		{args: []string{"-max-upload-size", "big"}, want: `config: -max-upload-size: invalid size "BIG"`},
+		{env: "maybe", want: "config: ECOMMERCE_MIGRATE:"},
+		{file: `{"cart_idle_timeout": "soon"}`, want: "cart_idle_timeout:"},
+		{file: `{"listen_adress": ":8080"}`, want: `unknown field "listen_adress"`},
+	}
+	for _, test := range tests {
+		args := append([]string{"-template-dir", testTemplateDir}, test.args...)
+		if test.file != "" { args = append(args, "-config", writeConfigFile(t, test.file)) }
+		os.Unsetenv(envName("migrate"))
+		if test.env != "" { os.Setenv(envName("migrate"), test.env) }
+
+		_, _, err := Load(args)
+		if err == nil || !strings.Contains(err.Error(), test.want) { t.Errorf("%q (env %q, file %q): error %v, want one with %q", test.args, test.env, test.file, err, test.want) }
+	}
+}
+
+// Tests that every invalid setting is reported, and that Validate does not change the settings nor create the upload
+// directory.
+func TestValidate(t *testing.T) {
+	cfg := testConfig()
+	cfg.DSN = "root:toor@(127.0.0.1:3306)/ecommerce"
+	cfg.UploadDir = filepath.Join(t.TempDir(), "uploads")
+	if err := cfg.Validate(); err != nil { t.Fatalf("the test settings are invalid: %v", err) }
+	if cfg.DSN != "root:toor@(127.0.0.1:3306)/ecommerce" { t.Errorf("Validate changed the DSN to %q", cfg.DSN) }
+	if _, err := os.Stat(cfg.UploadDir); !os.IsNotExist(err) { t.Errorf("Validate created the upload directory (stat error %v)", err) }
+
+	tests := []struct {
+		change func(c *Config)
+		want   string // The only problem of the settings
+	}{
+		{change: func(c *Config) { c.DSN = "not a dsn" }, want: "dsn: "},
+		{change: func(c *Config) { c.ListenAddr = "8080" }, want: "listen address: "},
+		{change: func(c *Config) { c.TemplateDir = "missing" }, want: "template directory: missing is not a directory"},
+		{change: func(c *Config) { c.TemplateDir = "config_test.go" }, want: "template directory: config_test.go is not a directory"},
+		{change: func(c *Config) { c.UploadDir = "" }, want: "upload directory: can not be empty"},
+		{change: func(c *Config) { c.Storage = "ftp" }, want: `storage: must be local or s3, not "ftp"`},
+		{change: func(c *Config) { c.Storage, c.S3Endpoint, c.S3AccessKey, c.S3SecretKey = "s3", "s3.example.com", "key", "secret" }, want: "s3 bucket: required by the s3 storage"},
+		{change: func(c *Config) { c.Storage, c.S3Bucket, c.S3AccessKey, c.S3SecretKey = "s3", "images", "key", "secret" }, want: "s3 endpoint: required by the s3 storage"},
+		{change: func(c *Config) { c.Storage, c.S3Endpoint, c.S3Bucket, c.S3SecretKey = "s3", "s3.example.com", "images", "secret" }, want: "s3 access key: required by the s3 storage"},
+		{change: func(c *Config) { c.Storage, c.S3Endpoint, c.S3Bucket, c.S3AccessKey = "s3", "s3.example.com", "images", "key" }, want: "s3 secret key: required by the s3 storage"},
+		{change: func(c *Config) { c.MaxUploadSize = 0 }, want: "max upload size: must be greater than 0"},
+		{change: func(c *Config) { c.SessionSecrets = []string{strings.Repeat("s", 32), "short"} }, want: "session secret 2: must have at least 32 characters"},
+		{change: func(c *Config) { c.CartIdleTimeout = -time.Hour }, want: "cart idle timeout: must be greater than 0"},
+		{change: func(c *Config) { c.Demo, c.Migrate = true, true }, want: "migrate: there is no database to migrate in demo mode"},
+		{change: func(c *Config) { c.ShippingMethods = nil }, want: "there must be at least one shipping method"},
+		{change: func(c *Config) { c.TaxMode = "included" }, want: `tax mode: must be exclusive or inclusive, not "included"`},
+	}
+	for _, test := range tests {
+		cfg := testConfig()
+		test.change(cfg)
+		err := cfg.Validate()
+		if err == nil { t.Errorf("no error, want %q", test.want); continue }
+		problems := strings.Split(strings.TrimPrefix(err.Error(), "config: invalid settings:\n  - "), "\n  - ")
+		if len(problems) != 1 || !strings.Contains(problems[0], test.want) { t.Errorf("problems %q, want one with %q", problems, test.want) }
+	}
+
+	// Every problem is listed in the same error
+	cfg = testConfig()
+	cfg.MaxUploadSize, cfg.CartIdleTimeout = 0, 0
+	if err := cfg.Validate(); err == nil || strings.Count(err.Error(), "\n  - ") != 2 { t.Errorf("error %v, want the two problems", err) }
+}
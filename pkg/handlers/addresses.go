@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/cart"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/shipping"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/tax"
+)
+
+/*** Structs ***/
+
+// Custom type that represents the fields of an address in a form, whose inputs are named with a prefix (e.g. "shipping_city").
+type addressFields struct {
+	Prefix    string
+	Address   models.Address
+	Countries []models.Country
+}
+
+// Custom type that represents the address step of the checkout: the shipping address (a saved address of the customer or
+// a new one), the billing address and the shipping method, with the problems of the last attempt and the totals of the
+// cart (the tax is calculated for the shipping address, once it is known).
+type checkoutForm struct {
+	CheckoutKey    string
+	LoggedIn       bool
+	SavedAddresses []models.Address // Address book of the logged in customer
+	AddressID      string           // Saved address to ship to (empty for a new address)
+	Shipping       addressFields
+	SaveAddress    bool // Whether to save the new shipping address in the address book
+	BillingSame    bool // Whether the billing address is the shipping address
+	Billing        addressFields
+	Subtotal       models.Money     // Cost of the items of the cart
+	ShippingQuotes []shipping.Quote // Shipping methods that can take the cart, with their cost
+	ShippingMethod string           // Code of the chosen shipping method
+	TaxInclusive   bool             // Whether the prices include the tax
+	TaxKnown       bool             // Whether the tax was calculated (there is a shipping address to calculate it for)
+	TaxLines       []models.TaxLine // Tax of the cart by tax rule
+	Tax            models.Money
+	Problems       []string
+	Confirmed      cart.ConfirmedPrices // Prices the shopper confirmed after they changed (hidden fields of the form)
+	taxAddress     *models.Address      // Address the tax is calculated for (nil until the shopper enters or chooses one)
+}
+
+// Method that returns the total of the order with a shipping quote: the quote plus the tax unless the prices include it.
+func (f checkoutForm) QuoteTotal(quote shipping.Quote) models.Money {
+	if f.TaxInclusive { return quote.Total }
+	return quote.Total + f.Tax
+}
+
+// Method that returns the total of the order with the chosen shipping method (without shipping if there is none).
+func (f checkoutForm) Total() models.Money {
+	for _, quote := range f.ShippingQuotes {
+		if quote.Method.Code == f.ShippingMethod { return f.QuoteTotal(quote) }
+	}
+	return f.QuoteTotal(shipping.Quote{Total: f.Subtotal})
+}
+
+/*** Helper Functions ***/
+
+// Returns the address in the fields of a form whose inputs are named with the prefix.
+func addressFromForm(r *http.Request, prefix string) models.Address {
+	a := models.Address{
+		FullName:   r.FormValue(prefix + "_full_name"),
+		Line1:      r.FormValue(prefix + "_line1"),
+		Line2:      r.FormValue(prefix + "_line2"),
+		City:       r.FormValue(prefix + "_city"),
+		Region:     r.FormValue(prefix + "_region"),
+		PostalCode: r.FormValue(prefix + "_postal_code"),
+		Country:    r.FormValue(prefix + "_country"),
+		Phone:      r.FormValue(prefix + "_phone"),
+	}
+	a.Normalize()
+	return a
+}
+
+// Returns the (empty) checkout form of the cart with the key of its checkout, with the saved addresses of the logged in
+// customer (the first one is chosen).
+func (h *Handler) newCheckoutForm(r *http.Request, checkoutKey string) checkoutForm {
+	form := checkoutForm{
+		CheckoutKey: checkoutKey,
+		Shipping:    addressFields{Prefix: models.AddressTypeShipping, Countries: models.Countries()},
+		BillingSame: true,
+		Billing:     addressFields{Prefix: models.AddressTypeBilling, Countries: models.Countries()},
+		Confirmed:   cart.ConfirmedPrices{},
+	}
+	if userID, err := uuid.Parse(h.customerID(r)); err == nil {
+		form.LoggedIn = true
+		form.SaveAddress = true
+		form.SavedAddresses, _ = h.Repo.Address.ListAddresses(userID)
+		if len(form.SavedAddresses) > 0 {
+			form.AddressID = form.SavedAddresses[0].AddressID.String()
+			form.taxAddress = &form.SavedAddresses[0]
+		}
+	}
+	return form
+}
+
+// Returns the checkout form of the items of a cart with the shipping methods that can take them and their tax. The form is
+// empty unless the request sent it (htmx requests that refresh the totals), so the choices of the shopper are kept.
+func (h *Handler) cartCheckoutForm(r *http.Request, items []models.OrderItem) checkoutForm {
+	var form checkoutForm
+	if r.FormValue("idempotency_key") != "" {
+		form, _, _ = h.parseCheckoutForm(r, cart.CheckoutKey(items))
+		form.Problems = nil
+	} else {
+		form = h.newCheckoutForm(r, cart.CheckoutKey(items))
+	}
+	h.priceCheckout(&form, items)
+	return form
+}
+
+// Sets the cost of the items of the cart (at the prices the shopper confirmed, if they changed), the shipping methods that can take them and the tax of the items (if the form
+// has an address to calculate it for) in a checkout form. If the chosen method is not one of them, the first one is
+// chosen.
+func (h *Handler) priceCheckout(form *checkoutForm, items []models.OrderItem) {
+	form.Confirmed.Apply(items)
+	form.Subtotal = getTotalCartCost(items)
+	form.TaxInclusive = h.Config.PricesIncludeTax()
+	if form.taxAddress != nil {
+		tax.Apply(h.Config.TaxRules, form.TaxInclusive, *form.taxAddress, items)
+		form.TaxKnown = true
+		form.TaxLines = models.TaxLines(items)
+		for _, line := range form.TaxLines {
+			form.Tax += line.Amount
+		}
+	}
+
+	form.ShippingQuotes = shipping.Quotes(h.Config.ShippingMethods, items)
+	for _, quote := range form.ShippingQuotes {
+		if quote.Method.Code == form.ShippingMethod { return }
+	}
+	form.ShippingMethod = ""
+	if len(form.ShippingQuotes) > 0 { form.ShippingMethod = form.ShippingQuotes[0].Method.Code }
+}
+
+// Returns the checkout form sent by the shopper with its problems, and the shipping and billing addresses of the order
+// (only valid if there are no problems).
+func (h *Handler) parseCheckoutForm(r *http.Request, checkoutKey string) (checkoutForm, models.Address, models.Address) {
+	form := h.newCheckoutForm(r, checkoutKey)
+	form.AddressID = r.FormValue("address_id")
+	form.Shipping.Address = addressFromForm(r, models.AddressTypeShipping)
+	form.SaveAddress = form.LoggedIn && r.FormValue("save_address") == "on"
+	form.BillingSame = r.FormValue("billing_same") == "on"
+	form.Billing.Address = addressFromForm(r, models.AddressTypeBilling)
+	form.ShippingMethod = r.FormValue("shipping_method")
+	form.Confirmed = parseConfirmedPrices(r)
+	if !shipping.HasMethod(h.Config.ShippingMethods, form.ShippingMethod) { form.Problems = append(form.Problems, "Choose a Shipping Method") }
+
+	// Ship to a saved address of the customer or to the new address
+	shippingAddress := form.Shipping.Address
+	form.taxAddress = nil
+	if shippingAddress.Country != "" { form.taxAddress = &shippingAddress }
+	if form.AddressID != "" {
+		addressID, err := uuid.Parse(form.AddressID)
+		userID, _ := uuid.Parse(h.customerID(r))
+		saved, findErr := h.Repo.Address.GetAddress(userID, addressID)
+		if err != nil || findErr != nil {
+			form.Problems = append(form.Problems, "Choose One of Your Saved Addresses")
+			return form, shippingAddress, shippingAddress
+		}
+		shippingAddress = *saved
+		form.taxAddress = &shippingAddress
+	} else {
+		for _, problem := range shippingAddress.Validate() {
+			form.Problems = append(form.Problems, "Shipping Address: "+problem)
+		}
+	}
+
+	billingAddress := shippingAddress
+	if !form.BillingSame {
+		billingAddress = form.Billing.Address
+		for _, problem := range billingAddress.Validate() {
+			form.Problems = append(form.Problems, "Billing Address: "+problem)
+		}
+	}
+	return form, shippingAddress, billingAddress
+}
+
+// Returns the prices the shopper confirmed in the hidden confirmed_price[<product ID>/<variant ID>] fields of the checkout
+// form. Invalid fields are ignored: the prices of their items are not confirmed, so the order is refused again.
+func parseConfirmedPrices(r *http.Request) cart.ConfirmedPrices {
+	confirmed := cart.ConfirmedPrices{}
+	for name, values := range r.PostForm {
+		line, ok := strings.CutPrefix(name, "confirmed_price[")
+		if !ok || !strings.HasSuffix(line, "]") { continue }
+		productValue, variantValue, _ := strings.Cut(strings.TrimSuffix(line, "]"), "/")
+		productID, err := uuid.Parse(productValue)
+		if err != nil { continue }
+		variantID, err := uuid.Parse(variantValue)
+		if err != nil { continue }
+		price, err := models.ParseMoney(values[0])
+		if err != nil { continue }
+		confirmed[cart.Line{ProductID: productID, VariantID: variantID}] = price
+	}
+	return confirmed
+}
+
+// Saves the new shipping address of a placed order in the address book of the customer if they asked to (an error is
+// only logged, the order is already placed).
+func (h *Handler) saveCheckoutAddress(r *http.Request, form checkoutForm, shippingAddress models.Address) {
+	if !form.SaveAddress || form.AddressID != "" { return }
+	userID, err := uuid.Parse(h.customerID(r))
+	if err != nil { return }
+
+	shippingAddress.UserID = userID
+	if err = h.Repo.Address.CreateAddress(&shippingAddress); err != nil { log.Println("Error saving the address of an order:", err) }
+}
+
+// Renders the address book of the logged in customer (the full page or, for htmx requests, the list) with the problems
+// of the new address (if any).
+func (h *Handler) renderAddressBook(w http.ResponseWriter, r *http.Request, customer *models.User, newAddress models.Address, problems []string) {
+	addresses, err := h.Repo.Address.ListAddresses(customer.UserID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Customer   *models.User
+		Addresses  []models.Address
+		NewAddress addressFields
+		Problems   []string
+	}{
+		Customer:   customer,
+		Addresses:  addresses,
+		NewAddress: addressFields{Prefix: "address", Address: newAddress, Countries: models.Countries()},
+		Problems:   problems,
+	}
+	if r.Header.Get("HX-Request") == "true" {
+		tmpl.ExecuteTemplate(w, "addressList", data)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "addressBook", data)
+}
+
+/*** Handlers ***/
+
+// Renders the address book of the logged in customer (guests are sent to the login page).
+func (h *Handler) AddressBookPage(w http.ResponseWriter, r *http.Request) {
+	customer := h.currentCustomer(r)
+	if customer == nil {
+		redirect(w, r, "/login")
+		return
+	}
+	h.renderAddressBook(w, r, customer, models.Address{}, nil)
+}
+
+// Saves a new address in the address book of the logged in customer.
+func (h *Handler) CreateAddress(w http.ResponseWriter, r *http.Request) {
+	customer := h.currentCustomer(r)
+	if customer == nil {
+		redirect(w, r, "/login")
+		return
+	}
+
+	address := addressFromForm(r, "address")
+	if problems := address.Validate(); len(problems) > 0 {
+		h.renderAddressBook(w, r, customer, address, problems)
+		return
+	}
+
+	address.UserID = customer.UserID
+	if err := h.Repo.Address.CreateAddress(&address); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderAddressBook(w, r, customer, models.Address{}, nil)
+}
+
+// Deletes an address from the address book of the logged in customer.
+func (h *Handler) DeleteAddress(w http.ResponseWriter, r *http.Request) {
+	customer := h.currentCustomer(r)
+	if customer == nil {
+		redirect(w, r, "/login")
+		return
+	}
+
+	addressID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return
+	}
+	err = h.Repo.Address.DeleteAddress(customer.UserID, addressID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderAddressBook(w, r, customer, models.Address{}, nil)
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Constants ***/
+const adminCookieName = "admin"           // Name of the (signed) cookie that holds the ID of the logged in admin
+const adminSessionMaxAge = 12 * time.Hour // Time an admin stays logged in
+const adminLoginPath = "/admin/login"     // Page unauthenticated admin requests are sent to
+
+// Custom type used as the key of the logged in admin in the request context.
+type adminContextKey struct{}
+
+/*** Helper Functions ***/
+
+// Returns the admin stored in the request context by the AdminAuth middleware, or nil if there is none.
+func currentAdmin(r *http.Request) *models.AdminUser {
+	admin, _ := r.Context().Value(adminContextKey{}).(*models.AdminUser)
+	return admin
+}
+
+// Sends an unauthenticated (or unauthorized) admin request to the login page. htmx requests get an HX-Redirect header so
+// the whole page is replaced instead of swapping an error into the current view.
+func redirectToAdminLogin(w http.ResponseWriter, r *http.Request, reason string) {
+	url := adminLoginPath
+	if reason != "" { url += "?reason=" + reason }
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", url)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// Returns the admin of the signed admin cookie of the request, or nil if there is no (valid) cookie. The admin is loaded
+// on every request so role changes (or removals) take effect immediately.
+func (h *Handler) loggedInAdmin(r *http.Request) *models.AdminUser {
+	adminIDStr, ok := h.Sessions.Value(r, adminCookieName)
+	if !ok { return nil }
+	adminID, err := uuid.Parse(adminIDStr)
+	if err != nil { return nil }
+	admin, err := h.Repo.Admin.GetAdminByID(adminID)
+	if err != nil { return nil }
+	return admin
+}
+
+/*** Middleware ***/
+
+// Middleware that only lets logged in admins through and stores the admin in the request context.
+func (h *Handler) AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := h.loggedInAdmin(r)
+		if admin == nil {
+			redirectToAdminLogin(w, r, "")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, admin)))
+	})
+}
+
+// Wraps a handler so it is only run if the role of the logged in admin grants the permission.
+func (h *Handler) Permit(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !currentAdmin(r).Can(permission) {
+			if r.Header.Get("HX-Request") == "true" {
+				redirectToAdminLogin(w, r, "forbidden")
+				return
+			}
+			http.Error(w, "Your role does not allow you to "+permission, http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+/*** Handlers ***/
+
+// Renders the admin login page.
+func (h *Handler) AdminLoginView(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Forbidden bool
+	}{
+		Forbidden: r.URL.Query().Get("reason") == "forbidden",
+	}
+	tmpl.ExecuteTemplate(w, "adminLogin", data)
+}
+
+// Logs an admin in with their email and password.
+func (h *Handler) AdminLogin(w http.ResponseWriter, r *http.Request) {
+	admin, err := h.Repo.Admin.Authenticate(r.FormValue("email"), r.FormValue("password"))
+	if err == repository.ErrInvalidCredentials {
+		sendAuthMessage(w, []string{"Invalid Email or Password"})
+		return
+	}
+	if err != nil {
+		sendAuthMessage(w, []string{"Error Logging In: " + err.Error()})
+		return
+	}
+
+	h.Sessions.SetValue(w, adminCookieName, admin.AdminID.String(), adminSessionMaxAge)
+
+	// Send the admin to the first page their role can see
+	if admin.Can(models.PermViewProducts) {
+		redirect(w, r, "/manageproducts")
+		return
+	}
+	redirect(w, r, "/manageorders")
+}
+
+// Logs the admin out.
+func (h *Handler) AdminLogout(w http.ResponseWriter, r *http.Request) {
+	h.Sessions.Clear(w, adminCookieName)
+	redirect(w, r, adminLoginPath)
+}
+
+// Renders the staff page (admins and their roles).
+func (h *Handler) StaffPage(w http.ResponseWriter, r *http.Request) {
+	admins, err := h.Repo.Admin.ListAdmins()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Admin  *models.AdminUser
+		Admins []models.AdminUser
+		Roles  []string
+	}{
+		Admin:  currentAdmin(r),
+		Admins: admins,
+		Roles:  models.AdminRoles(),
+	}
+	tmpl.ExecuteTemplate(w, "staff", data)
+}
+
+// Creates a new admin (staff member) with a role.
+func (h *Handler) CreateStaff(w http.ResponseWriter, r *http.Request) {
+	var responseMessages []string
+
+	//Check for empty and invalid fields
+	fullName := r.FormValue("full_name")
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+	role := r.FormValue("role")
+
+	if fullName == "" || email == "" || password == "" || role == "" {
+		responseMessages = append(responseMessages, "All Fields Are Required")
+	}
+	if _, err := mail.ParseAddress(email); email != "" && err != nil {
+		responseMessages = append(responseMessages, "Invalid Email")
+	}
+	if password != "" && len(password) < minPasswordLength {
+		responseMessages = append(responseMessages, "The Password Must Have At Least 8 Characters")
+	}
+	if len(responseMessages) > 0 {
+		sendAuthMessage(w, responseMessages)
+		return
+	}
+
+	admin := models.AdminUser{FullName: fullName, Email: email, Role: role}
+	err := h.Repo.Admin.CreateAdmin(&admin, password)
+	if err == repository.ErrEmailTaken {
+		sendAuthMessage(w, []string{"A Staff Member With This Email Already Exists"})
+		return
+	}
+	if err == repository.ErrInvalidRole {
+		sendAuthMessage(w, []string{"Invalid Role"})
+		return
+	}
+	if err != nil {
+		sendAuthMessage(w, []string{"Error Creating Staff Member: " + err.Error()})
+		return
+	}
+
+	redirect(w, r, "/staff")
+}
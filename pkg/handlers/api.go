@@ -0,0 +1,788 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/cart"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/images"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/shipping"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/tax"
+)
+
+/*** Constants ***/
+const apiMaxBodySize = 1 << 20 // Maximum size of a JSON request body (1 MB)
+
+/*** Structs ***/
+
+// Custom type that contains the pagination metadata of a list, the same values the admin tables (ListProducts and
+// ListOrders) are paginated with.
+type apiPagination struct {
+	Page         int `json:"page"`
+	Limit        int `json:"limit"`
+	TotalItems   int `json:"total_items"`
+	TotalPages   int `json:"total_pages"`
+	PreviousPage int `json:"previous_page"` // 0 on the first page
+	NextPage     int `json:"next_page"`     // Greater than total_pages on the last page
+}
+
+// Custom type that contains the error of a failed API request, sent as {"error": {...}}.
+type apiError struct {
+	Code    string `json:"code"`              // Stable, machine readable code (e.g. "out_of_stock")
+	Message string `json:"message"`           // Human readable description
+	Details any    `json:"details,omitempty"` // Extra data of some errors (e.g. the stock shortages of a checkout)
+}
+
+// Custom type that represents an image of a product in the API, with the URL of every size.
+type apiImage struct {
+	models.ProductImage
+	URLs map[string]string `json:"urls"` // URL by size name (thumb, card and full)
+}
+
+// Custom type that represents a product in the API, with the URLs of its images instead of their file names.
+type apiProduct struct {
+	models.Product
+	ImageURL string     `json:"image_url"` // URL of the card size of the primary image (empty if there is none)
+	Images   []apiImage `json:"images"`
+}
+
+// Custom type that represents a product in a cart or order in the API.
+type apiOrderItem struct {
+	models.OrderItem
+	Product apiProduct `json:"product"`
+}
+
+// Custom type that represents the cart of the visitor in the API.
+type apiCart struct {
+	Items           []apiOrderItem   `json:"items"`
+	TotalCost       models.Money     `json:"total_cost"`       // Cost of the items (without shipping), in cents
+	ShippingMethods []shipping.Quote `json:"shipping_methods"` // Shipping methods that can take the cart, with their cost and the total
+	CheckoutKey     string           `json:"checkout_key"`     // Idempotency-Key header of the checkout of the cart (empty for an empty cart)
+}
+
+// Custom type that represents a placed order in the API.
+type apiPlacedOrder struct {
+	OrderID         uuid.UUID        `json:"order_id"`
+	Items           []apiOrderItem   `json:"items"`
+	ShippingMethod  string           `json:"shipping_method"`
+	ShippingName    string           `json:"shipping_name"`
+	ShippingCost    models.Money     `json:"shipping_cost"` // In cents
+	TaxInclusive    bool             `json:"tax_inclusive"` // Whether the prices of the items included their tax
+	Tax             models.Money     `json:"tax"`           // Tax of the items, in cents
+	TaxLines        []models.TaxLine `json:"tax_lines"`     // Tax of the items by tax rule
+	TotalCost       models.Money     `json:"total_cost"`    // Cost of the items plus the shipping and the tax (unless the prices included it), in cents
+	ShippingAddress *models.Address  `json:"shipping_address"`
+	BillingAddress  *models.Address  `json:"billing_address"`
+}
+
+// Custom type that represents an order with its items, total cost, next statuses and status history in the API.
+type apiOrder struct {
+	models.Order
+	Items         []apiOrderItem             `json:"items"`
+	Tax           models.Money               `json:"tax"`        // Tax of the items, in cents
+	TaxLines      []models.TaxLine           `json:"tax_lines"`  // Tax of the items by tax rule
+	TotalCost     models.Money               `json:"total_cost"` // Cost of the items plus the shipping and the tax (unless the prices included it), in cents
+	NextStatuses  []string                   `json:"next_statuses"`
+	StatusHistory []models.OrderStatusChange `json:"status_history"`
+}
+
+// Custom type that contains the body of a request to add a product to the cart.
+type apiAddCartItemRequest struct {
+	ProductID uuid.UUID `json:"product_id"`
+	VariantID uuid.UUID `json:"variant_id,omitempty"` // Omitted for products without variants
+}
+
+// Custom type that contains the body of a request to change the quantity of a product in the cart.
+type apiUpdateCartItemRequest struct {
+	VariantID uuid.UUID `json:"variant_id,omitempty"` // Omitted for products without variants
+	Action    string    `json:"action"`               // add, subtract or remove
+}
+
+// Custom type that contains the body of a checkout request: the shipping address (or a saved address of the logged in
+// customer), the billing address, the shipping method and the prices the client confirmed after they changed.
+type apiCheckoutRequest struct {
+	AddressID       uuid.UUID           `json:"address_id,omitempty"`       // Saved address to ship to, instead of shipping_address
+	ShippingAddress *models.Address     `json:"shipping_address,omitempty"` // Omitted when shipping to a saved address
+	BillingAddress  *models.Address     `json:"billing_address,omitempty"`  // Omitted if it is the shipping address
+	ShippingMethod  string              `json:"shipping_method"`            // Code of one of the shipping_methods of the cart
+	ConfirmedPrices []apiConfirmedPrice `json:"confirmed_prices,omitempty"` // New prices of every price_changed response of the checkout
+}
+
+// Custom type that contains the price of a unit of a product (variant) the client confirmed after a checkout was refused
+// because it changed (the new_price of the details of the price_changed error).
+type apiConfirmedPrice struct {
+	ProductID uuid.UUID    `json:"product_id"`
+	VariantID uuid.UUID    `json:"variant_id,omitempty"` // Omitted for products without variants
+	Price     models.Money `json:"price"`                // In cents
+}
+
+// Custom type that contains the body of a login request (of a customer or an admin).
+type apiLoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// Custom type that contains the body of a request to change the status of an order.
+type apiOrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// Custom type that contains the body of every error response.
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+/*** Helper Functions ***/
+
+// Sends a value as a JSON document with the status code, wrapped in {"data": ...}.
+func writeJSON(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+// Sends a list with its pagination metadata, wrapped in {"data": [...], "pagination": {...}}.
+func writeJSONList(w http.ResponseWriter, data any, pagination apiPagination) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(map[string]any{"data": data, "pagination": pagination})
+}
+
+// Sends an error envelope with the status code, code and message.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	writeJSONErrorDetails(w, status, code, message, nil)
+}
+
+// Sends an error envelope with extra details (e.g. the items short of stock).
+func writeJSONErrorDetails(w http.ResponseWriter, status int, code, message string, details any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(apiErrorResponse{Error: apiError{Code: code, Message: message, Details: details}})
+}
+
+// Decodes the JSON body of a request into v, rejecting unknown fields and trailing data. It sends the error response and
+// returns false if the body is not valid.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(v)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF { err = errors.New("the body must contain a single JSON object") }
+	if err == nil { return true }
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "body_too_large", "The request body is too big")
+		return false
+	}
+	if err == io.EOF {
+		writeJSONError(w, http.StatusBadRequest, "invalid_json", "The request body is empty")
+		return false
+	}
+	writeJSONError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body: "+err.Error())
+	return false
+}
+
+// Returns whether the Accept header of a request allows a JSON response (a missing header allows anything).
+func acceptsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" { return true }
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil { continue }
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q <= 0 { continue } // q=0 means "not acceptable"
+		switch mediaType {
+			case "application/json", "application/*", "*/*":
+				return true
+		}
+	}
+	return false
+}
+
+// Returns whether a request has a body (requests without one do not need a content type).
+func hasBody(r *http.Request) bool {
+	return r.ContentLength > 0 || (r.ContentLength == -1 && r.Body != nil && r.Body != http.NoBody)
+}
+
+// Returns the methods (other than the one of the request) the routes of the router support for the path of a request.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	var methods []string
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		if method == r.Method { continue }
+		var match mux.RouteMatch
+		probe := r.Clone(r.Context())
+		probe.Method = method
+		if router.Match(probe, &match) && match.MatchErr == nil { methods = append(methods, method) }
+	}
+	return methods
+}
+
+// Parses the page and limit query parameters the way the admin tables do (page 1 and limit 10 by default).
+func parsePagination(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 { page = 1 }
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 { limit = 10 } // Default limit
+	return page, limit
+}
+
+// Returns the pagination metadata of a page of a list with the total number of items.
+func newPagination(page, limit, totalItems int) apiPagination {
+	return apiPagination{
+		Page:         page,
+		Limit:        limit,
+		TotalItems:   totalItems,
+		TotalPages:   int(math.Ceil(float64(totalItems) / float64(limit))),
+		PreviousPage: page - 1,
+		NextPage:     page + 1,
+	}
+}
+
+// Returns the API representation of a product, with the URLs of its images from the storage.
+func (h *Handler) apiProduct(product models.Product) apiProduct {
+	result := apiProduct{Product: product, Images: []apiImage{}}
+	if product.ProductImage != "" { result.ImageURL = imageURL(h.Storage, product.ProductImage, "card") }
+	for _, image := range product.Images {
+		urls := map[string]string{}
+		for _, size := range images.Sizes {
+			urls[size.Name] = imageURL(h.Storage, image.Filename, size.Name)
+		}
+		result.Images = append(result.Images, apiImage{ProductImage: image, URLs: urls})
+	}
+	return result
+}
+
+// Returns the API representation of the items of a cart or order.
+func (h *Handler) apiOrderItems(items []models.OrderItem) []apiOrderItem {
+	result := make([]apiOrderItem, len(items))
+	for i, item := range items {
+		result[i] = apiOrderItem{OrderItem: item, Product: h.apiProduct(item.Product)}
+	}
+	return result
+}
+
+// Returns the API representation of a cart with its items.
+func (h *Handler) apiCart(items []models.OrderItem) apiCart {
+	quotes := shipping.Quotes(h.Config.ShippingMethods, items)
+	if quotes == nil { quotes = []shipping.Quote{} }
+	return apiCart{Items: h.apiOrderItems(items), TotalCost: getTotalCartCost(items), ShippingMethods: quotes, CheckoutKey: cart.CheckoutKey(items)}
+}
+
+// Returns the tax of an order by tax rule (an empty list, not null, if it is untaxed).
+func apiTaxLines(order *models.Order) []models.TaxLine {
+	lines := order.TaxLines()
+	if lines == nil { lines = []models.TaxLine{} }
+	return lines
+}
+
+// Returns the API representation of a placed order with its items, shipping, tax and addresses.
+func (h *Handler) apiPlacedOrder(order *models.Order) apiPlacedOrder {
+	return apiPlacedOrder{
+		OrderID:         order.OrderID,
+		Items:           h.apiOrderItems(order.Items),
+		ShippingMethod:  order.ShippingMethod,
+		ShippingName:    order.ShippingName,
+		ShippingCost:    order.ShippingCost,
+		TaxInclusive:    order.TaxInclusive,
+		Tax:             order.Tax(),
+		TaxLines:        apiTaxLines(order),
+		TotalCost:       order.Total(),
+		ShippingAddress: order.ShippingAddress,
+		BillingAddress:  order.BillingAddress,
+	}
+}
+
+// Returns the shipping and billing addresses of a checkout request with their problems (the addresses are only valid if
+// there are none). The billing address is the shipping address if it is omitted.
+func (h *Handler) apiCheckoutAddresses(r *http.Request, body apiCheckoutRequest) (models.Address, models.Address, []string) {
+	var shippingAddress models.Address
+	var problems []string
+	switch {
+		case body.AddressID != uuid.Nil:
+			userID, _ := uuid.Parse(h.customerID(r))
+			saved, err := h.Repo.Address.GetAddress(userID, body.AddressID)
+			if err != nil { return shippingAddress, shippingAddress, []string{"address_id: Not a Saved Address of the Logged In Customer"} }
+			shippingAddress = *saved
+		case body.ShippingAddress != nil:
+			shippingAddress = *body.ShippingAddress
+			shippingAddress.Normalize()
+			for _, problem := range shippingAddress.Validate() {
+				problems = append(problems, "shipping_address: "+problem)
+			}
+		default:
+			return shippingAddress, shippingAddress, []string{"shipping_address: The Shipping Address Is Required"}
+	}
+
+	billingAddress := shippingAddress
+	if body.BillingAddress != nil {
+		billingAddress = *body.BillingAddress
+		billingAddress.Normalize()
+		for _, problem := range billingAddress.Validate() {
+			problems = append(problems, "billing_address: "+problem)
+		}
+	}
+	return shippingAddress, billingAddress, problems
+}
+
+// Parses an optional variant ID (an empty value is uuid.Nil, for products without variants).
+func parseOptionalVariantID(value string) (uuid.UUID, error) {
+	if value == "" { return uuid.Nil, nil }
+	return uuid.Parse(value)
+}
+
+/*** Middleware ***/
+
+// Middleware of the JSON API. It rejects requests that do not accept a JSON response (406) or send a body that is not
+// JSON (415), and limits the size of the request bodies.
+func (h *Handler) APIMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsJSON(r) {
+			writeJSONError(w, http.StatusNotAcceptable, "not_acceptable", "The API only responds with application/json")
+			return
+		}
+
+		if hasBody(r) {
+			mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if err != nil || mediaType != "application/json" {
+				writeJSONError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "The request body must be application/json")
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, apiMaxBodySize)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Middleware that only lets logged in admins through (401 otherwise) and stores the admin in the request context.
+func (h *Handler) APIAdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := h.loggedInAdmin(r)
+		if admin == nil {
+			writeJSONError(w, http.StatusUnauthorized, "unauthorized", "Log in as an admin to use this endpoint")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminContextKey{}, admin)))
+	})
+}
+
+// Wraps an API handler so it is only run if the role of the logged in admin grants the permission (403 otherwise).
+func (h *Handler) APIPermit(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !currentAdmin(r).Can(permission) {
+			writeJSONError(w, http.StatusForbidden, "forbidden", "Your role does not allow you to "+permission)
+			return
+		}
+		next(w, r)
+	}
+}
+
+/*** Handlers ***/
+
+// Responds to the API requests that do not match any endpoint.
+func (h *Handler) APINotFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "not_found", "There is no endpoint "+r.Method+" "+r.URL.Path)
+}
+
+// Responds to the API requests whose endpoint does not support the method.
+func (h *Handler) APIMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusMethodNotAllowed, "method_not_allowed", "The endpoint does not support "+r.Method)
+}
+
+// Returns the handler of the API requests that no endpoint matches. mux does not report every unsupported method of the
+// routes of a subrouter, so the path is matched again with the other methods: 405 (with the Allow header) if an endpoint
+// supports one of them, 404 otherwise.
+func (h *Handler) APIUnmatched(api *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods := allowedMethods(api, r)
+		if len(methods) == 0 {
+			h.APINotFound(w, r)
+			return
+		}
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		h.APIMethodNotAllowed(w, r)
+	})
+}
+
+// Lists the products in a paginated way.
+func (h *Handler) APIListProducts(w http.ResponseWriter, r *http.Request) {
+	page, limit := parsePagination(r)
+
+	products, err := h.Repo.Product.ListProducts(limit, (page-1)*limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	totalProducts, err := h.Repo.Product.GetTotalProductsCount()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	result := make([]apiProduct, len(products))
+	for i, product := range products {
+		result[i] = h.apiProduct(product)
+	}
+	writeJSONList(w, result, newPagination(page, limit, totalProducts))
+}
+
+// Returns a product with its categories, options, variants and images.
+func (h *Handler) APIGetProduct(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid product ID")
+		return
+	}
+
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Product not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.apiProduct(*product))
+}
+
+// Returns the cart of the visitor (identified by the session cookie, which is set if the request does not have one).
+func (h *Handler) APIGetCart(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.apiCart(cartItems))
+}
+
+// Adds a product (variant) to the cart of the visitor. It responds 201 if it was added and 200 if it was already there.
+func (h *Handler) APIAddCartItem(w http.ResponseWriter, r *http.Request) {
+	var body apiAddCartItemRequest
+	if !decodeJSON(w, r, &body) { return }
+
+	product, err := h.Repo.Product.GetProductByID(body.ProductID)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Product not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	cartItems, added, err := h.Carts.AddItem(getSessionID(w, r), h.customerID(r), *product, body.VariantID)
+	if err == cart.ErrVariantRequired {
+		writeJSONError(w, http.StatusUnprocessableEntity, "variant_required", "Choose a variant of "+product.ProductName)
+		return
+	}
+	if err == cart.ErrOutOfStock {
+		writeJSONError(w, http.StatusConflict, "out_of_stock", product.ProductName+" is out of stock")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	status := http.StatusOK
+	if added { status = http.StatusCreated }
+	writeJSON(w, status, h.apiCart(cartItems))
+}
+
+// Updates the quantity of a product (variant) in the cart of the visitor with an action (add, subtract or remove).
+func (h *Handler) APIUpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["product_id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid product ID")
+		return
+	}
+
+	var body apiUpdateCartItemRequest
+	if !decodeJSON(w, r, &body) { return }
+
+	h.updateCartItem(w, r, productID, body.VariantID, body.Action)
+}
+
+// Removes a product (variant, "variant_id" query parameter) from the cart of the visitor.
+func (h *Handler) APIRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["product_id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid product ID")
+		return
+	}
+	variantID, err := parseOptionalVariantID(r.URL.Query().Get("variant_id"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid variant ID")
+		return
+	}
+
+	h.updateCartItem(w, r, productID, variantID, "remove")
+}
+
+// Applies a quantity action to an item of the cart of the visitor and responds with the cart.
+func (h *Handler) updateCartItem(w http.ResponseWriter, r *http.Request, productID, variantID uuid.UUID, action string) {
+	cartItems, _, err := h.Carts.UpdateQuantity(getSessionID(w, r), productID, variantID, action)
+	if err == cart.ErrItemNotFound {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Product not found in cart")
+		return
+	}
+	if err == cart.ErrInvalidAction {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid_action", "The action must be add, subtract or remove")
+		return
+	}
+	if err == cart.ErrOutOfStock {
+		writeJSONError(w, http.StatusConflict, "out_of_stock", "There are no more units in stock")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, h.apiCart(cartItems))
+}
+
+// Places an order with the cart of the visitor (which is emptied) for the logged in customer (or a guest), shipped to
+// the address of the body (checked with the rules of its country) with the shipping method of the body, and the tax of
+// the rules of the region of the address. The Idempotency-Key header must be the checkout key of the cart: a retry with
+// the key of an order already placed responds with that order (200) instead of placing it again, if the caller placed
+// it. If a price changed since the items were added (or since the client confirmed it) it responds 409 with the changed
+// lines and places nothing, so the client confirms the new prices by checking out again with them in confirmed_prices.
+func (h *Handler) APICheckout(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		writeJSONError(w, http.StatusBadRequest, "missing_idempotency_key", "The Idempotency-Key header must be the checkout_key of the cart")
+		return
+	}
+
+	var body apiCheckoutRequest
+	if !decodeJSON(w, r, &body) { return }
+	shippingAddress, billingAddress, problems := h.apiCheckoutAddresses(r, body)
+	if len(problems) > 0 {
+		writeJSONErrorDetails(w, http.StatusUnprocessableEntity, "invalid_address", "The addresses are not valid", problems)
+		return
+	}
+	if !shipping.HasMethod(h.Config.ShippingMethods, body.ShippingMethod) {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid_shipping_method", "The shipping_method must be the code of one of the shipping_methods of the cart")
+		return
+	}
+
+	sessionID := getSessionID(w, r)
+	order := models.Order{UserID: h.customerID(r), SessionID: sessionID, TaxInclusive: h.Config.PricesIncludeTax(),
+		ShippingAddress: &shippingAddress, BillingAddress: &billingAddress}
+	confirmed := cart.ConfirmedPrices{}
+	for _, price := range body.ConfirmedPrices {
+		confirmed[cart.Line{ProductID: price.ProductID, VariantID: price.VariantID}] = price.Price
+	}
+	_, err := h.Carts.Checkout(sessionID, key, confirmed, func(items []models.OrderItem) error {
+		quote, err := shipping.QuoteFor(h.Config.ShippingMethods, body.ShippingMethod, items)
+		if err != nil { return err }
+		tax.Apply(h.Config.TaxRules, order.TaxInclusive, shippingAddress, items)
+		order.Items = items
+		order.ShippingMethod, order.ShippingName, order.ShippingCost = quote.Method.Code, quote.Method.Name, quote.Cost
+		_, err = h.Repo.Order.PlaceOrderWithItems(&order, key)
+		return err
+	})
+	if err == cart.ErrCartChanged || err == repository.ErrOrderAlreadyPlaced {
+		// A retry (the cart is gone once the order is placed): respond with the order placed with the key
+		placed, findErr := h.retriedOrder(r, sessionID, key)
+		if findErr != nil {
+			writeJSONError(w, http.StatusInternalServerError, "internal_error", findErr.Error())
+			return
+		}
+		if placed != nil {
+			writeJSON(w, http.StatusOK, h.apiPlacedOrder(placed))
+			return
+		}
+	}
+	if err == cart.ErrCartChanged {
+		writeJSONError(w, http.StatusConflict, "cart_changed", "The Idempotency-Key is not the checkout_key of the cart, get the cart and try again")
+		return
+	}
+	if err == cart.ErrEmptyCart {
+		writeJSONError(w, http.StatusConflict, "empty_cart", "The cart is empty")
+		return
+	}
+	if err == shipping.ErrMethodUnavailable {
+		writeJSONError(w, http.StatusUnprocessableEntity, "shipping_method_unavailable", "The shipping method can not take the cart, choose one of the shipping_methods of the cart")
+		return
+	}
+	var stockErr *repository.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		writeJSONErrorDetails(w, http.StatusConflict, "insufficient_stock", "Some items do not have enough stock", stockErr.Shortages)
+		return
+	}
+	var priceErr *repository.PriceChangedError
+	if errors.As(err, &priceErr) {
+		writeJSONErrorDetails(w, http.StatusConflict, "price_changed", "Some prices changed, check out again with their new_price in confirmed_prices to confirm them", priceErr.Changes)
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error Placing Order "+err.Error())
+		return
+	}
+
+	// Respond with the stored order, like a retry does (the items of the cart have the ID of the cart, not of the order)
+	placed, err := h.Repo.Order.GetOrderWithProducts(order.OrderID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, h.apiPlacedOrder(placed))
+}
+
+// Logs a customer in with their email and password (JSON body) and merges their guest cart into their account cart.
+func (h *Handler) APILogin(w http.ResponseWriter, r *http.Request) {
+	var body apiLoginRequest
+	if !decodeJSON(w, r, &body) { return }
+
+	user, err := h.Repo.User.Authenticate(body.Email, body.Password)
+	if err == repository.ErrInvalidCredentials {
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid Email or Password")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	if err = h.logCustomerIn(w, r, user); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", "Error Loading Your Cart: "+err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+// Logs the customer out. The visitor gets a new (empty) session, the customer cart stays saved in their account.
+func (h *Handler) APILogout(w http.ResponseWriter, r *http.Request) {
+	h.Sessions.Clear(w, customerCookieName)
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Logs an admin in with their email and password (JSON body).
+func (h *Handler) APIAdminLogin(w http.ResponseWriter, r *http.Request) {
+	var body apiLoginRequest
+	if !decodeJSON(w, r, &body) { return }
+
+	admin, err := h.Repo.Admin.Authenticate(body.Email, body.Password)
+	if err == repository.ErrInvalidCredentials {
+		writeJSONError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid Email or Password")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	h.Sessions.SetValue(w, adminCookieName, admin.AdminID.String(), adminSessionMaxAge)
+	writeJSON(w, http.StatusOK, admin)
+}
+
+// Logs the admin out.
+func (h *Handler) APIAdminLogout(w http.ResponseWriter, r *http.Request) {
+	h.Sessions.Clear(w, adminCookieName)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Lists the orders in a paginated way.
+func (h *Handler) APIListOrders(w http.ResponseWriter, r *http.Request) {
+	page, limit := parsePagination(r)
+
+	orders, err := h.Repo.Order.ListOrders(limit, (page-1)*limit)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	totalOrders, err := h.Repo.Order.GetTotalOrdersCount()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	if orders == nil { orders = []models.Order{} }
+	writeJSONList(w, orders, newPagination(page, limit, totalOrders))
+}
+
+// Returns an order with its items, total cost and status history.
+func (h *Handler) APIGetOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid order ID")
+		return
+	}
+	h.writeAPIOrder(w, orderID)
+}
+
+// Updates the status of an order (following the order lifecycle) and responds with the order.
+func (h *Handler) APIUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	orderID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid_id", "Invalid order ID")
+		return
+	}
+
+	var body apiOrderStatusRequest
+	if !decodeJSON(w, r, &body) { return }
+
+	err = h.Repo.Order.UpdateOrderStatus(orderID, body.Status, currentAdmin(r).Email)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Order not found")
+		return
+	}
+	if err == repository.ErrInvalidStatusTransition {
+		writeJSONError(w, http.StatusUnprocessableEntity, "invalid_status_transition", "The order can not be changed to '"+body.Status+"'")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+	h.writeAPIOrder(w, orderID)
+}
+
+// Responds with an order, its total cost, the statuses it can change to and its status history.
+func (h *Handler) writeAPIOrder(w http.ResponseWriter, orderID uuid.UUID) {
+	order, err := h.Repo.Order.GetOrderWithProducts(orderID)
+	if err == sql.ErrNoRows {
+		writeJSONError(w, http.StatusNotFound, "not_found", "Order not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	history, err := h.Repo.Order.GetOrderStatusHistory(orderID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, "internal_error", err.Error())
+		return
+	}
+
+	if history == nil { history = []models.OrderStatusChange{} }
+
+	data := apiOrder{
+		Order:         *order,
+		Items:         h.apiOrderItems(order.Items),
+		Tax:           order.Tax(),
+		TaxLines:      apiTaxLines(order),
+		TotalCost:     order.Total(),
+		NextStatuses:  repository.NextOrderStatuses(order.OrderStatus),
+		StatusHistory: history,
+	}
+	writeJSON(w, http.StatusOK, data)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/openapi"
+)
+
+/*** Global Variables ***/
+var openAPIDocument []byte // OpenAPI document of the routes (JSON), set by LoadOpenAPI
+
+/*** Constants ***/
+const apiPrefix = "/api/v1/"        // Path prefix of the JSON API routes
+const customerSecurity = "customer" // Security scheme of the routes of logged in customers
+const adminSecurity = "admin"       // Security scheme of the routes of logged in admins
+const htmlTag = "Web pages (HTML)"  // Tag of the routes of the web pages, which are not part of the JSON API
+const openAPIVersion = "1.0.0"      // Version of the JSON API in the document
+
+/*** Structs ***/
+
+// Custom type that describes a route of the JSON API for the OpenAPI document. The request and response are values of
+// the same types the handler decodes and encodes, so their schemas follow the handlers.
+type apiOperation struct {
+	ID       string              // Operation ID (unique)
+	Summary  string
+	Tag      string
+	Query    []openapi.Parameter // Query (and header) parameters
+	Request  any                 // Value of the type of the JSON body, nil for routes without one
+	Response any                 // Value of the type of the "data" of the response, nil for routes that respond 204 No Content
+	Status   int                 // Status code of the successful response
+	List     bool                // Whether the response is a paginated list (with "pagination")
+	Raw      bool                // Whether the response is the value itself instead of {"data": ...}
+	Errors   []int               // Status codes of the errors of the route (besides the common ones)
+	Security string              // Security scheme the route requires, empty for public routes
+}
+
+// Routes of the JSON API by method and path (as registered in the router). LoadOpenAPI fails if a route of the API is
+// missing here or an operation has no route, so the document can not drift from the router.
+var apiOperations = map[string]apiOperation{
+	"GET /api/v1/openapi.json": {
+		ID: "getOpenAPI", Summary: "Get this OpenAPI document", Tag: "Documentation",
+		Response: map[string]any{}, Status: http.StatusOK, Raw: true,
+	},
+	"GET /api/v1/products": {
+		ID: "listProducts", Summary: "List the products", Tag: "Products", Query: paginationParameters,
+		Response: []apiProduct{}, Status: http.StatusOK, List: true,
+	},
+	"GET /api/v1/products/{id}": {
+		ID: "getProduct", Summary: "Get a product with its categories, options, variants and images", Tag: "Products",
+		Response: apiProduct{}, Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"GET /api/v1/cart": {
+		ID: "getCart", Summary: "Get the cart of the session", Tag: "Cart",
+		Response: apiCart{}, Status: http.StatusOK,
+	},
+	"POST /api/v1/cart/items": {
+		ID: "addCartItem", Summary: "Add a product (variant) to the cart, 200 if it was already there", Tag: "Cart",
+		Request: apiAddCartItemRequest{}, Response: apiCart{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	"PATCH /api/v1/cart/items/{product_id}": {
+		ID: "updateCartItem", Summary: "Add, subtract or remove a unit of a product (variant) of the cart", Tag: "Cart",
+		Request: apiUpdateCartItemRequest{}, Response: apiCart{}, Status: http.StatusOK,
+		Errors: []int{http.StatusNotFound, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	"DELETE /api/v1/cart/items/{product_id}": {
+		ID: "removeCartItem", Summary: "Remove a product (variant) from the cart", Tag: "Cart",
+		Query: []openapi.Parameter{{Name: "variant_id", In: "query", Description: "Variant of the product (omitted for products without variants)",
+			Schema: &openapi.Schema{Type: "string", Format: "uuid"}}},
+		Response: apiCart{}, Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound},
+	},
+	"POST /api/v1/checkout": {
+		ID: "checkout", Summary: "Place an order with the cart (for the logged in customer or a guest), 200 with the order if it was already placed", Tag: "Cart",
+		Query: []openapi.Parameter{{Name: "Idempotency-Key", In: "header", Description: "checkout_key of the cart", Required: true,
+			Schema: &openapi.Schema{Type: "string"}}},
+		Request: apiCheckoutRequest{}, Response: apiPlacedOrder{}, Status: http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusConflict, http.StatusUnprocessableEntity},
+	},
+	"POST /api/v1/login": {
+		ID: "login", Summary: "Log a customer in (sets the customer cookie)", Tag: "Authentication",
+		Request: apiLoginRequest{}, Response: models.User{}, Status: http.StatusOK, Errors: []int{http.StatusUnauthorized},
+	},
+	"POST /api/v1/logout": {
+		ID: "logout", Summary: "Log the customer out", Tag: "Authentication", Status: http.StatusNoContent,
+	},
+	"POST /api/v1/admin/login": {
+		ID: "adminLogin", Summary: "Log an admin in (sets the admin cookie)", Tag: "Authentication",
+		Request: apiLoginRequest{}, Response: models.AdminUser{}, Status: http.StatusOK, Errors: []int{http.StatusUnauthorized},
+	},
+	"POST /api/v1/admin/logout": {
+		ID: "adminLogout", Summary: "Log the admin out", Tag: "Authentication", Status: http.StatusNoContent,
+	},
+	"GET /api/v1/orders": {
+		ID: "listOrders", Summary: "List the orders", Tag: "Orders", Query: paginationParameters,
+		Response: []models.Order{}, Status: http.StatusOK, List: true, Security: adminSecurity,
+	},
+	"GET /api/v1/orders/{id}": {
+		ID: "getOrder", Summary: "Get an order with its items and status history", Tag: "Orders",
+		Response: apiOrder{}, Status: http.StatusOK, Errors: []int{http.StatusBadRequest, http.StatusNotFound}, Security: adminSecurity,
+	},
+	"PUT /api/v1/orders/{id}/status": {
+		ID: "updateOrderStatus", Summary: "Change the status of an order (following the order lifecycle)", Tag: "Orders",
+		Request: apiOrderStatusRequest{}, Response: apiOrder{}, Status: http.StatusOK,
+		Errors: []int{http.StatusNotFound, http.StatusUnprocessableEntity}, Security: adminSecurity,
+	},
+}
+
+// Query parameters of the paginated lists.
+var paginationParameters = []openapi.Parameter{
+	{Name: "page", In: "query", Description: "Page number (1 by default)", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+	{Name: "limit", In: "query", Description: "Items per page (10 by default)", Schema: &openapi.Schema{Type: "integer", Format: "int32"}},
+}
+
+/*** Helper Functions ***/
+
+// Returns the OpenAPI document of every route of the router. The routes of the JSON API are described by apiOperations
+// and the routes of the web pages as HTML responses. It returns an error if the router and apiOperations do not match.
+func OpenAPISpec(router *mux.Router) (*openapi.Document, error) {
+	doc := openapi.New("go-htmx-ecommerce", openAPIVersion, "JSON API of the shop (under "+apiPrefix+") and the routes of its "+
+		"web pages. Amounts of money are integers in cents. The cart belongs to the session_id cookie, which is set by the first "+
+		"request, so clients must keep the cookies between requests.")
+	doc.Components.SecuritySchemes[customerSecurity] = &openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: customerCookieName,
+		Description: "Signed cookie set by POST " + apiPrefix + "login"}
+	doc.Components.SecuritySchemes[adminSecurity] = &openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: adminCookieName,
+		Description: "Signed cookie set by POST " + apiPrefix + "admin/login"}
+
+	var errs []error
+	described := map[string]bool{}
+	err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil { return nil } // Routes without a path
+		methods, err := route.GetMethods()
+		if err != nil { return nil } // Path prefixes (e.g. the static files and the subrouters)
+
+		for _, method := range methods {
+			key := method + " " + path
+			if !strings.HasPrefix(path, apiPrefix) {
+				doc.AddOperation(method, path, htmlOperation(method, path))
+				continue
+			}
+			op, ok := apiOperations[key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("openapi: the route %s is not described in apiOperations", key))
+				continue
+			}
+			described[key] = true
+			doc.AddOperation(method, path, op.operation(doc, path))
+		}
+		return nil
+	})
+	if err != nil { return nil, err }
+
+	for key := range apiOperations {
+		if !described[key] { errs = append(errs, fmt.Errorf("openapi: the operation %s has no route", key)) }
+	}
+	if len(errs) > 0 {
+		sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+		return nil, errors.Join(errs...)
+	}
+	return doc, nil
+}
+
+// Returns the OpenAPI operation of a route of the JSON API, with the schemas of its request and responses.
+func (o apiOperation) operation(doc *openapi.Document, path string) *openapi.Operation {
+	op := &openapi.Operation{
+		OperationID: o.ID,
+		Summary:     o.Summary,
+		Tags:        []string{o.Tag},
+		Parameters:  append(pathParameters(path), o.Query...),
+		Responses:   map[string]*openapi.Response{},
+	}
+
+	// Successful response
+	success := &openapi.Response{Description: http.StatusText(o.Status)}
+	switch {
+		case o.Response == nil:
+		case o.Raw:
+			success.Content = jsonContent(&openapi.Schema{Type: "object"})
+		default:
+			schema := &openapi.Schema{Type: "object", Properties: map[string]*openapi.Schema{"data": doc.Schema(o.Response)}, Required: []string{"data"}}
+			if o.List {
+				schema.Properties["pagination"] = doc.Schema(apiPagination{})
+				schema.Required = append(schema.Required, "pagination")
+			}
+			success.Content = jsonContent(schema)
+	}
+	op.Responses[strconv.Itoa(o.Status)] = success
+
+	// Errors of every route, of the routes with a body and of the routes that require a login
+	errorStatuses := append([]int{http.StatusNotAcceptable, http.StatusInternalServerError}, o.Errors...)
+	if o.Request != nil {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: jsonContent(doc.Schema(o.Request))}
+		errorStatuses = append(errorStatuses, http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)
+	}
+	if o.Security != "" {
+		op.Security = []map[string][]string{{o.Security: {}}}
+		errorStatuses = append(errorStatuses, http.StatusUnauthorized, http.StatusForbidden)
+	}
+	errorSchema := doc.Schema(apiErrorResponse{})
+	for _, status := range errorStatuses {
+		op.Responses[strconv.Itoa(status)] = &openapi.Response{Description: http.StatusText(status), Content: jsonContent(errorSchema)}
+	}
+	return op
+}
+
+// Returns the OpenAPI operation of a route of the web pages, which responds with HTML.
+func htmlOperation(method, path string) *openapi.Operation {
+	id := strings.ToLower(method) + strings.NewReplacer("/", "_", "{", "", "}", "", "-", "_", ".", "_").Replace(openapi.PathTemplate(path))
+	return &openapi.Operation{
+		OperationID: id,
+		Summary:     "Web page or htmx fragment",
+		Tags:        []string{htmlTag},
+		Parameters:  pathParameters(path),
+		Responses: map[string]*openapi.Response{
+			"200": {Description: "HTML", Content: map[string]openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}}},
+		},
+	}
+}
+
+// Returns the path parameters of a route (IDs, which are UUIDs).
+func pathParameters(path string) []openapi.Parameter {
+	var parameters []openapi.Parameter
+	for _, name := range openapi.PathParameters(path) {
+		parameters = append(parameters, openapi.Parameter{Name: name, In: "path", Required: true, Schema: &openapi.Schema{Type: "string", Format: "uuid"}})
+	}
+	return parameters
+}
+
+// Returns the content of a JSON body with the schema.
+func jsonContent(schema *openapi.Schema) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{"application/json": {Schema: schema}}
+}
+
+// Builds the OpenAPI document of the routes of the router, which is served by the OpenAPI handler. It must be called
+// once every route is registered, and fails if the JSON API routes and their descriptions (apiOperations) differ.
+func LoadOpenAPI(router *mux.Router) error {
+	doc, err := OpenAPISpec(router)
+	if err != nil { return err }
+	encoded, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil { return err }
+	openAPIDocument = encoded
+	return nil
+}
+
+/*** Handlers ***/
+
+// Serves the OpenAPI document of the routes.
+func (h *Handler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(openAPIDocument)
+}
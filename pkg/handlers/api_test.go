@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+/*** Helper Functions ***/
+
+// Checks that a response is a JSON error envelope ({"error": {...}}) with the status and error code.
+func expectAPIError(t *testing.T, resp *http.Response, body []byte, status int, code string) {
+	t.Helper()
+	if resp.StatusCode != status { t.Errorf("status %d, want %d: %s", resp.StatusCode, status, body) }
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Content-Type %q, want application/json", contentType)
+	}
+
+	var envelope apiErrorResponse
+	decodeStrict(t, body, &envelope)
+	if envelope.Error.Code != code { t.Errorf("error code %q, want %q", envelope.Error.Code, code) }
+	if envelope.Error.Message == "" { t.Error("the error has no message") }
+}
+
+/*** Tests ***/
+
+// Tests that the API refuses the requests that do not accept a JSON response.
+func TestAPINotAcceptable(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(t)
+
+	resp, body := doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products", nil, http.Header{"Accept": {"text/html"}})
+	expectAPIError(t, resp, body, http.StatusNotAcceptable, "not_acceptable")
+
+	// A media type with q=0 is not acceptable either, while a wildcard is
+	resp, body = doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products", nil, http.Header{"Accept": {"application/json;q=0, text/html"}})
+	expectAPIError(t, resp, body, http.StatusNotAcceptable, "not_acceptable")
+	resp, body = doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products", nil, http.Header{"Accept": {"text/html, */*;q=0.1"}})
+	if resp.StatusCode != http.StatusOK { t.Errorf("status %d with a wildcard Accept, want 200: %s", resp.StatusCode, body) }
+}
+
+// Tests that the API refuses the request bodies that are not JSON.
+func TestAPIUnsupportedMediaType(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(t)
+
+	for _, contentType := range []string{"application/x-www-form-urlencoded", "text/plain", ""} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/login", strings.NewReader("email=a@example.com&password=secret"))
+		if err != nil { t.Fatal(err) }
+		req.Header.Set("Accept", "application/json")
+		if contentType != "" { req.Header.Set("Content-Type", contentType) }
+
+		resp, err := client.Do(req)
+		if err != nil { t.Fatal(err) }
+		var envelope apiErrorResponse
+		err = json.NewDecoder(resp.Body).Decode(&envelope)
+		resp.Body.Close()
+		if err != nil { t.Fatalf("Content-Type %q: the response is not JSON: %v", contentType, err) }
+		if resp.StatusCode != http.StatusUnsupportedMediaType || envelope.Error.Code != "unsupported_media_type" {
+			t.Errorf("Content-Type %q: status %d and code %q, want 415 and unsupported_media_type", contentType, resp.StatusCode, envelope.Error.Code)
+		}
+	}
+
+	// JSON with a charset is accepted
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/v1/login", strings.NewReader(`{"email":"nobody@example.com","password":"wrong"}`))
+	if err != nil { t.Fatal(err) }
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil { t.Fatal(err) }
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized { t.Errorf("status %d for a JSON body with a charset, want 401", resp.StatusCode) }
+}
+
+// Tests that the unknown endpoints, the unsupported methods and the missing resources answer with the error envelope.
+func TestAPIErrorEnvelope(t *testing.T) {
+	server, _ := newTestServer(t)
+	client := newTestClient(t)
+
+	resp, body := doJSON(t, client, http.MethodGet, server.URL+"/api/v1/unknown", nil, nil)
+	expectAPIError(t, resp, body, http.StatusNotFound, "not_found")
+
+	resp, body = doJSON(t, client, http.MethodDelete, server.URL+"/api/v1/products", nil, nil)
+	expectAPIError(t, resp, body, http.StatusMethodNotAllowed, "method_not_allowed")
+	if allow := resp.Header.Get("Allow"); allow != "GET" { t.Errorf("Allow %q, want GET", allow) }
+
+	// The admin routes answer 405 before asking for a login
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/orders/00000000-0000-0000-0000-000000000001", nil, nil)
+	expectAPIError(t, resp, body, http.StatusMethodNotAllowed, "method_not_allowed")
+
+	resp, body = doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products/00000000-0000-0000-0000-000000000001", nil, nil)
+	expectAPIError(t, resp, body, http.StatusNotFound, "not_found")
+
+	resp, body = doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products/not-a-uuid", nil, nil)
+	expectAPIError(t, resp, body, http.StatusBadRequest, "invalid_id")
+
+	resp, body = doJSON(t, client, http.MethodGet, server.URL+"/api/v1/orders", nil, nil)
+	expectAPIError(t, resp, body, http.StatusUnauthorized, "unauthorized")
+
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/login", map[string]string{"email": testUserEmail, "unknown": "field"}, nil)
+	expectAPIError(t, resp, body, http.StatusBadRequest, "invalid_json")
+}
+
+// Tests the pagination metadata of the lists.
+func TestAPIPagination(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	for i := 1; i <= 25; i++ {
+		createTestProduct(t, repo, fmt.Sprintf("Product %02d", i), 1000, 5)
+	}
+
+	tests := []struct {
+		query string
+		items int
+		want  apiPagination
+	}{
+		{query: "", items: 10, want: apiPagination{Page: 1, Limit: 10, TotalItems: 25, TotalPages: 3, PreviousPage: 0, NextPage: 2}},
+		{query: "?page=2&limit=10", items: 10, want: apiPagination{Page: 2, Limit: 10, TotalItems: 25, TotalPages: 3, PreviousPage: 1, NextPage: 3}},
+		{query: "?page=3&limit=10", items: 5, want: apiPagination{Page: 3, Limit: 10, TotalItems: 25, TotalPages: 3, PreviousPage: 2, NextPage: 4}},
+		{query: "?page=1&limit=25", items: 25, want: apiPagination{Page: 1, Limit: 25, TotalItems: 25, TotalPages: 1, PreviousPage: 0, NextPage: 2}},
+		{query: "?page=9", items: 0, want: apiPagination{Page: 9, Limit: 10, TotalItems: 25, TotalPages: 3, PreviousPage: 8, NextPage: 10}},
+		{query: "?page=-1&limit=abc", items: 10, want: apiPagination{Page: 1, Limit: 10, TotalItems: 25, TotalPages: 3, PreviousPage: 0, NextPage: 2}},
+	}
+	for _, test := range tests {
+		resp, body := doJSON(t, client, http.MethodGet, server.URL+"/api/v1/products"+test.query, nil, nil)
+		if resp.StatusCode != http.StatusOK { t.Fatalf("%q: status %d: %s", test.query, resp.StatusCode, body) }
+
+		var list struct {
+			Data       []apiProduct  `json:"data"`
+			Pagination apiPagination `json:"pagination"`
+		}
+		decodeStrict(t, body, &list)
+		if len(list.Data) != test.items { t.Errorf("%q: %d products, want %d", test.query, len(list.Data), test.items) }
+		if list.Data == nil { t.Errorf("%q: the data is null, want a list", test.query) }
+		if list.Pagination != test.want { t.Errorf("%q: pagination %+v, want %+v", test.query, list.Pagination, test.want) }
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"net/mail"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Constants ***/
+const customerCookieName = "customer"             // Name of the (signed) cookie that holds the ID of the logged in customer
+const customerSessionMaxAge = 30 * 24 * time.Hour // Time a customer stays logged in
+const minPasswordLength = 8                       // Minimum length of a customer password
+
+/*** Helper Functions ***/
+
+// Returns the ID of the logged in customer, or an empty string for guests.
+func (h *Handler) customerID(r *http.Request) string {
+	userID, ok := h.Sessions.Value(r, customerCookieName)
+	if !ok { return "" }
+	return userID
+}
+
+// Returns the logged in customer, or nil for guests.
+func (h *Handler) currentCustomer(r *http.Request) *models.User {
+	userID, err := uuid.Parse(h.customerID(r))
+	if err != nil { return nil }
+	user, err := h.Repo.User.GetUserByID(userID)
+	if err != nil { return nil }
+	return user
+}
+
+// Sends messages to the customer (for login and registration errors).
+func sendAuthMessage(w http.ResponseWriter, messages []string) {
+	tmpl.ExecuteTemplate(w, "authMessages", messages)
+}
+
+// Redirects the browser, using the HX-Redirect header for htmx requests so the whole page is loaded.
+func redirect(w http.ResponseWriter, r *http.Request, url string) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Redirect", url)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// Logs a customer in with a new session ID (so a session cookie planted before the login is not theirs) and merges the
+// cart of their guest session into their account cart, which becomes the cart of the new session.
+func (h *Handler) logCustomerIn(w http.ResponseWriter, r *http.Request, user *models.User) error {
+	guestSessionID, _ := requestSessionID(r)
+	if err := h.Carts.MergeCarts(guestSessionID, newSessionID(w), user.UserID.String()); err != nil { return err }
+	h.Sessions.SetValue(w, customerCookieName, user.UserID.String(), customerSessionMaxAge)
+	return nil
+}
+
+/*** Handlers ***/
+
+// Renders the customer login and registration page.
+func (h *Handler) LoginView(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Customer *models.User
+	}{
+		Customer: h.currentCustomer(r),
+	}
+	tmpl.ExecuteTemplate(w, "login", data)
+}
+
+// Registers a new customer account and logs the customer in.
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	var responseMessages []string
+
+	//Check for empty and invalid fields
+	fullName := r.FormValue("full_name")
+	email := r.FormValue("email")
+	password := r.FormValue("password")
+
+	if fullName == "" || email == "" || password == "" {
+		responseMessages = append(responseMessages, "All Fields Are Required")
+	}
+	if _, err := mail.ParseAddress(email); email != "" && err != nil {
+		responseMessages = append(responseMessages, "Invalid Email")
+	}
+	if password != "" && len(password) < minPasswordLength {
+		responseMessages = append(responseMessages, "The Password Must Have At Least 8 Characters")
+	}
+	if password != r.FormValue("confirm_password") {
+		responseMessages = append(responseMessages, "The Passwords Do Not Match")
+	}
+	if len(responseMessages) > 0 {
+		sendAuthMessage(w, responseMessages)
+		return
+	}
+
+	user := models.User{FullName: fullName, Email: email}
+	err := h.Repo.User.CreateUser(&user, password)
+	if err == repository.ErrEmailTaken {
+		sendAuthMessage(w, []string{"An Account With This Email Already Exists"})
+		return
+	}
+	if err != nil {
+		sendAuthMessage(w, []string{"Error Creating Account: " + err.Error()})
+		return
+	}
+
+	if err = h.logCustomerIn(w, r, &user); err != nil {
+		sendAuthMessage(w, []string{"Error Loading Your Cart: " + err.Error()})
+		return
+	}
+
+	redirect(w, r, "/")
+}
+
+// Logs a customer in with their email and password.
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	user, err := h.Repo.User.Authenticate(r.FormValue("email"), r.FormValue("password"))
+	if err == repository.ErrInvalidCredentials {
+		sendAuthMessage(w, []string{"Invalid Email or Password"})
+		return
+	}
+	if err != nil {
+		sendAuthMessage(w, []string{"Error Logging In: " + err.Error()})
+		return
+	}
+
+	if err = h.logCustomerIn(w, r, user); err != nil {
+		sendAuthMessage(w, []string{"Error Loading Your Cart: " + err.Error()})
+		return
+	}
+
+	redirect(w, r, "/")
+}
+
+// Logs the customer out. The visitor gets a new (empty) session, the customer cart stays saved in their account.
+func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
+	h.Sessions.Clear(w, customerCookieName)
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	redirect(w, r, "/")
+}
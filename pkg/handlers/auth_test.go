@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+/*** Helper Functions ***/
+
+// Returns the session ID in the session cookie of a client (empty if it has none).
+func clientSessionID(t *testing.T, client *http.Client, serverURL string) string {
+	t.Helper()
+	u, err := url.Parse(serverURL)
+	if err != nil { t.Fatal(err) }
+	for _, cookie := range client.Jar.Cookies(u) {
+		if cookie.Name == sessionCookieName { return cookie.Value }
+	}
+	return ""
+}
+
+/*** Tests ***/
+
+// Tests that logging in gives the customer a new session ID, so a session cookie planted before the login never holds
+// their cart, and that the guest cart moves to the new session.
+func TestLoginRotatesSession(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+	plantedID := clientSessionID(t, client, server.URL)
+	if plantedID == "" { t.Fatal("adding a product did not set a session cookie") }
+
+	resp, body := doForm(t, client, http.MethodPost, server.URL+"/login", url.Values{"email": {testUserEmail}, "password": {testPassword}})
+	if resp.StatusCode != http.StatusOK { t.Fatalf("login: status %d: %s", resp.StatusCode, body) }
+	sessionID := clientSessionID(t, client, server.URL)
+	if sessionID == "" || sessionID == plantedID { t.Fatalf("the session ID %q was kept after the login", plantedID) }
+
+	if _, err := repo.Cart.GetCartBySession(plantedID); err == nil { t.Error("the session from before the login still has a cart") }
+	c, err := repo.Cart.GetCartBySession(sessionID)
+	if err != nil { t.Fatalf("the new session has no cart: %v", err) }
+	if c.UserID == "" || len(c.Items) != 1 { t.Errorf("the cart of the new session has user %q and %d items, want the customer and the laptop", c.UserID, len(c.Items)) }
+}
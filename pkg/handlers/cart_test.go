@@ -0,0 +1,466 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Global Variables ***/
+var confirmedPriceField = regexp.MustCompile(`name="confirmed_price\[([^\]]+)\]" value="([^"]+)"`) // Hidden confirmed price of the checkout form
+
+/*** Helper Functions ***/
+
+// Sends a request of the web pages (with a form body for POST and PUT) and returns the response with its body.
+func doForm(t *testing.T, client *http.Client, method, target string, form url.Values) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if err != nil { t.Fatal(err) }
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil { t.Fatal(err) }
+	return resp, string(body)
+}
+
+// Returns the cart of a visitor (their session cookie is shared by the web pages and the API).
+func getTestCart(t *testing.T, client *http.Client, serverURL string) apiCart {
+	t.Helper()
+	resp, body := doJSON(t, client, http.MethodGet, serverURL+"/api/v1/cart", nil, nil)
+	if resp.StatusCode != http.StatusOK { t.Fatalf("getting the cart: status %d: %s", resp.StatusCode, body) }
+	var c apiCart
+	decodeData(t, body, &c)
+	return c
+}
+
+// Returns the quantity of a product in a cart (0 if it is not there).
+func cartQuantity(c apiCart, productID uuid.UUID) int {
+	for _, item := range c.Items {
+		if item.ProductID == productID { return item.Quantity }
+	}
+	return 0
+}
+
+// Returns the stock of a product in the repository.
+func productStock(t *testing.T, repo *repository.Repository, productID uuid.UUID) int {
+	t.Helper()
+	product, err := repo.Product.GetProductByID(productID)
+	if err != nil { t.Fatal(err) }
+	return product.Stock
+}
+
+// Returns the number of orders in the repository.
+func orderCount(t *testing.T, repo *repository.Repository) int {
+	t.Helper()
+	count, err := repo.Order.GetTotalOrdersCount()
+	if err != nil { t.Fatal(err) }
+	return count
+}
+
+// Returns the checkout form of the cart with the checkout key, shipped to (and billed to) an address in Texas with the
+// standard shipping.
+func checkoutValues(key string) url.Values {
+	return url.Values{
+		"idempotency_key":      {key},
+		"shipping_full_name":   {"Jane Doe"},
+		"shipping_line1":       {"1 Main St"},
+		"shipping_city":        {"Austin"},
+		"shipping_region":      {"TX"},
+		"shipping_postal_code": {"78701"},
+		"shipping_country":     {"US"},
+		"billing_same":         {"on"},
+		"shipping_method":      {"standard"},
+	}
+}
+
+// Returns the body of an API checkout shipped to an address in Texas with the standard shipping.
+func checkoutRequest() apiCheckoutRequest {
+	return apiCheckoutRequest{
+		ShippingAddress: &models.Address{FullName: "Jane Doe", Line1: "1 Main St", City: "Austin", Region: "TX", PostalCode: "78701", Country: "US"},
+		ShippingMethod:  "standard",
+	}
+}
+
+// Returns the hidden confirmed prices of a checkout page by field name.
+func confirmedPrices(page string) map[string]string {
+	prices := map[string]string{}
+	for _, match := range confirmedPriceField.FindAllStringSubmatch(page, -1) {
+		prices["confirmed_price["+match[1]+"]"] = match[2]
+	}
+	return prices
+}
+
+// Changes the price of a product in the repository.
+func setTestPrice(t *testing.T, repo *repository.Repository, product *models.Product, price models.Money) {
+	t.Helper()
+	product.Price = price
+	if _, err := repo.Product.UpdateProduct(product); err != nil { t.Fatal(err) }
+}
+
+/*** Web Pages ***/
+
+// Tests adding products to the cart from the shop: once per product, refusing products out of stock and unknown ones.
+func TestAddToCart(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	soldOut := createTestProduct(t, repo, "Sold Out Camera", 2999, 0)
+
+	resp, body := doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Test Laptop successfully added") {
+		t.Fatalf("adding a product: status %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Test Laptop already exists in cart") {
+		t.Errorf("adding a product twice: status %d: %s", resp.StatusCode, body)
+	}
+	resp, body = doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+soldOut.ProductID.String(), nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Sold Out Camera is out of stock") {
+		t.Errorf("adding a product out of stock: status %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ = doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+uuid.NewString(), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("adding an unknown product: status %d, want 404", resp.StatusCode)
+	}
+	if resp, _ = doForm(t, client, http.MethodPost, server.URL+"/addtocart/not-a-uuid", nil); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("adding an invalid product ID: status %d, want 400", resp.StatusCode)
+	}
+
+	c := getTestCart(t, client, server.URL)
+	if len(c.Items) != 1 || cartQuantity(c, product.ProductID) != 1 { t.Fatalf("cart %+v, want 1 unit of the laptop", c.Items) }
+	if c.Items[0].Product.Price != 1999 || c.TotalCost != 1999 { t.Errorf("price %d and total %d, want 1999", c.Items[0].Product.Price, c.TotalCost) }
+	if c.CheckoutKey == "" { t.Error("the cart has no checkout key") }
+
+	// Another visitor has their own cart
+	if other := getTestCart(t, newTestClient(t), server.URL); len(other.Items) != 0 { t.Errorf("the cart of another visitor has %d items", len(other.Items)) }
+}
+
+// Tests that a session cookie that is not a session ID the server issues (e.g. longer than the session_id column) is
+// replaced by a new session instead of being stored with a cart.
+func TestAddToCartInvalidSessionCookie(t *testing.T) {
+	server, repo := newTestServer(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	serverURL, err := url.Parse(server.URL)
+	if err != nil { t.Fatal(err) }
+
+	for _, value := range []string{strings.Repeat("a", 100), "not-a-uuid", strings.ToUpper(uuid.NewString())} {
+		client := newTestClient(t)
+		client.Jar.SetCookies(serverURL, []*http.Cookie{{Name: sessionCookieName, Value: value}})
+		resp, body := doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+		if resp.StatusCode != http.StatusOK || !strings.Contains(body, "successfully added") { t.Fatalf("session %q: status %d: %s", value, resp.StatusCode, body) }
+
+		var sessionID string
+		for _, cookie := range client.Jar.Cookies(serverURL) {
+			if cookie.Name == sessionCookieName { sessionID = cookie.Value }
+		}
+		if _, err := uuid.Parse(sessionID); err != nil || sessionID == value { t.Errorf("session %q was not replaced: the cookie is %q", value, sessionID) }
+		if _, err := repo.Cart.GetCartBySession(value); err == nil { t.Errorf("a cart was stored for the session %q", value) }
+		if c := getTestCart(t, client, server.URL); cartQuantity(c, product.ProductID) != 1 { t.Errorf("session %q: cart %+v, want the laptop", value, c.Items) }
+	}
+}
+
+// Tests changing the quantity of a product in the cart, up to its stock, and removing it.
+func TestUpdateCartQuantity(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 2)
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+
+	update := func(productID, action string) (*http.Response, string) {
+		query := url.Values{"product_id": {productID}, "action": {action}}
+		return doForm(t, client, http.MethodPut, server.URL+"/updateorderitem?"+query.Encode(), nil)
+	}
+
+	if resp, body := update(product.ProductID.String(), "add"); resp.StatusCode != http.StatusOK { t.Fatalf("add: status %d: %s", resp.StatusCode, body) }
+	if got := cartQuantity(getTestCart(t, client, server.URL), product.ProductID); got != 2 { t.Fatalf("quantity %d after add, want 2", got) }
+
+	resp, body := update(product.ProductID.String(), "add")
+	if resp.StatusCode != http.StatusOK || !strings.Contains(body, "Only 2 of Test Laptop in stock") { t.Errorf("add beyond the stock: status %d: %s", resp.StatusCode, body) }
+	if got := cartQuantity(getTestCart(t, client, server.URL), product.ProductID); got != 2 { t.Errorf("quantity %d after adding beyond the stock, want 2", got) }
+
+	update(product.ProductID.String(), "subtract")
+	c := getTestCart(t, client, server.URL)
+	if got := cartQuantity(c, product.ProductID); got != 1 { t.Errorf("quantity %d after subtract, want 1", got) }
+	if c.TotalCost != 1999 { t.Errorf("total %d after subtract, want 1999", c.TotalCost) }
+
+	if resp, body = update(product.ProductID.String(), "double"); !strings.Contains(body, "Invalid Action") { t.Errorf("invalid action: status %d: %s", resp.StatusCode, body) }
+	if resp, _ = update(uuid.NewString(), "add"); resp.StatusCode != http.StatusNotFound { t.Errorf("updating a product not in the cart: status %d, want 404", resp.StatusCode) }
+	if resp, _ = update("not-a-uuid", "add"); resp.StatusCode != http.StatusBadRequest { t.Errorf("updating an invalid product ID: status %d, want 400", resp.StatusCode) }
+
+	update(product.ProductID.String(), "remove")
+	if c = getTestCart(t, client, server.URL); len(c.Items) != 0 { t.Errorf("the cart has %d items after remove, want 0", len(c.Items)) }
+}
+
+// Tests placing an order from the checkout page: the stock is taken, the cart emptied, and a retry with the same key shows
+// the same order without placing another one.
+func TestWebCheckout(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+	doForm(t, client, http.MethodPut, server.URL+"/updateorderitem?action=add&product_id="+product.ProductID.String(), nil)
+	key := getTestCart(t, client, server.URL).CheckoutKey
+
+	// An invalid form is shown again without placing the order
+	invalid := checkoutValues(key)
+	invalid.Del("shipping_city")
+	if resp, body := doForm(t, client, http.MethodPost, server.URL+"/checkout", invalid); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("checkout without a city: status %d: %s", resp.StatusCode, body)
+	}
+	if orderCount(t, repo) != 0 { t.Fatal("an order was placed with an invalid form") }
+
+	resp, body := doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(key))
+	if resp.StatusCode != http.StatusOK { t.Fatalf("checkout: status %d: %s", resp.StatusCode, body) }
+	if orderCount(t, repo) != 1 { t.Fatalf("%d orders after the checkout, want 1", orderCount(t, repo)) }
+	if got := productStock(t, repo, product.ProductID); got != 3 { t.Errorf("stock %d after ordering 2 of 5, want 3", got) }
+	if c := getTestCart(t, client, server.URL); len(c.Items) != 0 { t.Errorf("the cart has %d items after the checkout, want 0", len(c.Items)) }
+
+	// A retry (e.g. a double click) shows the order again
+	resp, retryBody := doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(key))
+	if resp.StatusCode != http.StatusOK || !strings.Contains(retryBody, "Test Laptop") { t.Errorf("retry: status %d: %s", resp.StatusCode, retryBody) }
+	if orderCount(t, repo) != 1 { t.Errorf("%d orders after the retry, want 1", orderCount(t, repo)) }
+	if got := productStock(t, repo, product.ProductID); got != 3 { t.Errorf("stock %d after the retry, want 3", got) }
+
+	// The empty cart can not be checked out
+	if resp, _ = doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(uuid.NewString())); resp.StatusCode != http.StatusConflict {
+		t.Errorf("checkout of an empty cart: status %d, want 409", resp.StatusCode)
+	}
+}
+
+// Tests that the checkout page refuses an order whose items do not have enough stock anymore, keeping the cart.
+func TestWebCheckoutInsufficientStock(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+product.ProductID.String(), nil)
+	key := getTestCart(t, client, server.URL).CheckoutKey
+
+	product.Stock = 0
+	if _, err := repo.Product.UpdateProduct(&product); err != nil { t.Fatal(err) }
+
+	resp, body := doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(key))
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(body, "do not have enough stock") { t.Fatalf("checkout: status %d: %s", resp.StatusCode, body) }
+	if orderCount(t, repo) != 0 { t.Error("an order was placed without stock") }
+	if c := getTestCart(t, client, server.URL); cartQuantity(c, product.ProductID) != 1 { t.Errorf("cart %+v, want the laptop kept", c.Items) }
+}
+
+// Tests that the checkout page refuses an order whose prices changed until the shopper confirms the new ones: the prices
+// the shopper confirmed are carried by the form (across rounds), and the cart keeps the prices it had.
+func TestWebCheckoutPriceChanged(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	laptop := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	camera := createTestProduct(t, repo, "Test Camera", 2999, 5)
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+laptop.ProductID.String(), nil)
+	doForm(t, client, http.MethodPost, server.URL+"/addtocart/"+camera.ProductID.String(), nil)
+	key := getTestCart(t, client, server.URL).CheckoutKey
+	laptopField := "confirmed_price[" + laptop.ProductID.String() + "/" + uuid.Nil.String() + "]"
+	cameraField := "confirmed_price[" + camera.ProductID.String() + "/" + uuid.Nil.String() + "]"
+
+	setTestPrice(t, repo, &laptop, 2499)
+	resp, page := doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(key))
+	if resp.StatusCode != http.StatusConflict || !strings.Contains(page, "Some Prices Changed") { t.Fatalf("checkout: status %d: %s", resp.StatusCode, page) }
+	if got := confirmedPrices(page); !reflect.DeepEqual(got, map[string]string{laptopField: "24.99"}) { t.Fatalf("confirmed prices %v, want the new price of the laptop", got) }
+
+	// Placing the order again without confirming (e.g. a double click) is refused, and the cart keeps its prices
+	if resp, _ = doForm(t, client, http.MethodPost, server.URL+"/checkout", checkoutValues(key)); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("second checkout without confirming: status %d, want 409", resp.StatusCode)
+	}
+	if orderCount(t, repo) != 0 { t.Fatal("an order was placed at prices the shopper did not confirm") }
+	if c := getTestCart(t, client, server.URL); c.TotalCost != 1999+2999 { t.Errorf("cart total %d, want the prices it had (%d)", c.TotalCost, 1999+2999) }
+
+	// Another price changes before the shopper confirms: the form keeps the confirmed price and adds the new change
+	setTestPrice(t, repo, &camera, 3499)
+	values := checkoutValues(key)
+	for name, value := range confirmedPrices(page) {
+		values.Set(name, value)
+	}
+	resp, page = doForm(t, client, http.MethodPost, server.URL+"/checkout", values)
+	if resp.StatusCode != http.StatusConflict { t.Fatalf("checkout after another change: status %d: %s", resp.StatusCode, page) }
+	if got, want := confirmedPrices(page), map[string]string{laptopField: "24.99", cameraField: "34.99"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("confirmed prices %v, want %v", got, want)
+	}
+	if orderCount(t, repo) != 0 { t.Fatal("an order was placed at prices the shopper did not confirm") }
+
+	// Confirming every new price places the order at them
+	for name, value := range confirmedPrices(page) {
+		values.Set(name, value)
+	}
+	if resp, page = doForm(t, client, http.MethodPost, server.URL+"/checkout", values); resp.StatusCode != http.StatusOK { t.Fatalf("confirmed checkout: status %d: %s", resp.StatusCode, page) }
+	orders, err := repo.Order.ListOrders(10, 0)
+	if err != nil || len(orders) != 1 { t.Fatalf("orders %v (%v), want 1", orders, err) }
+	order, err := repo.Order.GetOrderWithProducts(orders[0].OrderID)
+	if err != nil { t.Fatal(err) }
+	if got := order.Subtotal(); got != 2499+3499 { t.Errorf("order subtotal %d, want the confirmed prices (%d)", got, 2499+3499) }
+}
+
+/*** API ***/
+
+// Tests the cart and the checkout of the API: the statuses of adding and updating the items, and an idempotent checkout.
+func TestAPICartAndCheckout(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 2)
+	itemURL := server.URL + "/api/v1/cart/items/" + product.ProductID.String()
+
+	resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: product.ProductID}, nil)
+	if resp.StatusCode != http.StatusCreated { t.Fatalf("adding a product: status %d: %s", resp.StatusCode, body) }
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: product.ProductID}, nil)
+	if resp.StatusCode != http.StatusOK { t.Errorf("adding a product twice: status %d, want 200: %s", resp.StatusCode, body) }
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: uuid.New()}, nil)
+	expectAPIError(t, resp, body, http.StatusNotFound, "not_found")
+
+	resp, body = doJSON(t, client, http.MethodPatch, itemURL, apiUpdateCartItemRequest{Action: "add"}, nil)
+	if resp.StatusCode != http.StatusOK { t.Fatalf("add: status %d: %s", resp.StatusCode, body) }
+	resp, body = doJSON(t, client, http.MethodPatch, itemURL, apiUpdateCartItemRequest{Action: "add"}, nil)
+	expectAPIError(t, resp, body, http.StatusConflict, "out_of_stock")
+	resp, body = doJSON(t, client, http.MethodPatch, itemURL, apiUpdateCartItemRequest{Action: "double"}, nil)
+	expectAPIError(t, resp, body, http.StatusUnprocessableEntity, "invalid_action")
+	resp, body = doJSON(t, client, http.MethodPatch, server.URL+"/api/v1/cart/items/"+uuid.NewString(), apiUpdateCartItemRequest{Action: "add"}, nil)
+	expectAPIError(t, resp, body, http.StatusNotFound, "not_found")
+
+	c := getTestCart(t, client, server.URL)
+	if cartQuantity(c, product.ProductID) != 2 || c.TotalCost != 3998 { t.Fatalf("cart %+v with total %d, want 2 laptops for 3998", c.Items, c.TotalCost) }
+
+	// The checkout needs the checkout key of the cart
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), nil)
+	expectAPIError(t, resp, body, http.StatusBadRequest, "missing_idempotency_key")
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), http.Header{"Idempotency-Key": {uuid.NewString()}})
+	expectAPIError(t, resp, body, http.StatusConflict, "cart_changed")
+
+	header := http.Header{"Idempotency-Key": {c.CheckoutKey}}
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header)
+	if resp.StatusCode != http.StatusCreated { t.Fatalf("checkout: status %d: %s", resp.StatusCode, body) }
+	var placed apiPlacedOrder
+	decodeData(t, body, &placed)
+	if len(placed.Items) != 1 || placed.Items[0].Quantity != 2 { t.Fatalf("order items %+v, want 2 laptops", placed.Items) }
+	if placed.Items[0].OrderID != placed.OrderID { t.Errorf("the item has the order ID %s, want the one of the order %s", placed.Items[0].OrderID, placed.OrderID) }
+	if got := productStock(t, repo, product.ProductID); got != 0 { t.Errorf("stock %d after ordering 2 of 2, want 0", got) }
+	if c = getTestCart(t, client, server.URL); len(c.Items) != 0 { t.Errorf("the cart has %d items after the checkout, want 0", len(c.Items)) }
+
+	// A retry responds with the same order
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header)
+	if resp.StatusCode != http.StatusOK { t.Fatalf("retry: status %d, want 200: %s", resp.StatusCode, body) }
+	var retried apiPlacedOrder
+	decodeData(t, body, &retried)
+	if !reflect.DeepEqual(retried, placed) { t.Errorf("the retry responded with %+v, want the first response %+v", retried, placed) }
+	if orderCount(t, repo) != 1 { t.Errorf("%d orders after the retry, want 1", orderCount(t, repo)) }
+
+	resp, body = doJSON(t, client, http.MethodDelete, itemURL, nil, nil)
+	expectAPIError(t, resp, body, http.StatusNotFound, "not_found")
+}
+
+// Tests that a retried checkout only shows the order to the shopper that placed it: another visitor replaying the key of
+// the checkout (e.g. an old cart ID) gets the "cart changed" error of the web page and the API, not the order and its
+// addresses.
+func TestCheckoutReplayByAnotherShopper(t *testing.T) {
+	server, repo := newTestServer(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+
+	// A guest order and an order of a logged in customer
+	guest, customer := newTestClient(t), newTestClient(t)
+	resp, body := doJSON(t, customer, http.MethodPost, server.URL+"/api/v1/login", apiLoginRequest{Email: testUserEmail, Password: testPassword}, nil)
+	if resp.StatusCode != http.StatusOK { t.Fatalf("login: status %d: %s", resp.StatusCode, body) }
+	for _, client := range []*http.Client{guest, customer} {
+		doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: product.ProductID}, nil)
+		key := getTestCart(t, client, server.URL).CheckoutKey
+		header := http.Header{"Idempotency-Key": {key}}
+		resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header)
+		if resp.StatusCode != http.StatusCreated { t.Fatalf("checkout: status %d: %s", resp.StatusCode, body) }
+		var placed apiPlacedOrder
+		decodeData(t, body, &placed)
+
+		// The shopper that placed it gets it again
+		if resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header); resp.StatusCode != http.StatusOK {
+			t.Errorf("retry by the shopper: status %d, want 200: %s", resp.StatusCode, body)
+		}
+
+		// Another visitor does not
+		other := newTestClient(t)
+		resp, body = doJSON(t, other, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header)
+		expectAPIError(t, resp, body, http.StatusConflict, "cart_changed")
+		if strings.Contains(string(body), placed.OrderID.String()) { t.Errorf("the API showed the order to another visitor: %s", body) }
+		resp, page := doForm(t, other, http.MethodPost, server.URL+"/checkout", checkoutValues(key))
+		if resp.StatusCode != http.StatusConflict || !strings.Contains(page, "Your cart changed") { t.Errorf("replay on the web page: status %d: %s", resp.StatusCode, page) }
+		if strings.Contains(page, placed.OrderID.String()) { t.Errorf("the web page showed the order to another visitor: %s", page) }
+	}
+	if orderCount(t, repo) != 2 { t.Errorf("%d orders, want 2", orderCount(t, repo)) }
+}
+
+// Tests that the API checkout stores the region of the addresses by its code, whether it is written with its name or its
+// code, and refuses the regions that are not one of the country.
+func TestAPICheckoutRegion(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: product.ProductID}, nil)
+	header := http.Header{"Idempotency-Key": {getTestCart(t, client, server.URL).CheckoutKey}}
+
+	for _, region := range []string{"Texs", "Ontario", ""} {
+		request := checkoutRequest()
+		request.ShippingAddress.Region = region
+		resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", request, header)
+		expectAPIError(t, resp, body, http.StatusUnprocessableEntity, "invalid_address")
+	}
+	if orderCount(t, repo) != 0 { t.Fatal("an order was placed with an invalid region") }
+
+	request := checkoutRequest()
+	request.ShippingAddress.Region = " texas "
+	request.BillingAddress = &models.Address{FullName: "Jane Doe", Line1: "1 Main St", City: "Toronto", Region: "CA-ON", PostalCode: "M5V 2T6", Country: "CA"}
+	resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", request, header)
+	if resp.StatusCode != http.StatusCreated { t.Fatalf("checkout: status %d: %s", resp.StatusCode, body) }
+	var placed apiPlacedOrder
+	decodeData(t, body, &placed)
+	if placed.ShippingAddress.Region != "TX" || placed.BillingAddress.Region != "ON" {
+		t.Errorf("regions %q and %q, want TX and ON", placed.ShippingAddress.Region, placed.BillingAddress.Region)
+	}
+}
+
+// Tests that the API refuses a checkout whose prices changed until the client confirms the new ones in confirmed_prices.
+func TestAPICheckoutPriceChanged(t *testing.T) {
+	server, repo := newTestServer(t)
+	client := newTestClient(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 5)
+	doJSON(t, client, http.MethodPost, server.URL+"/api/v1/cart/items", apiAddCartItemRequest{ProductID: product.ProductID}, nil)
+	header := http.Header{"Idempotency-Key": {getTestCart(t, client, server.URL).CheckoutKey}}
+
+	setTestPrice(t, repo, &product, 2499)
+	for i := 0; i < 2; i++ {
+		resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", checkoutRequest(), header)
+		expectAPIError(t, resp, body, http.StatusConflict, "price_changed")
+		var envelope struct {
+			Error struct {
+				Details []repository.PriceChange `json:"details"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil { t.Fatal(err) }
+		if changes := envelope.Error.Details; len(changes) != 1 || changes[0].OldPrice != 1999 || changes[0].NewPrice != 2499 {
+			t.Fatalf("changes %+v, want the laptop from 1999 to 2499", changes)
+		}
+	}
+	if orderCount(t, repo) != 0 { t.Fatal("an order was placed at prices the client did not confirm") }
+
+	// A confirmed price that is not the current one is refused too
+	request := checkoutRequest()
+	request.ConfirmedPrices = []apiConfirmedPrice{{ProductID: product.ProductID, Price: 1000}}
+	resp, body := doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", request, header)
+	expectAPIError(t, resp, body, http.StatusConflict, "price_changed")
+
+	request.ConfirmedPrices[0].Price = 2499
+	resp, body = doJSON(t, client, http.MethodPost, server.URL+"/api/v1/checkout", request, header)
+	if resp.StatusCode != http.StatusCreated { t.Fatalf("confirmed checkout: status %d: %s", resp.StatusCode, body) }
+	var placed apiPlacedOrder
+	decodeData(t, body, &placed)
+	if len(placed.Items) != 1 || placed.Items[0].Cost != 2499 { t.Errorf("order items %+v, want the laptop at 2499", placed.Items) }
+}
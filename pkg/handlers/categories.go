@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Errors ***/
+var errInvalidCategory = errors.New("invalid category") // Returned when a category ID sent by the browser is not valid
+
+/*** Structs ***/
+
+// Custom type that represents a category in a form (a select option or a checkbox) and whether it is selected.
+type categoryOption struct {
+	models.Category
+	Selected bool
+}
+
+/*** Helper Functions ***/
+
+// Returns the categories as form options, selecting the ones with the IDs.
+func categoryOptions(categories []models.Category, selected ...uuid.UUID) []categoryOption {
+	options := make([]categoryOption, len(categories))
+	for i, c := range categories {
+		options[i] = categoryOption{Category: c}
+		for _, id := range selected {
+			if c.CategoryID == id { options[i].Selected = true }
+		}
+	}
+	return options
+}
+
+// Returns the categories a category can be moved under (every category except itself and its subcategories).
+func parentCandidates(categories []models.Category, categoryID uuid.UUID) []models.Category {
+	excluded := map[uuid.UUID]bool{}
+	for _, id := range models.CategoryDescendants(categories, categoryID) {
+		excluded[id] = true
+	}
+
+	var candidates []models.Category
+	for _, c := range categories {
+		if !excluded[c.CategoryID] { candidates = append(candidates, c) }
+	}
+	return candidates
+}
+
+// Parses an optional category ID of a form (an empty value is a NULL ID).
+func parseOptionalCategoryID(value string) (uuid.NullUUID, error) {
+	if value == "" { return uuid.NullUUID{}, nil }
+	id, err := uuid.Parse(value)
+	if err != nil { return uuid.NullUUID{}, errInvalidCategory }
+	return uuid.NullUUID{UUID: id, Valid: true}, nil
+}
+
+// Parses the category IDs of the checkboxes of a product form.
+func parseCategoryIDs(values []string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	for _, value := range values {
+		id, err := uuid.Parse(value)
+		if err != nil { return nil, errInvalidCategory }
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Returns the filter of the storefront products: the products with an image, in the category of the "category" query
+// parameter or one of its subcategories (every category if it is empty).
+func (h *Handler) storefrontFilter(r *http.Request) (repository.ProductFilter, error) {
+	hasImage := true
+	filter := repository.ProductFilter{HasImage: &hasImage}
+
+	categoryID, err := parseOptionalCategoryID(r.URL.Query().Get("category"))
+	if err != nil || !categoryID.Valid { return filter, err }
+
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil { return filter, err }
+	filter.CategoryIDs = models.CategoryDescendants(categories, categoryID.UUID)
+	return filter, nil
+}
+
+// Sends messages to the admin (for errors), or the updated category list if there are none.
+func (h *Handler) sendCategoryMessage(w http.ResponseWriter, messages []string) {
+	data := struct {
+		Messages   []string
+		Categories []models.Category
+	}{
+		Messages: messages,
+	}
+	if len(messages) == 0 {
+		categories, err := h.Repo.Category.ListCategories()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data.Categories = categories
+	}
+	tmpl.ExecuteTemplate(w, "categoryMessages", data)
+}
+
+// Reads and checks the fields of the category form. It returns the messages of the invalid fields.
+func readCategoryForm(r *http.Request, category *models.Category) []string {
+	var responseMessages []string
+
+	category.Name = strings.TrimSpace(r.FormValue("name"))
+	category.Description = strings.TrimSpace(r.FormValue("description"))
+	if category.Name == "" { responseMessages = append(responseMessages, "The Name Is Required") }
+
+	parentID, err := parseOptionalCategoryID(r.FormValue("parent_id"))
+	if err != nil { responseMessages = append(responseMessages, "Invalid Parent Category") }
+	category.ParentID = parentID
+
+	return responseMessages
+}
+
+/*** Handlers ***/
+
+// Renders the manage categories page.
+func (h *Handler) CategoriesPage(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Admin      *models.AdminUser
+		Categories []models.Category
+	}{
+		Admin:      currentAdmin(r),
+		Categories: categories,
+	}
+	tmpl.ExecuteTemplate(w, "categories", data)
+}
+
+// Renders the all categories view (table).
+func (h *Handler) AllCategoriesView(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Categories []models.Category
+	}{
+		Categories: categories,
+	}
+	tmpl.ExecuteTemplate(w, "allCategories", data)
+}
+
+// Renders the create category page.
+func (h *Handler) CreateCategoryView(w http.ResponseWriter, r *http.Request) {
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Parents []categoryOption
+	}{
+		Parents: categoryOptions(categories),
+	}
+	tmpl.ExecuteTemplate(w, "createCategory", data)
+}
+
+// Creates a new category in the database.
+func (h *Handler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if responseMessages := readCategoryForm(r, &category); len(responseMessages) > 0 {
+		h.sendCategoryMessage(w, responseMessages)
+		return
+	}
+
+	err := h.Repo.Category.CreateCategory(&category)
+	if err == sql.ErrNoRows {
+		h.sendCategoryMessage(w, []string{"The Parent Category Does Not Exist"})
+		return
+	}
+	if err != nil {
+		h.sendCategoryMessage(w, []string{"Error Creating Category: " + err.Error()})
+		return
+	}
+
+	h.sendCategoryMessage(w, nil)
+}
+
+// Renders the edit category page, which also has the form to delete the category.
+func (h *Handler) EditCategoryView(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category, err := h.Repo.Category.GetCategoryByID(categoryID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Category not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	subcategories := 0
+	for _, c := range categories {
+		if c.ParentID.Valid && c.ParentID.UUID == categoryID { subcategories++ }
+	}
+
+	// The products and subcategories of a deleted category are moved to its parent by default
+	candidates := parentCandidates(categories, categoryID)
+	data := struct {
+		Category      *models.Category
+		Subcategories int
+		Parents       []categoryOption
+	}{
+		Category:      category,
+		Subcategories: subcategories,
+		Parents:       categoryOptions(candidates, category.ParentID.UUID),
+	}
+	tmpl.ExecuteTemplate(w, "editCategory", data)
+}
+
+// Updates a category in the database.
+func (h *Handler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	category := models.Category{CategoryID: categoryID}
+	if responseMessages := readCategoryForm(r, &category); len(responseMessages) > 0 {
+		h.sendCategoryMessage(w, responseMessages)
+		return
+	}
+
+	err = h.Repo.Category.UpdateCategory(&category)
+	if err == repository.ErrCategoryCycle {
+		h.sendCategoryMessage(w, []string{"A Category Can Not Be Moved Into Itself Or One Of Its Subcategories"})
+		return
+	}
+	if err == sql.ErrNoRows {
+		h.sendCategoryMessage(w, []string{"The Parent Category Does Not Exist"})
+		return
+	}
+	if err != nil {
+		h.sendCategoryMessage(w, []string{"Error Updating Category: " + err.Error()})
+		return
+	}
+
+	h.sendCategoryMessage(w, nil)
+}
+
+// Deletes a category from the database. If it still has products or subcategories they are moved to the category
+// selected in the form (move_to), a category with contents is never deleted without choosing one.
+func (h *Handler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid category ID", http.StatusBadRequest)
+		return
+	}
+
+	moveTo, err := parseOptionalCategoryID(r.FormValue("move_to"))
+	if err != nil {
+		h.sendCategoryMessage(w, []string{"Invalid Category To Move The Products To"})
+		return
+	}
+
+	err = h.Repo.Category.DeleteCategory(categoryID, moveTo)
+	var inUseErr *repository.CategoryInUseError
+	if errors.As(err, &inUseErr) {
+		h.sendCategoryMessage(w, []string{fmt.Sprintf("This Category Has %d Products And %d Subcategories, Choose The Category To Move Them To",
+			inUseErr.Products, inUseErr.Subcategories)})
+		return
+	}
+	if err == repository.ErrCategoryCycle {
+		h.sendCategoryMessage(w, []string{"The Products Can Not Be Moved To One Of The Subcategories Of The Deleted Category"})
+		return
+	}
+	if err == sql.ErrNoRows {
+		h.sendCategoryMessage(w, []string{"The Category Does Not Exist"})
+		return
+	}
+	if err != nil {
+		h.sendCategoryMessage(w, []string{"Error Deleting Category: " + err.Error()})
+		return
+	}
+
+	h.sendCategoryMessage(w, nil)
+}
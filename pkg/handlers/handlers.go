@@ -1,14 +1,18 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
+	"log"
 	"math"
 	"math/rand"
+	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,14 +20,23 @@ import (
 	"github.com/bxcodec/faker/v4"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/cart"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/config"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/images"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/session"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/shipping"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/storage"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/tax"
 )
 
 /*** Global Variables ***/
 var tmpl *template.Template // Template variable
-var currentCartOrderId uuid.UUID // Shopping cart order ID which is reused for the current session
-var cartItems []models.OrderItem // Shopping cart items
+
+/*** Constants ***/
+const sessionCookieName = "session_id" // Name of the cookie that identifies the visitor (and their cart)
+const searchResultsLimit = 48          // Maximum number of products returned by a storefront search
 
 /*** Structs ***/
 
@@ -33,29 +46,212 @@ type ProductCRUDTemplateData struct {
 	Product  *models.Product
 }
 
-// Custom type that contains a pointer to the Repositories.
+// Custom type that contains the products of the storefront and the search terms to highlight in them.
+type ShoppingItemsTemplateData struct {
+	Products []models.Product
+	Terms    []string
+}
+
+// Custom type that contains the weight (grams) and dimensions (centimetres) of a product sent in the product form.
+type productMeasures struct {
+	Weight int
+	Length int
+	Width  int
+	Height int
+}
+
+// Custom type (error) returned when an uploaded file can not be saved, with the name the file had on the admin's computer.
+type uploadError struct {
+	Filename string
+	Err      error
+}
+
+func (e *uploadError) Error() string { return e.Filename + ": " + e.Err.Error() }
+func (e *uploadError) Unwrap() error { return e.Err }
+
+// Custom type that contains a pointer to the Repositories, the visitors shopping carts, the signed cookies manager, the
+// storage of the uploaded images and the settings.
 type Handler struct {
-	Repo *repository.Repository
+	Repo     *repository.Repository
+	Carts    *cart.Store
+	Sessions *session.Manager
+	Storage  storage.Storage
+	Config   *config.Config
 }
 
-// Initializes the templates.
-func init() {
-	templatesDir := "./templates"
+// Loads (parses) the templates of the template directory, which show the uploaded images from the storage. It must be
+// called before the handlers are used.
+func LoadTemplates(templatesDir string, store storage.Storage) error {
 	pattern := filepath.Join(templatesDir, "**", "*.html")
-	tmpl = template.Must(template.ParseGlob(pattern))
+	parsed, err := template.New("").Funcs(template.FuncMap{
+		"highlight":   highlight,
+		"indent":      indent,
+		"imageURL":    func(filename, size string) string { return imageURL(store, filename, size) },
+		"imageSrcset": func(filename string) string { return imageSrcset(store, filename) },
+	}).ParseGlob(pattern)
+	if err != nil { return err }
+	tmpl = parsed
+	return nil
 }
 
 /*** Helper Functions	***/
 
+// Returns the text (HTML escaped) with the occurrences of the search terms wrapped in <mark> tags.
+func highlight(text string, terms []string) template.HTML {
+	if len(terms) == 0 { return template.HTML(template.HTMLEscapeString(text)) }
+
+	// Longer terms first, so a term that contains another one is marked whole
+	patterns := make([]string, len(terms))
+	for i, term := range terms {
+		patterns[i] = regexp.QuoteMeta(term)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return len(patterns[i]) > len(patterns[j]) })
+	re := regexp.MustCompile("(?i)" + strings.Join(patterns, "|"))
+
+	var b strings.Builder
+	last := 0
+	for _, match := range re.FindAllStringIndex(text, -1) {
+		b.WriteString(template.HTMLEscapeString(text[last:match[0]]))
+		b.WriteString("<mark>" + template.HTMLEscapeString(text[match[0]:match[1]]) + "</mark>")
+		last = match[1]
+	}
+	b.WriteString(template.HTMLEscapeString(text[last:]))
+	return template.HTML(b.String())
+}
+
+// Returns the prefix that indents the name of a category by its depth in the category tree.
+func indent(depth int) string {
+	return strings.Repeat("— ", depth)
+}
+
 // Sends messages to the user (for error or status).
 func sendProductMessage(w http.ResponseWriter, messages []string, product *models.Product) {
 	data := ProductCRUDTemplateData{Messages: messages, Product: product}
 	tmpl.ExecuteTemplate(w, "messages", data)
 }
 
-// Returns a new Handler with a pointer to the Repository.
-func NewHandler(repo *repository.Repository) *Handler {
-	return &Handler{Repo: repo}
+// Returns a new Handler with a pointer to the Repository, the cart store, the signed cookies manager, the storage of the
+// uploaded images and the settings.
+func NewHandler(repo *repository.Repository, carts *cart.Store, sessions *session.Manager, store storage.Storage, cfg *config.Config) *Handler {
+	return &Handler{Repo: repo, Carts: carts, Sessions: sessions, Storage: store, Config: cfg}
+}
+
+// Returns the session ID of the visitor, setting a new session cookie if the request does not have one or its value is
+// not a session ID this server issues (a UUID), so it always fits the session_id column of the carts.
+func getSessionID(w http.ResponseWriter, r *http.Request) string {
+	if sessionID, ok := requestSessionID(r); ok { return sessionID }
+	return newSessionID(w)
+}
+
+// Returns the session ID of the session cookie of the request, or false if it has none or its value is not a UUID in
+// the form getSessionID issues.
+func requestSessionID(r *http.Request) (string, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil { return "", false }
+	id, err := uuid.Parse(cookie.Value)
+	if err != nil || id.String() != cookie.Value { return "", false }
+	return cookie.Value, true
+}
+
+// Sets a session cookie with a new session ID and returns the ID.
+func newSessionID(w http.ResponseWriter) string {
+	sessionID := uuid.New().String()
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    sessionID,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return sessionID
+}
+
+// Deletes a product that could not be created completely (e.g. its images could not be saved) and its uploaded images.
+func (h *Handler) discardProduct(productID uuid.UUID, filenames []string) {
+	if err := h.Repo.Product.DeleteProduct(productID); err != nil { log.Printf("Error deleting the product %s: %v", productID, err) }
+	h.removeUploads(filenames...)
+}
+
+// Saves uploaded images in the upload directory (see saveUpload) and returns their names in the same order. If one
+// image can not be saved, the ones already saved are removed and it returns an *uploadError.
+func (h *Handler) saveUploads(files []*multipart.FileHeader) ([]string, error) {
+	var filenames []string
+	for _, fileHeader := range files {
+		filename, err := h.saveUpload(fileHeader)
+		if err != nil {
+			h.removeUploads(filenames...)
+			return nil, &uploadError{Filename: fileHeader.Filename, Err: err}
+		}
+		filenames = append(filenames, filename)
+	}
+	return filenames, nil
+}
+
+// Processes an uploaded image and saves it in the storage in every size with a unique name (to prevent overwriting and
+// conflicts). It returns the name of the full size, which is the one stored in the database.
+func (h *Handler) saveUpload(fileHeader *multipart.FileHeader) (string, error) {
+	file, err := fileHeader.Open()
+	if err != nil { return "", err }
+	defer file.Close()
+
+	processed, err := images.Process(file)
+	if err != nil { return "", err }
+
+	id := uuid.New().String()
+	var saved []string
+	for _, size := range images.Sizes {
+		name := images.FileName(id, size.Name, processed.Ext)
+		if err = h.Storage.Save(name, processed.Files[size.Name]); err != nil {
+			for _, savedName := range saved {
+				h.Storage.Delete(savedName)
+			}
+			return "", err
+		}
+		saved = append(saved, name)
+	}
+	return saved[len(saved)-1], nil
+}
+
+// Removes images (by the name stored in the database) from the storage with all their sizes, skipping empty names. The
+// errors are only logged, the images are no longer referenced when they are removed.
+func (h *Handler) removeUploads(filenames ...string) {
+	for _, filename := range filenames {
+		if filename == "" { continue }
+		for _, name := range images.FileNames(filename) {
+			if err := h.Storage.Delete(name); err != nil { log.Printf("Error removing the upload %s: %v", name, err) }
+		}
+	}
+}
+
+// Returns the message shown to the admin for an error saving an upload.
+func uploadErrorMessage(err error) string {
+	var uploadErr *uploadError
+	if !errors.As(err, &uploadErr) { return "Error saving the file" }
+
+	switch {
+		case errors.Is(err, images.ErrNotImage):
+			return uploadErr.Filename + " Is Not A JPEG, PNG, GIF Or WebP Image"
+		case errors.Is(err, images.ErrTooManyPixels):
+			return fmt.Sprintf("%s Is Too Big (Max %d Megapixels)", uploadErr.Filename, images.MaxPixels/1_000_000)
+		default:
+			return "Error saving the file " + uploadErr.Filename
+	}
+}
+
+// Returns the URL (generated by the storage) of a size (e.g. "card") of an uploaded image.
+func imageURL(store storage.Storage, filename, size string) string {
+	return store.URL(images.SizeFileName(filename, size))
+}
+
+// Returns the srcset attribute (every size with its width) of an uploaded image, empty for images saved in one size.
+func imageSrcset(store storage.Storage, filename string) string {
+	if !images.HasSizes(filename) { return "" }
+
+	candidates := make([]string, len(images.Sizes))
+	for i, size := range images.Sizes {
+		candidates[i] = fmt.Sprintf("%s %dw", imageURL(store, filename, size.Name), size.Width)
+	}
+	return strings.Join(candidates, ", ")
 }
 
 // Subtracts two integers.
@@ -67,13 +263,37 @@ func makeRange(min, max int) []int {
 	return rangeArray
 }
 
+// Parses the weight and dimensions of the product form. Empty fields are 0 (unknown) and the others must be whole numbers
+// of at least 0.
+func parseProductMeasures(r *http.Request) (productMeasures, error) {
+	var m productMeasures
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{{"weight", &m.Weight}, {"length", &m.Length}, {"width", &m.Width}, {"height", &m.Height}} {
+		value := strings.TrimSpace(r.FormValue(field.name))
+		if value == "" { continue }
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 { return m, fmt.Errorf("invalid %s %q", field.name, value) }
+		*field.value = n
+	}
+	return m, nil
+}
+
+// Parses the tax class of the product form (standard if it is empty) and returns false if it is not a tax class.
+func parseTaxClass(r *http.Request) (string, bool) {
+	class := r.FormValue("tax_class")
+	if class == "" { return tax.ClassStandard, true }
+	return class, tax.IsClass(class)
+}
+
 // Calculates the total cost of the items in the cart.
-func getTotalCartCost() float64 {
-	totalCost := 0.0
+func getTotalCartCost(cartItems []models.OrderItem) models.Money {
+	var totalCost models.Money
 	for _, item := range cartItems {
-		totalCost += float64(item.Quantity) * item.Product.Price
+		totalCost += item.Product.Price.Times(item.Quantity)
 	}
-	return math.Round(totalCost * 100) / 100 // Round to 2 decimal places
+	return totalCost
 }
 
 /*** Handlers ***/
@@ -96,7 +316,13 @@ func (h *Handler) SeedProducts(w http.ResponseWriter, r *http.Request) {
 
 		product := models.Product{
 			ProductName:  productName,
-			Price:        float64(rand.Intn(100000)) / 100, // Random price between 0.00 and 999.99
+			Price:        models.Money(rand.Intn(100000)), // Random price between 0.00 and 999.99
+			TaxClass:     tax.ClassStandard,
+			Stock:        rand.Intn(51),                   // Random stock between 0 and 50
+			Weight:       100 + rand.Intn(5000),           // Random weight between 0.1 and 5.1 kg
+			Length:       5 + rand.Intn(60),               // Random dimensions between 5 and 64 cm
+			Width:        5 + rand.Intn(40),
+			Height:       2 + rand.Intn(30),
 			Description:  faker.Sentence(),
 			ProductImage: faker.Word() + ".jpg",
 		}
@@ -106,6 +332,10 @@ func (h *Handler) SeedProducts(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf("Error creating product %s: %v", product.ProductName, err), http.StatusInternalServerError)
 			return
 		}
+		if err = h.Repo.Image.AddImages(product.ProductID, []string{product.ProductImage}); err != nil {
+			http.Error(w, fmt.Sprintf("Error adding the image of product %s: %v", product.ProductName, err), http.StatusInternalServerError)
+			return
+		}
 	}
 
 	w.WriteHeader(http.StatusCreated)
@@ -114,7 +344,12 @@ func (h *Handler) SeedProducts(w http.ResponseWriter, r *http.Request) {
 
 // Renders the products page.
 func (h *Handler) ProductsPage(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "products", nil)
+	data := struct {
+		Admin *models.AdminUser
+	}{
+		Admin: currentAdmin(r),
+	}
+	tmpl.ExecuteTemplate(w, "products", data)
 }
 
 // Renders the all products view (table).
@@ -161,6 +396,7 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
 		PreviousPage     int
 		NextPage         int
 		PageButtonsRange []int
+		Admin            *models.AdminUser
 	}{
 		Products:         products,
 		CurrentPage:      page,
@@ -169,6 +405,7 @@ func (h *Handler) ListProducts(w http.ResponseWriter, r *http.Request) {
 		PreviousPage:     previousPage,
 		NextPage:         nextPage,
 		PageButtonsRange: pageButtonsRange,
+		Admin:            currentAdmin(r),
 	}
 
 	/*
@@ -213,84 +450,115 @@ func (h *Handler) GetProduct(w http.ResponseWriter, r *http.Request) {
 
 // Renders the create product page.
 func (h *Handler) CreateProductView(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "createProduct", nil)
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Categories []categoryOption
+		TaxClasses []string
+	}{
+		Categories: categoryOptions(categories),
+		TaxClasses: tax.Classes(),
+	}
+	tmpl.ExecuteTemplate(w, "createProduct", data)
 }
 
 // Creates a new product in the database.
 func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 
-	// Parse the multipart form, 10 MB max upload size
-	r.ParseMultipartForm(10 << 20)
-
 	// Initialize error messages slice
 	var responseMessages []string
 
+	// Parse the multipart form, rejecting uploads bigger than the max upload size
+	r.Body = http.MaxBytesReader(w, r.Body, h.Config.MaxUploadSize)
+	if err := r.ParseMultipartForm(h.Config.MaxUploadSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			responseMessages = append(responseMessages, fmt.Sprintf("The Upload Is Too Big (Max %d MB)", h.Config.MaxUploadSize>>20))
+		} else {
+			responseMessages = append(responseMessages, "Error reading the form")
+		}
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
 	//Check for empty fields
 	ProductName := r.FormValue("product_name")
 	ProductPrice := r.FormValue("price")
 	ProductDescription := r.FormValue("description")
+	ProductStock := r.FormValue("stock")
 
-	if ProductName == "" || ProductPrice == "" || ProductDescription == "" {
+	if ProductName == "" || ProductPrice == "" || ProductDescription == "" || ProductStock == "" {
 		responseMessages = append(responseMessages, "All Fields Are Required")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
-	/* Process File Upload */
+	stock, err := strconv.Atoi(ProductStock)
+	if err != nil || stock < 0 {
+		responseMessages = append(responseMessages, "Invalid Stock")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
 
-	// Retrieve the file from form data
-	file, handler, err := r.FormFile("product_image")
+	categoryIDs, err := parseCategoryIDs(r.Form["category_ids"])
 	if err != nil {
-		if err == http.ErrMissingFile {
-			responseMessages = append(responseMessages, "Select an Image for the Product")
-		} else {
-			responseMessages = append(responseMessages, "Error retrieving the file")
-		}
+		responseMessages = append(responseMessages, "Invalid Category")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
 
-		if len(responseMessages) > 0 {
-			fmt.Println(responseMessages)
-			sendProductMessage(w, responseMessages, nil)
-			return
-		}
+	price, err := models.ParseMoney(ProductPrice)
+	if err != nil || price < 0 {
+		responseMessages = append(responseMessages, "Invalid price")
+		sendProductMessage(w, responseMessages, nil)
+		return
 	}
-	defer file.Close()
 
-	// Generate a unique filename to prevent overwriting and conflicts
-	uuid, err := uuid.NewRandom()
+	measures, err := parseProductMeasures(r)
 	if err != nil {
-		responseMessages = append(responseMessages, "Error generating unique identifier")
+		responseMessages = append(responseMessages, "Invalid Weight Or Dimensions")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
-	filename := uuid.String() + filepath.Ext(handler.Filename) // Append the file extension
-
-	// Create the full path for saving the file
-	filePath := filepath.Join("static/uploads", filename)
 
-	// Save the file to the server
-	dst, err := os.Create(filePath)
-	if err != nil {
-		responseMessages = append(responseMessages, "Error saving the file")
+	taxClass, ok := parseTaxClass(r)
+	if !ok {
+		responseMessages = append(responseMessages, "Invalid Tax Class")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
-	defer dst.Close()
-	if _, err = io.Copy(dst, file); err != nil {
-		responseMessages = append(responseMessages, "Error saving the file")
+
+	/* Process File Uploads */
+
+	// Retrieve the files from form data (the first one is the primary image)
+	files := r.MultipartForm.File["product_image"]
+	if len(files) == 0 {
+		responseMessages = append(responseMessages, "Select an Image for the Product")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
-	price, err := strconv.ParseFloat(r.FormValue("price"), 64)
+	filenames, err := h.saveUploads(files)
 	if err != nil {
-		responseMessages = append(responseMessages, "Invalid price")
+		responseMessages = append(responseMessages, uploadErrorMessage(err))
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
+	filename := filenames[0]
 
 	product := models.Product{
 		ProductName:  ProductName,
 		Price:        price,
+		TaxClass:     taxClass,
+		Stock:        stock,
+		Weight:       measures.Weight,
+		Length:       measures.Length,
+		Width:        measures.Width,
+		Height:       measures.Height,
 		Description:  ProductDescription,
 		ProductImage: filename,
 	}
@@ -298,15 +566,35 @@ func (h *Handler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 	err = h.Repo.Product.CreateProduct(&product)
 	if err != nil {
 		//http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.removeUploads(filenames...)
 		responseMessages = append(responseMessages, "Invalid price" + err.Error())
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
+	// The product is deleted with its uploads if its images or categories can not be saved, so the admin can create it again
+	if err = h.Repo.Image.AddImages(product.ProductID, filenames); err != nil {
+		h.discardProduct(product.ProductID, filenames)
+		responseMessages = append(responseMessages, "Error Saving The Images: "+err.Error())
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	if err = h.Repo.Category.SetProductCategories(product.ProductID, categoryIDs); err != nil {
+		h.discardProduct(product.ProductID, filenames)
+		responseMessages = append(responseMessages, "Error Saving The Categories: "+err.Error())
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	//Get and send created product (with its categories)
+	createdProduct, err := h.Repo.Product.GetProductByID(product.ProductID)
+	if err != nil { createdProduct = &product }
+
 	//Fake Latency
 	time.Sleep(2 * time.Second)
 
-	sendProductMessage(w, []string{}, &product)
+	sendProductMessage(w, []string{}, createdProduct)
 }
 
 // Renders the edit product page.
@@ -324,7 +612,27 @@ func (h *Handler) EditProductView(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl.ExecuteTemplate(w, "editProduct", product)
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var selected []uuid.UUID
+	for _, c := range product.Categories {
+		selected = append(selected, c.CategoryID)
+	}
+
+	data := struct {
+		*models.Product
+		Categories []categoryOption
+		TaxClasses []string
+	}{
+		Product:    product,
+		Categories: categoryOptions(categories, selected...),
+		TaxClasses: tax.Classes(),
+	}
+	tmpl.ExecuteTemplate(w, "editProduct", data)
 }
 
 // Updates a product in the database.
@@ -336,47 +644,114 @@ func (h *Handler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = r.ParseForm()
+	// Initialize error messages slice
+	var responseMessages []string
+
+	// Parse the form, which is multipart when it has a new image (rejecting uploads bigger than the max upload size)
+	r.Body = http.MaxBytesReader(w, r.Body, h.Config.MaxUploadSize)
+	err = r.ParseMultipartForm(h.Config.MaxUploadSize)
+	if err == http.ErrNotMultipart { err = r.ParseForm() }
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			responseMessages = append(responseMessages, fmt.Sprintf("The Upload Is Too Big (Max %d MB)", h.Config.MaxUploadSize>>20))
+		} else {
+			responseMessages = append(responseMessages, "Error reading the form")
+		}
+		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
-	// Initialize error messages slice
-	var responseMessages []string
-
 	//Check for empty fields
 	ProductName := r.FormValue("product_name")
 	ProductPrice := r.FormValue("price")
 	ProductDescription := r.FormValue("description")
+	ProductStock := r.FormValue("stock")
 
-	if ProductName == "" || ProductPrice == "" || ProductDescription == "" {
+	if ProductName == "" || ProductPrice == "" || ProductDescription == "" || ProductStock == "" {
 		responseMessages = append(responseMessages, "All Fields Are Required")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
-	price, err := strconv.ParseFloat(ProductPrice, 64)
-	if err != nil {
+	price, err := models.ParseMoney(ProductPrice)
+	if err != nil || price < 0 {
 		responseMessages = append(responseMessages, "Invalid Price")
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
+	stock, err := strconv.Atoi(ProductStock)
+	if err != nil || stock < 0 {
+		responseMessages = append(responseMessages, "Invalid Stock")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	measures, err := parseProductMeasures(r)
+	if err != nil {
+		responseMessages = append(responseMessages, "Invalid Weight Or Dimensions")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	taxClass, ok := parseTaxClass(r)
+	if !ok {
+		responseMessages = append(responseMessages, "Invalid Tax Class")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	categoryIDs, err := parseCategoryIDs(r.Form["category_ids"])
+	if err != nil {
+		responseMessages = append(responseMessages, "Invalid Category")
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
+	// Save the new image (optional), it replaces the primary image of the product
+	var filename string
+	if r.MultipartForm != nil && len(r.MultipartForm.File["product_image"]) > 0 {
+		filenames, err := h.saveUploads(r.MultipartForm.File["product_image"][:1])
+		if err != nil {
+			responseMessages = append(responseMessages, uploadErrorMessage(err))
+			sendProductMessage(w, responseMessages, nil)
+			return
+		}
+		filename = filenames[0]
+	}
+
 	product := models.Product{
-		ProductID:   productID,
-		ProductName: ProductName,
-		Price:       price,
-		Description: ProductDescription,
+		ProductID:    productID,
+		ProductName:  ProductName,
+		Price:        price,
+		TaxClass:     taxClass,
+		Stock:        stock,
+		Weight:       measures.Weight,
+		Length:       measures.Length,
+		Width:        measures.Width,
+		Height:       measures.Height,
+		Description:  ProductDescription,
+		ProductImage: filename,
 	}
 
-	err = h.Repo.Product.UpdateProduct(&product)
+	oldImage, err := h.Repo.Product.UpdateProduct(&product)
 	if err != nil {
+		h.removeUploads(filename)
 		responseMessages = append(responseMessages, "Error Updating Product: "+err.Error())
 		sendProductMessage(w, responseMessages, nil)
 		return
 	}
 
+	// The old image is only removed once the product no longer references it
+	if oldImage != filename { h.removeUploads(oldImage) }
+
+	if err = h.Repo.Category.SetProductCategories(productID, categoryIDs); err != nil {
+		responseMessages = append(responseMessages, "Error Saving The Categories: "+err.Error())
+		sendProductMessage(w, responseMessages, nil)
+		return
+	}
+
 	//Get and send updated product
 	updatedProduct, _ := h.Repo.Product.GetProductByID(productID)
 
@@ -395,7 +770,11 @@ func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, _ := h.Repo.Product.GetProductByID(productID)
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
 
 	err = h.Repo.Product.DeleteProduct(productID)
 	if err != nil {
@@ -403,9 +782,12 @@ func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//Remove product image
-	productImagePath := filepath.Join("static/uploads", product.ProductImage)
-	os.Remove(productImagePath)
+	//Remove the product images (the gallery rows are deleted with the product)
+	filenames := []string{product.ProductImage}
+	for _, image := range product.Images {
+		filenames = append(filenames, image.Filename)
+	}
+	h.removeUploads(filenames...)
 
 	//Fake Latency
 	time.Sleep(2 * time.Second)
@@ -415,33 +797,97 @@ func (h *Handler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 
 // Renders the shop home page.
 func (h *Handler) ShoppingHomepage(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	categories, err := h.Repo.Category.ListCategories()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		OrderItems []models.OrderItem
+		Customer   *models.User
+		Categories []models.Category
 	}{
 		OrderItems: cartItems,
+		Customer:   h.currentCustomer(r),
+		Categories: categories,
 	}
 	tmpl.ExecuteTemplate(w, "homepage", data)
 }
 
-// Renders the items view in the home page.
+// Renders the items view in the home page (the products of the selected category, if any).
 func (h *Handler) ShoppingItemsView(w http.ResponseWriter, r *http.Request) {
 	time.Sleep(1 * time.Second) 	// Fake Latency
-	products, _ := h.Repo.Product.GetProducts("product_image != ''")
-	tmpl.ExecuteTemplate(w, "shoppingItems", products)
+	filter, err := h.storefrontFilter(r)
+	if err == errInvalidCategory {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	products, err := h.Repo.Product.GetProducts(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "shoppingItems", ShoppingItemsTemplateData{Products: products})
+}
+
+// Renders the products that match the search box of the home page, ranked by relevance and with the matched words
+// highlighted. The search is limited to the selected category (if any) and an empty search renders every product.
+func (h *Handler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	filter, err := h.storefrontFilter(r)
+	if err == errInvalidCategory {
+		http.Error(w, "Invalid category", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var products []models.Product
+	if query == "" {
+		products, err = h.Repo.Product.GetProducts(filter)
+	} else {
+		products, err = h.Repo.Product.SearchProducts(query, filter, searchResultsLimit)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	tmpl.ExecuteTemplate(w, "shoppingItems", ShoppingItemsTemplateData{Products: products, Terms: repository.SearchTerms(query)})
 }
 
 // Renders the cart view in the home page.
 func (h *Handler) CartView(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	data := struct {
 		OrderItems []models.OrderItem
 		Message    string
 		AlertType  string
-		TotalCost  float64
+		TotalCost  models.Money
 	}{
 		OrderItems: cartItems,
 		Message:    "",
 		AlertType:  "",
-		TotalCost:  getTotalCartCost(),
+		TotalCost:  getTotalCartCost(cartItems),
 	}
 	tmpl.ExecuteTemplate(w, "cartItems", data)
 }
@@ -455,36 +901,38 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate a new order id for the session if one does not exist
-	if currentCartOrderId == uuid.Nil { currentCartOrderId = uuid.New() }
+	//Get the Product
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
 
-	// Check if product already exists in order items
-	exists := false
-	for _, item := range cartItems {
-		if item.ProductID == productID {
-			exists = true
-			break
+	// Variant chosen by the shopper (products without variants do not send one)
+	variantID := uuid.Nil
+	if value := r.FormValue("variant_id"); value != "" {
+		if variantID, err = uuid.Parse(value); err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return
 		}
 	}
 
-	//Get the Product
-	product, _ := h.Repo.Product.GetProductByID(productID)
-
 	cartMessage := ""
 	alertType := ""
 
-	if !exists {
-		// Create a new order item
-		newOrderItem := models.OrderItem{
-			OrderID:   currentCartOrderId,
-			ProductID: productID,
-			Quantity:  1, // Initial quantity of 1
-			Product:   *product,
-		}
-
-		// Add new order item to the array
-		cartItems = append(cartItems, newOrderItem)
-
+	// Add the product to the visitor's cart (if it is not already there)
+	cartItems, added, err := h.Carts.AddItem(getSessionID(w, r), h.customerID(r), *product, variantID)
+	if err != nil && err != cart.ErrOutOfStock && err != cart.ErrVariantRequired {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == cart.ErrVariantRequired {
+		cartMessage = "Choose an option of " + product.ProductName
+		alertType = "warning"
+	} else if err == cart.ErrOutOfStock {
+		cartMessage = product.ProductName + " is out of stock"
+		alertType = "danger"
+	} else if added {
 		cartMessage = product.ProductName + " successfully added"
 		alertType = "success"
 	} else {
@@ -496,12 +944,12 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 		OrderItems []models.OrderItem
 		Message    string
 		AlertType  string
-		TotalCost  float64
+		TotalCost  models.Money
 	}{
 		OrderItems: cartItems,
 		Message:    cartMessage,
 		AlertType:  alertType,
-		TotalCost:  getTotalCartCost(),
+		TotalCost:  getTotalCartCost(cartItems),
 	}
 
 	tmpl.ExecuteTemplate(w, "cartItems", data)
@@ -509,54 +957,68 @@ func (h *Handler) AddToCart(w http.ResponseWriter, r *http.Request) {
 
 // Renders the checkout view in the home page.
 func (h *Handler) ShoppingCartView(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "shoppingCart", cartItems)
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data := struct {
+		OrderItems []models.OrderItem
+		Checkout   checkoutForm
+	}{
+		OrderItems: cartItems,
+		Checkout:   h.cartCheckoutForm(r, cartItems),
+	}
+	tmpl.ExecuteTemplate(w, "shoppingCart", data)
+}
+
+// Renders the shipping methods and the totals of the checkout form again with the shipping address and method of the form
+// (htmx, when the shopper changes the shipping address, so the tax is calculated for it).
+func (h *Handler) CheckoutSummary(w http.ResponseWriter, r *http.Request) {
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.ExecuteTemplate(w, "shippingMethods", h.cartCheckoutForm(r, cartItems))
 }
 
 // Updates the quantity of a product in the cart.
 func (h *Handler) UpdateOrderItemQuantity(w http.ResponseWriter, r *http.Request) {
 	// Get product ID and action from URL parameters
 	cartMessage := ""
-	refreshCartList := false //Signals a refresh of cart items when an item is removed
 
 	productID, err := uuid.Parse(r.URL.Query().Get("product_id"))
 	if err != nil {
 		http.Error(w, "Invalid product ID", http.StatusBadRequest)
 		return
 	}
-	action := r.URL.Query().Get("action")
-
-	// Find the order item
-	var itemIndex int
-	for i, item := range cartItems {
-		if item.ProductID == productID {
-			itemIndex = i
-			break
+	variantID := uuid.Nil
+	if value := r.URL.Query().Get("variant_id"); value != "" {
+		if variantID, err = uuid.Parse(value); err != nil {
+			http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+			return
 		}
 	}
-	if itemIndex == -1 {
+	action := r.URL.Query().Get("action")
+
+	// Update quantity based on action
+	cartItems, refreshCartList, err := h.Carts.UpdateQuantity(getSessionID(w, r), productID, variantID, action)
+	if err == cart.ErrItemNotFound {
 		http.Error(w, "Product not found in order", http.StatusNotFound)
 		return
 	}
-
-	// Update quantity based on action
-	switch action {
-		case "add":
-			cartItems[itemIndex].Quantity++
-		case "subtract":
-			cartItems[itemIndex].Quantity--
-			if cartItems[itemIndex].Quantity == 0 {
-				// Remove item if quantity is 0
-				cartItems = append(cartItems[:itemIndex], cartItems[itemIndex+1:]...)
-				refreshCartList = true
+	if err == cart.ErrInvalidAction {
+		cartMessage = "Invalid Action"
+	} else if err == cart.ErrOutOfStock {
+		for _, item := range cartItems {
+			if item.ProductID == productID && item.VariantID == variantID {
+				cartMessage = fmt.Sprintf("Only %d of %s in stock", item.Product.Stock, item.Product.ProductName)
 			}
-		case "remove":
-			// Remove item regardless of quantity
-			cartItems = append(cartItems[:itemIndex], cartItems[itemIndex+1:]...)
-			refreshCartList = true
-		default:
-			/* http.Error(w, "Invalid action", http.StatusBadRequest)
-			return */
-			cartMessage = "Invalid Action"
+		}
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	// Respond to the request
@@ -565,54 +1027,194 @@ func (h *Handler) UpdateOrderItemQuantity(w http.ResponseWriter, r *http.Request
 		OrderItems       []models.OrderItem
 		Message          string
 		AlertType        string
-		TotalCost        float64
+		TotalCost        models.Money
 		Action           string
 		RefreshCartItems bool
+		Checkout         checkoutForm
 	}{
 		OrderItems:       cartItems,
 		Message:          cartMessage,
 		AlertType:        "info",
-		TotalCost:        getTotalCartCost(),
+		TotalCost:        getTotalCartCost(cartItems),
 		Action:           action,
 		RefreshCartItems: refreshCartList,
+		Checkout:         h.cartCheckoutForm(r, cartItems),
 	}
 
 	tmpl.ExecuteTemplate(w, "updateShoppingCart", data)
 }
 
-// Places an order.
+// Places an order with the cart of the visitor. It is a POST (so prefetches, refreshes and crawlers do not place orders)
+// with the idempotency key of the cart: a retry with the key of an order already placed shows its confirmation again (only
+// to the shopper that placed it, see retriedOrder).
+// The form has the shipping address (a saved address of the customer or a new one, which they can save in their address
+// book) and the billing address, checked with the rules of their country, and the shipping method, whose cost is
+// calculated again with the items of the order and stored with it, like the tax of every item (with the rule of the region
+// of the shipping address and the tax class of the product) and whether the prices included it. Empty carts are refused,
+// and if a price changed since the items were added (or since the shopper confirmed it) no order is written: the shopper is
+// shown the changed lines, and the form carries the new prices to confirm them by placing the order again.
 func (h *Handler) PlaceOrder(w http.ResponseWriter, r *http.Request) {
-	for i := range cartItems {
-		cartItems[i].Cost = float64(cartItems[i].Quantity) * cartItems[i].Product.Price
+	key := r.FormValue("idempotency_key")
+	if key == "" {
+		http.Error(w, "Missing idempotency key", http.StatusBadRequest)
+		return
 	}
 
-	err := h.Repo.Order.PlaceOrderWithItems(cartItems)
+	form, shippingAddress, billingAddress := h.parseCheckoutForm(r, key)
+	if len(form.Problems) > 0 {
+		h.renderCheckout(w, r, form, nil, http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Place the order with the visitor's cart (which is emptied on success) for the logged in customer (or a guest)
+	sessionID := getSessionID(w, r)
+	order := models.Order{UserID: h.customerID(r), SessionID: sessionID, TaxInclusive: h.Config.PricesIncludeTax(),
+		ShippingAddress: &shippingAddress, BillingAddress: &billingAddress}
+	_, err := h.Carts.Checkout(sessionID, key, form.Confirmed, func(items []models.OrderItem) error {
+		quote, err := shipping.QuoteFor(h.Config.ShippingMethods, form.ShippingMethod, items)
+		if err != nil { return err }
+		tax.Apply(h.Config.TaxRules, order.TaxInclusive, shippingAddress, items)
+		order.Items = items
+		order.ShippingMethod, order.ShippingName, order.ShippingCost = quote.Method.Code, quote.Method.Name, quote.Cost
+		_, err = h.Repo.Order.PlaceOrderWithItems(&order, key)
+		return err
+	})
+	if err == cart.ErrCartChanged || err == repository.ErrOrderAlreadyPlaced {
+		// A retry (the cart is gone once the order is placed): show the confirmation of the order placed with the key
+		placed, findErr := h.retriedOrder(r, sessionID, key)
+		if findErr != nil {
+			http.Error(w, findErr.Error(), http.StatusInternalServerError)
+			return
+		}
+		if placed != nil {
+			h.renderOrderComplete(w, r, placed)
+			return
+		}
+	}
+	if err == cart.ErrCartChanged {
+		h.renderCheckoutFailed(w, r, "Your cart changed since you opened it. Review your cart and place the order again.", nil)
+		return
+	}
+	if err == cart.ErrEmptyCart {
+		h.renderCheckoutFailed(w, r, "Your cart is empty. Add some products to your cart before placing an order.", nil)
+		return
+	}
+	if err == shipping.ErrMethodUnavailable {
+		form.Problems = append(form.Problems, "The Shipping Method You Chose Can Not Take This Order, Choose Another One")
+		h.renderCheckout(w, r, form, nil, http.StatusUnprocessableEntity)
+		return
+	}
+	var stockErr *repository.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		h.renderCheckoutFailed(w, r, "Some items in your cart do not have enough stock. Update your cart and try again.", stockErr.Shortages)
+		return
+	}
+	var priceErr *repository.PriceChangedError
+	if errors.As(err, &priceErr) {
+		// The form carries the new prices (with the ones confirmed before), so the order is placed at them once confirmed
+		form.Confirmed.Add(priceErr.Changes)
+		h.renderCheckout(w, r, form, priceErr.Changes, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Error Placing Order "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	displayItems := cartItems
-	totalCost := getTotalCartCost()
+	h.saveCheckoutAddress(r, form, shippingAddress)
+	h.renderPlacedOrder(w, r, order.OrderID)
+}
 
-	//Empty the cart items
-	cartItems = []models.OrderItem{}
-	currentCartOrderId = uuid.Nil
+// Renders the checkout page with the form filled in by the shopper (and its problems) and, if the order was refused
+// because prices changed, the changed lines and the new total to confirm (at the prices confirmed in the form).
+func (h *Handler) renderCheckout(w http.ResponseWriter, r *http.Request, form checkoutForm, changes []repository.PriceChange, status int) {
+	cartItems, err := h.Carts.Items(getSessionID(w, r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.priceCheckout(&form, cartItems)
 
 	data := struct {
+		Changes   []repository.PriceChange
+		TotalCost models.Money
+		Checkout  checkoutForm
+		Customer  *models.User
+	}{
+		Changes:   changes,
+		TotalCost: getTotalCartCost(cartItems),
+		Checkout:  form,
+		Customer:  h.currentCustomer(r),
+	}
+	w.WriteHeader(status)
+	tmpl.ExecuteTemplate(w, "checkout", data)
+}
+
+// Renders the order complete page of an order that was already placed.
+func (h *Handler) renderPlacedOrder(w http.ResponseWriter, r *http.Request, orderID uuid.UUID) {
+	order, err := h.Repo.Order.GetOrderWithProducts(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderOrderComplete(w, r, order)
+}
+
+// Returns the order placed with the idempotency key of a retried checkout if the visitor placed it: the logged in
+// customer of a customer order, or the session of a guest order. It returns nil if there is none or it is another
+// shopper's, whose addresses must not be shown.
+func (h *Handler) retriedOrder(r *http.Request, sessionID, key string) (*models.Order, error) {
+	orderID, err := h.Repo.Order.GetOrderIDByIdempotencyKey(key)
+	if err == sql.ErrNoRows { return nil, nil }
+	if err != nil { return nil, err }
+	order, err := h.Repo.Order.GetOrderWithProducts(orderID)
+	if err != nil { return nil, err }
+
+	if order.UserID != "" && order.UserID == h.customerID(r) { return order, nil }
+	if order.UserID == "" && order.SessionID != "" && order.SessionID == sessionID { return order, nil }
+	return nil, nil
+}
+
+// Renders the order complete page with the items, the shipping and the addresses of the order.
+func (h *Handler) renderOrderComplete(w http.ResponseWriter, r *http.Request, order *models.Order) {
+	data := struct {
+		Order      *models.Order
 		OrderItems []models.OrderItem
-		TotalCost  float64
+		TotalCost  models.Money
+		Customer   *models.User
 	}{
-		OrderItems: displayItems,
-		TotalCost:  totalCost,
+		Order:      order,
+		OrderItems: order.Items,
+		TotalCost:  order.Total(),
+		Customer:   h.currentCustomer(r),
 	}
 
 	tmpl.ExecuteTemplate(w, "orderComplete", data)
 }
 
+// Renders the page of a checkout that could not place the order (409) with the reason and the short items (if any).
+func (h *Handler) renderCheckoutFailed(w http.ResponseWriter, r *http.Request, message string, shortages []repository.StockShortage) {
+	data := struct {
+		Message   string
+		Shortages []repository.StockShortage
+		Customer  *models.User
+	}{
+		Message:   message,
+		Shortages: shortages,
+		Customer:  h.currentCustomer(r),
+	}
+	w.WriteHeader(http.StatusConflict)
+	tmpl.ExecuteTemplate(w, "checkoutFailed", data)
+}
+
 // Renders the order page.
 func (h *Handler) OrdersPage(w http.ResponseWriter, r *http.Request) {
-	tmpl.ExecuteTemplate(w, "orders", nil)
+	data := struct {
+		Admin *models.AdminUser
+	}{
+		Admin: currentAdmin(r),
+	}
+	tmpl.ExecuteTemplate(w, "orders", data)
 }
 
 // Renders all orders in the database in the table.
@@ -683,25 +1285,66 @@ func (h *Handler) GetOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	h.renderOrder(w, r, orderID, "", "")
+}
+
+// Updates the status of an order (following the order lifecycle) and renders the order detail page again.
+func (h *Handler) UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	orderID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	status := r.FormValue("order_status")
+
+	err = h.Repo.Order.UpdateOrderStatus(orderID, status, currentAdmin(r).Email)
+	if err == repository.ErrInvalidStatusTransition {
+		h.renderOrder(w, r, orderID, "The order can not be changed to '"+status+"'", "danger")
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.renderOrder(w, r, orderID, "Order status updated to '"+status+"'", "success")
+}
+
+// Renders the order detail page with its status history and an optional message.
+func (h *Handler) renderOrder(w http.ResponseWriter, r *http.Request, orderID uuid.UUID, message, alertType string) {
 	order, err := h.Repo.Order.GetOrderWithProducts(orderID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	totalCost := 0.0
-	for _, item := range order.Items {
-		totalCost += float64(item.Quantity) * item.Product.Price
+	history, err := h.Repo.Order.GetOrderStatusHistory(orderID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	// Only admins allowed to update the status get the status form
+	var nextStatuses []string
+	if currentAdmin(r).Can(models.PermUpdateOrderStatus) { nextStatuses = repository.NextOrderStatuses(order.OrderStatus) }
 	order.OrderStatus = strings.ToUpper(order.OrderStatus)
 
 	data := struct {
-		Order     models.Order
-		TotalCost float64
+		Order         models.Order
+		TotalCost     models.Money
+		NextStatuses  []string
+		StatusHistory []models.OrderStatusChange
+		Message       string
+		AlertType     string
 	}{
-		Order:     *order,
-		TotalCost: totalCost,
+		Order:         *order,
+		TotalCost:     order.Total(),
+		NextStatuses:  nextStatuses,
+		StatusHistory: history,
+		Message:       message,
+		AlertType:     alertType,
 	}
 
 	tmpl.ExecuteTemplate(w, "viewOrder", data)
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+/*** Helper Functions ***/
+
+// Returns a multipart body (and its content type) with the fields of a form and a small PNG image as product_image.
+func productForm(t *testing.T, fields url.Values) (*bytes.Buffer, string) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	for name, values := range fields {
+		for _, value := range values {
+			if err := writer.WriteField(name, value); err != nil { t.Fatal(err) }
+		}
+	}
+	part, err := writer.CreateFormFile("product_image", "laptop.png")
+	if err != nil { t.Fatal(err) }
+	if err = png.Encode(part, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil { t.Fatal(err) }
+	if err = writer.Close(); err != nil { t.Fatal(err) }
+	return body, writer.FormDataContentType()
+}
+
+/*** Tests ***/
+
+// Tests that a product whose categories can not be saved is deleted with its uploads, so no product is left pointing at
+// images the admin never saw and the admin can create it again.
+func TestCreateProductDiscardedOnError(t *testing.T) {
+	cfg := testConfig(t)
+	server, repo := newTestServerWithConfig(t, cfg)
+	admin := newTestClient(t)
+
+	resp, body := doForm(t, admin, http.MethodPost, server.URL+"/admin/login", url.Values{"email": {testAdminEmail}, "password": {testPassword}})
+	if resp.StatusCode != http.StatusOK { t.Fatalf("admin login: status %d: %s", resp.StatusCode, body) }
+
+	form, contentType := productForm(t, url.Values{
+		"product_name": {"Test Laptop"},
+		"price":        {"19.99"},
+		"description":  {"A laptop"},
+		"stock":        {"5"},
+		"category_ids": {uuid.NewString()}, // Unknown category
+	})
+	resp, err := admin.Post(server.URL+"/products", contentType, form)
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	var message bytes.Buffer
+	if _, err = message.ReadFrom(resp.Body); err != nil { t.Fatal(err) }
+	if !strings.Contains(message.String(), "Error Saving The Categories") { t.Fatalf("creating the product answered %q, want the categories error", message.String()) }
+
+	products, err := repo.Product.ListProducts(10, 0)
+	if err != nil { t.Fatal(err) }
+	for _, product := range products {
+		if product.ProductName == "Test Laptop" { t.Errorf("the product %s was kept", product.ProductID) }
+	}
+	uploads, err := os.ReadDir(cfg.UploadDir)
+	if err != nil { t.Fatal(err) }
+	if len(uploads) != 0 { t.Errorf("%d uploads were kept, want none", len(uploads)) }
+}
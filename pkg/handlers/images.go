@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Helper Functions ***/
+
+// Renders the image gallery of a product with a message (empty for none) shown in an alert of the type (e.g. success).
+func (h *Handler) renderImages(w http.ResponseWriter, productID uuid.UUID, message, alertType string) {
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Product   *models.Product
+		LastIndex int // Index of the last image, which can not move down
+		Message   string
+		AlertType string
+	}{
+		Product:   product,
+		LastIndex: len(product.Images) - 1,
+		Message:   message,
+		AlertType: alertType,
+	}
+	tmpl.ExecuteTemplate(w, "productImages", data)
+}
+
+// Parses the product and image IDs of the URL.
+func parseImageVars(r *http.Request) (uuid.UUID, uuid.UUID, error) {
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil { return uuid.Nil, uuid.Nil, errors.New("Invalid product ID") }
+	imageID, err := uuid.Parse(vars["image_id"])
+	if err != nil { return uuid.Nil, uuid.Nil, errors.New("Invalid image ID") }
+	return productID, imageID, nil
+}
+
+/*** Handlers ***/
+
+// Renders the image gallery of a product.
+func (h *Handler) ProductImagesView(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderImages(w, productID, "", "")
+}
+
+// Adds the uploaded images (one or more) at the end of the gallery of a product.
+func (h *Handler) AddProductImages(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the multipart form, rejecting uploads bigger than the max upload size
+	r.Body = http.MaxBytesReader(w, r.Body, h.Config.MaxUploadSize)
+	if err = r.ParseMultipartForm(h.Config.MaxUploadSize); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.renderImages(w, productID, fmt.Sprintf("The Upload Is Too Big (Max %d MB)", h.Config.MaxUploadSize>>20), "danger")
+		} else {
+			h.renderImages(w, productID, "Error reading the form", "danger")
+		}
+		return
+	}
+
+	files := r.MultipartForm.File["product_image"]
+	if len(files) == 0 {
+		h.renderImages(w, productID, "Select at least one image", "danger")
+		return
+	}
+
+	filenames, err := h.saveUploads(files)
+	if err != nil {
+		h.renderImages(w, productID, uploadErrorMessage(err), "danger")
+		return
+	}
+
+	if err = h.Repo.Image.AddImages(productID, filenames); err != nil {
+		h.removeUploads(filenames...)
+		h.renderImages(w, productID, "Error Saving The Images: "+err.Error(), "danger")
+		return
+	}
+	h.renderImages(w, productID, fmt.Sprintf("%d images added", len(filenames)), "success")
+}
+
+// Makes an image the primary image of its product (the one shown in the listings).
+func (h *Handler) SetPrimaryProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, err := parseImageVars(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.Repo.Image.SetPrimaryImage(productID, imageID)
+	if err == sql.ErrNoRows {
+		h.renderImages(w, productID, "The Image Does Not Exist", "danger")
+		return
+	}
+	if err != nil {
+		h.renderImages(w, productID, "Error Saving The Primary Image: "+err.Error(), "danger")
+		return
+	}
+	h.renderImages(w, productID, "Primary image changed", "success")
+}
+
+// Moves an image one position up or down ("direction" query parameter) in the gallery of its product.
+func (h *Handler) MoveProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, err := parseImageVars(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var offset int
+	switch r.URL.Query().Get("direction") {
+		case "up":
+			offset = -1
+		case "down":
+			offset = 1
+		default:
+			http.Error(w, "Invalid direction", http.StatusBadRequest)
+			return
+	}
+
+	images, err := h.Repo.Image.ListImages(productID)
+	if err != nil {
+		h.renderImages(w, productID, "Error Loading The Images: "+err.Error(), "danger")
+		return
+	}
+
+	imageIDs := make([]uuid.UUID, len(images))
+	position := -1
+	for i, image := range images {
+		imageIDs[i] = image.ImageID
+		if image.ImageID == imageID { position = i }
+	}
+	if position == -1 {
+		h.renderImages(w, productID, "The Image Does Not Exist", "danger")
+		return
+	}
+
+	// The first image can not move up and the last one can not move down
+	target := position + offset
+	if target < 0 || target >= len(imageIDs) {
+		h.renderImages(w, productID, "", "")
+		return
+	}
+	imageIDs[position], imageIDs[target] = imageIDs[target], imageIDs[position]
+
+	if err = h.Repo.Image.ReorderImages(productID, imageIDs); err != nil {
+		h.renderImages(w, productID, "Error Saving The Order: "+err.Error(), "danger")
+		return
+	}
+	h.renderImages(w, productID, "", "")
+}
+
+// Deletes an image of a product and removes its file from the upload directory.
+func (h *Handler) DeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	productID, imageID, err := parseImageVars(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	filename, err := h.Repo.Image.DeleteImage(productID, imageID)
+	if err == sql.ErrNoRows {
+		h.renderImages(w, productID, "The Image Does Not Exist", "danger")
+		return
+	}
+	if err != nil {
+		h.renderImages(w, productID, "Error Deleting The Image: "+err.Error(), "danger")
+		return
+	}
+
+	// The file is only removed once no row references it
+	h.removeUploads(filename)
+	h.renderImages(w, productID, "Image deleted", "success")
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+// Registers the routes of the web pages, the admin dashboard and the JSON API of the handler in the router. The static
+// files are not included, they are served by main.
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	/*** User Routes ***/
+
+	// Endpoint to display the home page (user shop view)
+	r.HandleFunc("/", h.ShoppingHomepage).Methods("GET")
+	// Endpoint to display the products in the home page
+	r.HandleFunc("/shoppingitems", h.ShoppingItemsView).Methods("GET")
+	// Endpoint to search the products in the home page
+	r.HandleFunc("/search", h.SearchProducts).Methods("GET")
+	// Endpoint to display the cart view in the home page
+	r.HandleFunc("/cartitems", h.CartView).Methods("GET")
+	// Endpoint to add a product to the cart
+	r.HandleFunc("/addtocart/{product_id}", h.AddToCart).Methods("POST")
+	// Endpoint to display the checkout view
+	r.HandleFunc("/gotocart", h.ShoppingCartView).Methods("GET")
+	// Endpoint to update the quantity of a product in the cart
+	r.HandleFunc("/updateorderitem", h.UpdateOrderItemQuantity).Methods("PUT")
+	// Endpoint to place an order with the cart and display the order complete view
+	r.HandleFunc("/checkout", h.PlaceOrder).Methods("POST")
+	// Endpoint to display the shipping methods and totals of the checkout form with the address of the form
+	r.HandleFunc("/checkout/summary", h.CheckoutSummary).Methods("POST")
+
+	// Customer Account Routes
+	// Endpoint to display the login and registration page
+	r.HandleFunc("/login", h.LoginView).Methods("GET")
+	// Endpoint to log a customer in
+	r.HandleFunc("/login", h.Login).Methods("POST")
+	// Endpoint to register a new customer account
+	r.HandleFunc("/register", h.Register).Methods("POST")
+	// Endpoint to log the customer out
+	r.HandleFunc("/logout", h.Logout).Methods("POST")
+	// Endpoint to display the address book of the customer
+	r.HandleFunc("/addresses", h.AddressBookPage).Methods("GET")
+	// Endpoint to save an address in the address book of the customer
+	r.HandleFunc("/addresses", h.CreateAddress).Methods("POST")
+	// Endpoint to delete an address from the address book of the customer
+	r.HandleFunc("/addresses/{id}", h.DeleteAddress).Methods("DELETE")
+
+	/*** Admin Routes ***/
+
+	// Admin Login Routes (public)
+	// Endpoint to display the admin login page
+	r.HandleFunc("/admin/login", h.AdminLoginView).Methods("GET")
+	// Endpoint to log an admin in
+	r.HandleFunc("/admin/login", h.AdminLogin).Methods("POST")
+	// Endpoint to log the admin out
+	r.HandleFunc("/admin/logout", h.AdminLogout).Methods("POST")
+
+	// Every route below requires a logged in admin whose role grants the permission of the route
+	admin := r.NewRoute().Subrouter()
+	admin.Use(h.AdminAuth)
+
+	// Utility Routes
+	// Endpoint to seed (feed/create) 20 dummy products in the database (each time the endpoint is called)
+	admin.HandleFunc("/seed-products", h.Permit(models.PermSeedProducts, h.SeedProducts)).Methods("POST")
+
+	// Products Routes
+	// Endpoint to display the products page
+	admin.HandleFunc("/manageproducts", h.Permit(models.PermViewProducts, h.ProductsPage)).Methods("GET")
+	// Endpoint to display the all products view (table with all products)
+	admin.HandleFunc("/allproducts", h.Permit(models.PermViewProducts, h.AllProductsView)).Methods("GET")
+	// Endpoint to display the rows of the all products view (table with all products)
+	admin.HandleFunc("/products", h.Permit(models.PermViewProducts, h.ListProducts)).Methods("GET")
+	// Endpoint to display the details of a product
+	admin.HandleFunc("/products/{id}", h.Permit(models.PermViewProducts, h.GetProduct)).Methods("GET")
+	// Endpoint to create a new product in the database
+	admin.HandleFunc("/products", h.Permit(models.PermEditProducts, h.CreateProduct)).Methods("POST")
+	// Endpoint to update a product in the database
+	admin.HandleFunc("/products/{id}", h.Permit(models.PermEditProducts, h.UpdateProduct)).Methods("PUT")
+	// Endpoint to delete a product from the database
+	admin.HandleFunc("/products/{id}", h.Permit(models.PermDeleteProducts, h.DeleteProduct)).Methods("DELETE")
+	// Endpoint to display the form to add a new product
+	admin.HandleFunc("/createproduct", h.Permit(models.PermEditProducts, h.CreateProductView)).Methods("GET")
+	// Endpoint to display the form to edit a product
+	admin.HandleFunc("/editproduct/{id}", h.Permit(models.PermEditProducts, h.EditProductView)).Methods("GET")
+	// Endpoint to display the options and variants of a product
+	admin.HandleFunc("/products/{id}/variants", h.Permit(models.PermEditProducts, h.ProductVariantsView)).Methods("GET")
+	// Endpoint to update the options of a product
+	admin.HandleFunc("/products/{id}/options", h.Permit(models.PermEditProducts, h.UpdateProductOptions)).Methods("PUT")
+	// Endpoint to create a variant of a product
+	admin.HandleFunc("/products/{id}/variants", h.Permit(models.PermEditProducts, h.CreateVariant)).Methods("POST")
+	// Endpoint to update a variant of a product
+	admin.HandleFunc("/products/{id}/variants/{variant_id}", h.Permit(models.PermEditProducts, h.UpdateVariant)).Methods("PUT")
+	// Endpoint to delete a variant of a product
+	admin.HandleFunc("/products/{id}/variants/{variant_id}", h.Permit(models.PermEditProducts, h.DeleteVariant)).Methods("DELETE")
+	// Endpoint to display the image gallery of a product
+	admin.HandleFunc("/products/{id}/images", h.Permit(models.PermEditProducts, h.ProductImagesView)).Methods("GET")
+	// Endpoint to upload images to the gallery of a product
+	admin.HandleFunc("/products/{id}/images", h.Permit(models.PermEditProducts, h.AddProductImages)).Methods("POST")
+	// Endpoint to make an image the primary image of its product
+	admin.HandleFunc("/products/{id}/images/{image_id}/primary", h.Permit(models.PermEditProducts, h.SetPrimaryProductImage)).Methods("PUT")
+	// Endpoint to move an image up or down in the gallery of its product
+	admin.HandleFunc("/products/{id}/images/{image_id}/move", h.Permit(models.PermEditProducts, h.MoveProductImage)).Methods("PUT")
+	// Endpoint to delete an image of a product
+	admin.HandleFunc("/products/{id}/images/{image_id}", h.Permit(models.PermEditProducts, h.DeleteProductImage)).Methods("DELETE")
+
+	// Categories Routes
+	// Endpoint to display the categories page
+	admin.HandleFunc("/managecategories", h.Permit(models.PermManageCategories, h.CategoriesPage)).Methods("GET")
+	// Endpoint to display the categories table
+	admin.HandleFunc("/allcategories", h.Permit(models.PermManageCategories, h.AllCategoriesView)).Methods("GET")
+	// Endpoint to display the form to add a new category
+	admin.HandleFunc("/createcategory", h.Permit(models.PermManageCategories, h.CreateCategoryView)).Methods("GET")
+	// Endpoint to create a new category
+	admin.HandleFunc("/categories", h.Permit(models.PermManageCategories, h.CreateCategory)).Methods("POST")
+	// Endpoint to display the form to edit (or delete) a category
+	admin.HandleFunc("/editcategory/{id}", h.Permit(models.PermManageCategories, h.EditCategoryView)).Methods("GET")
+	// Endpoint to update a category
+	admin.HandleFunc("/categories/{id}", h.Permit(models.PermManageCategories, h.UpdateCategory)).Methods("PUT")
+	// Endpoint to delete a category (moving its products and subcategories)
+	admin.HandleFunc("/categories/{id}", h.Permit(models.PermManageCategories, h.DeleteCategory)).Methods("DELETE")
+
+	// Orders Routes
+	// Endpoint to display the orders page
+	admin.HandleFunc("/manageorders", h.Permit(models.PermViewOrders, h.OrdersPage)).Methods("GET")
+	// Endpoint to load all the orders from the database in the table
+	admin.HandleFunc("/allorders", h.Permit(models.PermViewOrders, h.AllOrdersView)).Methods("GET")
+	// Endpoint to load the rows of the orders table
+	admin.HandleFunc("/orders", h.Permit(models.PermViewOrders, h.ListOrders)).Methods("GET")
+	// Endpoint to display the details of an order
+	admin.HandleFunc("/orders/{id}", h.Permit(models.PermViewOrders, h.GetOrder)).Methods("GET")
+	// Endpoint to update the status of an order
+	admin.HandleFunc("/orders/{id}/status", h.Permit(models.PermUpdateOrderStatus, h.UpdateOrderStatus)).Methods("PUT")
+
+	// Staff Routes
+	// Endpoint to display the staff page (admins and their roles)
+	admin.HandleFunc("/staff", h.Permit(models.PermManageStaff, h.StaffPage)).Methods("GET")
+	// Endpoint to create a new admin (staff member)
+	admin.HandleFunc("/staff", h.Permit(models.PermManageStaff, h.CreateStaff)).Methods("POST")
+
+	/*** API Routes ***/
+
+	// Every API route answers with JSON ({"data": ...} or {"error": {...}}), including the unknown endpoints
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.Use(h.APIMiddleware)
+	api.NotFoundHandler = h.APIUnmatched(api)
+	api.MethodNotAllowedHandler = api.NotFoundHandler
+
+	// Endpoint to get the OpenAPI document of the routes
+	api.HandleFunc("/openapi.json", h.OpenAPI).Methods("GET")
+
+	// Products Routes
+	// Endpoint to list the products (paginated)
+	api.HandleFunc("/products", h.APIListProducts).Methods("GET")
+	// Endpoint to get a product with its variants and images
+	api.HandleFunc("/products/{id}", h.APIGetProduct).Methods("GET")
+
+	// Cart Routes (the cart of the visitor's session cookie)
+	// Endpoint to get the cart
+	api.HandleFunc("/cart", h.APIGetCart).Methods("GET")
+	// Endpoint to add a product to the cart
+	api.HandleFunc("/cart/items", h.APIAddCartItem).Methods("POST")
+	// Endpoint to update the quantity of a product in the cart
+	api.HandleFunc("/cart/items/{product_id}", h.APIUpdateCartItem).Methods("PATCH")
+	// Endpoint to remove a product from the cart
+	api.HandleFunc("/cart/items/{product_id}", h.APIRemoveCartItem).Methods("DELETE")
+	// Endpoint to place an order with the cart
+	api.HandleFunc("/checkout", h.APICheckout).Methods("POST")
+
+	// Authentication Routes
+	// Endpoint to log a customer in
+	api.HandleFunc("/login", h.APILogin).Methods("POST")
+	// Endpoint to log the customer out
+	api.HandleFunc("/logout", h.APILogout).Methods("POST")
+	// Endpoint to log an admin in
+	api.HandleFunc("/admin/login", h.APIAdminLogin).Methods("POST")
+	// Endpoint to log the admin out
+	api.HandleFunc("/admin/logout", h.APIAdminLogout).Methods("POST")
+
+	// Every API route below requires a logged in admin whose role grants the permission of the route
+	apiAdmin := api.NewRoute().Subrouter()
+	apiAdmin.Use(h.APIAdminAuth)
+
+	// Orders Routes
+	// Endpoint to list the orders (paginated)
+	apiAdmin.HandleFunc("/orders", h.APIPermit(models.PermViewOrders, h.APIListOrders)).Methods("GET")
+	// Endpoint to get an order with its items and status history
+	apiAdmin.HandleFunc("/orders/{id}", h.APIPermit(models.PermViewOrders, h.APIGetOrder)).Methods("GET")
+	// Endpoint to update the status of an order
+	apiAdmin.HandleFunc("/orders/{id}/status", h.APIPermit(models.PermUpdateOrderStatus, h.APIUpdateOrderStatus)).Methods("PUT")
+}
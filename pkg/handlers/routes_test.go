@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/cart"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/config"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository/memory"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/session"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/storage"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/tax"
+)
+
+/*** Constants ***/
+const testAdminEmail = "admin@example.com"   // Admin (owner) of the test servers
+const testUserEmail = "customer@example.com" // Customer of the test servers
+const testPassword = "secret password"       // Password of the test admin and customer
+
+/*** Helper Functions ***/
+
+// Returns the default settings with the templates of the repository and a temporary upload directory.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg := config.Default()
+	cfg.TemplateDir, cfg.UploadDir = "../../templates", t.TempDir()
+	return cfg
+}
+
+// Returns a test server with the routes of a handler on the in-memory repository (with an admin and a customer), and the
+// repository.
+func newTestServer(t *testing.T) (*httptest.Server, *repository.Repository) {
+	t.Helper()
+	return newTestServerWithConfig(t, testConfig(t))
+}
+
+// Returns a test server like newTestServer with the settings.
+func newTestServerWithConfig(t *testing.T, cfg *config.Config) (*httptest.Server, *repository.Repository) {
+	t.Helper()
+	router, repo := newTestRouterWithConfig(t, cfg)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server, repo
+}
+
+// Returns a router with the routes of a handler on the in-memory repository (with an admin and a customer), and the
+// repository. The OpenAPI document is loaded from the router like main does.
+func newTestRouter(t *testing.T) (*mux.Router, *repository.Repository) {
+	t.Helper()
+	return newTestRouterWithConfig(t, testConfig(t))
+}
+
+// Returns a router like newTestRouter with the settings.
+func newTestRouterWithConfig(t *testing.T, cfg *config.Config) (*mux.Router, *repository.Repository) {
+	t.Helper()
+	store := storage.NewLocal(cfg.UploadDir, "/static/uploads/")
+	if err := LoadTemplates(cfg.TemplateDir, store); err != nil { t.Fatalf("LoadTemplates: %v", err) }
+
+	repo := memory.NewRepository()
+	if err := repo.Admin.CreateAdmin(&models.AdminUser{Email: testAdminEmail, FullName: "Owner", Role: models.RoleOwner}, testPassword); err != nil { t.Fatal(err) }
+	if err := repo.User.CreateUser(&models.User{Email: testUserEmail, FullName: "Customer"}, testPassword); err != nil { t.Fatal(err) }
+
+	handler := NewHandler(repo, cart.NewStore(repo.Cart, cfg.CartIdleTimeout), session.NewManager([]byte("test secret")), store, cfg)
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	if err := LoadOpenAPI(router); err != nil { t.Fatalf("LoadOpenAPI: %v", err) }
+	return router, repo
+}
+
+// Returns a client that keeps the cookies of the server (a visitor with its own session).
+func newTestClient(t *testing.T) *http.Client {
+	t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil { t.Fatal(err) }
+	return &http.Client{Jar: jar}
+}
+
+// Creates a product (standard tax class, 1 kg) in the repository.
+func createTestProduct(t *testing.T, repo *repository.Repository, name string, price models.Money, stock int) models.Product {
+	t.Helper()
+	product := models.Product{ProductName: name, Price: price, TaxClass: tax.ClassStandard, Stock: stock, Weight: 1000, Length: 20, Width: 10, Height: 5,
+		Description: "A product to test with", ProductImage: "product.jpg"}
+	if err := repo.Product.CreateProduct(&product); err != nil { t.Fatal(err) }
+	return product
+}
+
+// Sends a request with a JSON body (none if body is nil) and returns the response with its body.
+func doJSON(t *testing.T, client *http.Client, method, url string, body any, header http.Header) (*http.Response, []byte) {
+	t.Helper()
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil { t.Fatal(err) }
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil { t.Fatal(err) }
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil { req.Header.Set("Content-Type", "application/json") }
+	if req.Header.Get("Accept") == "" { req.Header.Set("Accept", "application/json") }
+
+	resp, err := client.Do(req)
+	if err != nil { t.Fatal(err) }
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil { t.Fatal(err) }
+	return resp, data
+}
+
+// Decodes the "data" of a JSON response into v, failing the test if the response has fields v does not have.
+func decodeData(t *testing.T, body []byte, v any) {
+	t.Helper()
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Data == nil { t.Fatalf("the response is not {\"data\": ...}: %s", body) }
+	decodeStrict(t, envelope.Data, v)
+}
+
+// Decodes JSON into v, failing the test if it has fields v does not have.
+func decodeStrict(t *testing.T, data []byte, v any) {
+	t.Helper()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil { t.Fatalf("decoding %s into %T: %v", data, v, err) }
+}
+
+/*** Tests ***/
+
+// Tests that the router of the handler and apiOperations match, so main does not fail at startup.
+func TestOpenAPISpec(t *testing.T) {
+	router, _ := newTestRouter(t)
+	doc, err := OpenAPISpec(router)
+	if err != nil { t.Fatalf("OpenAPISpec: %v", err) }
+	if len(doc.Paths) == 0 { t.Fatal("the document has no paths") }
+}
+
+// Tests that the request and response types of apiOperations are the ones the handlers decode and encode: every
+// operation is called with a body of its request type, and must answer with its status and a body that decodes into its
+// response type without unknown fields.
+func TestAPIOperationsMatchHandlers(t *testing.T) {
+	server, repo := newTestServer(t)
+	product := createTestProduct(t, repo, "Test Laptop", 1999, 10)
+	productID := product.ProductID.String()
+	visitor, admin := newTestClient(t), newTestClient(t)
+
+	var cartBody apiCart
+	var placed apiPlacedOrder
+	steps := []struct {
+		operation string
+		client    *http.Client
+		path      string
+		request   any
+		response  any // Decoded response of the steps whose values are used by the next ones
+	}{
+		{operation: "GET /api/v1/openapi.json", client: visitor, path: "/api/v1/openapi.json"},
+		{operation: "GET /api/v1/products", client: visitor, path: "/api/v1/products"},
+		{operation: "GET /api/v1/products/{id}", client: visitor, path: "/api/v1/products/" + productID},
+		{operation: "POST /api/v1/login", client: visitor, path: "/api/v1/login", request: apiLoginRequest{Email: testUserEmail, Password: testPassword}},
+		{operation: "POST /api/v1/cart/items", client: visitor, path: "/api/v1/cart/items", request: apiAddCartItemRequest{ProductID: product.ProductID}},
+		{operation: "PATCH /api/v1/cart/items/{product_id}", client: visitor, path: "/api/v1/cart/items/" + productID, request: apiUpdateCartItemRequest{Action: "add"}},
+		{operation: "GET /api/v1/cart", client: visitor, path: "/api/v1/cart", response: &cartBody},
+		{operation: "POST /api/v1/checkout", client: visitor, path: "/api/v1/checkout", response: &placed, request: apiCheckoutRequest{
+			ShippingAddress: &models.Address{FullName: "Customer", Line1: "1 Main St", City: "Austin", Region: "TX", PostalCode: "78701", Country: "US"},
+			ShippingMethod:  "standard",
+		}},
+		{operation: "POST /api/v1/cart/items", client: visitor, path: "/api/v1/cart/items", request: apiAddCartItemRequest{ProductID: product.ProductID}},
+		{operation: "DELETE /api/v1/cart/items/{product_id}", client: visitor, path: "/api/v1/cart/items/" + productID},
+		{operation: "POST /api/v1/logout", client: visitor, path: "/api/v1/logout"},
+		{operation: "POST /api/v1/admin/login", client: admin, path: "/api/v1/admin/login", request: apiLoginRequest{Email: testAdminEmail, Password: testPassword}},
+		{operation: "GET /api/v1/orders", client: admin, path: "/api/v1/orders"},
+		{operation: "GET /api/v1/orders/{id}", client: admin, path: "/api/v1/orders/{order_id}"},
+		{operation: "PUT /api/v1/orders/{id}/status", client: admin, path: "/api/v1/orders/{order_id}/status", request: apiOrderStatusRequest{Status: models.OrderStatusPaid}},
+		{operation: "POST /api/v1/admin/logout", client: admin, path: "/api/v1/admin/logout"},
+	}
+
+	called := map[string]bool{}
+	for _, step := range steps {
+		op, ok := apiOperations[step.operation]
+		if !ok { t.Fatalf("%s is not in apiOperations", step.operation) }
+		called[step.operation] = true
+		if step.request != nil && reflect.TypeOf(step.request) != reflect.TypeOf(op.Request) {
+			t.Fatalf("%s: the request is a %T, but apiOperations describes a %T", step.operation, step.request, op.Request)
+		}
+
+		method, _, _ := strings.Cut(step.operation, " ")
+		header := http.Header{}
+		if step.operation == "POST /api/v1/checkout" { header.Set("Idempotency-Key", cartBody.CheckoutKey) }
+		path := strings.ReplaceAll(step.path, "{order_id}", placed.OrderID.String())
+		resp, body := doJSON(t, step.client, method, server.URL+path, step.request, header)
+		if resp.StatusCode != op.Status { t.Fatalf("%s: status %d, want %d: %s", step.operation, resp.StatusCode, op.Status, body) }
+		if op.Response == nil {
+			if len(body) > 0 { t.Errorf("%s: responded with a body, but apiOperations describes none: %s", step.operation, body) }
+			continue
+		}
+
+		// Decode the response into a new value of the response type of the operation
+		response := reflect.New(reflect.TypeOf(op.Response)).Interface()
+		if op.Raw {
+			decodeStrict(t, body, response)
+		} else {
+			decodeData(t, body, response)
+		}
+		if op.List {
+			var list struct {
+				Pagination *apiPagination `json:"pagination"`
+			}
+			if err := json.Unmarshal(body, &list); err != nil || list.Pagination == nil { t.Errorf("%s: the list has no pagination: %s", step.operation, body) }
+		}
+		if step.response != nil { decodeData(t, body, step.response) }
+	}
+
+	for operation := range apiOperations {
+		if !called[operation] { t.Errorf("%s is not tested", operation) }
+	}
+}
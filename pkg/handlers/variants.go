@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+)
+
+/*** Helper Functions ***/
+
+// Renders the variants view of a product with a message (empty for none) shown in an alert of the type (e.g. success).
+func (h *Handler) renderVariants(w http.ResponseWriter, productID uuid.UUID, message, alertType string) {
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	optionNames := make([]string, len(product.Options))
+	for i, option := range product.Options {
+		optionNames[i] = option.Name
+	}
+
+	data := struct {
+		Product     *models.Product
+		OptionNames string
+		Message     string
+		AlertType   string
+	}{
+		Product:     product,
+		OptionNames: strings.Join(optionNames, ", "),
+		Message:     message,
+		AlertType:   alertType,
+	}
+	tmpl.ExecuteTemplate(w, "productVariants", data)
+}
+
+// Reads the fields of a variant row (SKU, price, stock and one value per option of the product). It returns the message
+// of the first invalid field.
+func readVariantForm(r *http.Request, product *models.Product, variant *models.ProductVariant) string {
+	variant.SKU = strings.TrimSpace(r.FormValue("sku"))
+	if variant.SKU == "" { return "The SKU Is Required" }
+
+	variant.PriceOverride = nil
+	if priceStr := strings.TrimSpace(r.FormValue("price")); priceStr != "" {
+		price, err := models.ParseMoney(priceStr)
+		if err != nil || price < 0 { return "Invalid Price" }
+		variant.PriceOverride = &price
+	}
+
+	stock, err := strconv.Atoi(r.FormValue("stock"))
+	if err != nil || stock < 0 { return "Invalid Stock" }
+	variant.Stock = stock
+
+	variant.Values = make([]string, len(product.Options))
+	for i, option := range product.Options {
+		variant.Values[i] = strings.TrimSpace(r.FormValue("option_" + option.OptionID.String()))
+		if variant.Values[i] == "" { return "Enter The " + option.Name + " Of The Variant" }
+	}
+
+	// Two variants with the same values could not be told apart by the shoppers
+	for _, other := range product.Variants {
+		if other.VariantID != variant.VariantID && other.Label() == variant.Label() {
+			return "Another Variant Is Already " + variant.Label()
+		}
+	}
+	return ""
+}
+
+// Returns the message shown to the admin for an error saving a variant.
+func variantErrorMessage(err error) string {
+	switch err {
+		case repository.ErrSKUTaken:
+			return "Another Variant Already Uses This SKU"
+		case repository.ErrVariantValues:
+			return "Enter A Value For Every Option"
+		case sql.ErrNoRows:
+			return "The Variant Does Not Exist"
+		default:
+			return "Error Saving The Variant: " + err.Error()
+	}
+}
+
+/*** Handlers ***/
+
+// Renders the options and variants of a product.
+func (h *Handler) ProductVariantsView(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	h.renderVariants(w, productID, "", "")
+}
+
+// Replaces the options of a product (e.g. "Size, Colour") with the comma separated names of the form.
+func (h *Handler) UpdateProductOptions(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var names []string
+	seen := map[string]bool{}
+	for _, name := range strings.Split(r.FormValue("options"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" { continue }
+		if seen[strings.ToLower(name)] {
+			h.renderVariants(w, productID, "The Option "+name+" Is Repeated", "danger")
+			return
+		}
+		seen[strings.ToLower(name)] = true
+		names = append(names, name)
+	}
+
+	if err = h.Repo.Variant.SetProductOptions(productID, names); err != nil {
+		h.renderVariants(w, productID, "Error Saving The Options: "+err.Error(), "danger")
+		return
+	}
+	h.renderVariants(w, productID, "Options saved", "success")
+}
+
+// Creates a new variant of a product.
+func (h *Handler) CreateVariant(w http.ResponseWriter, r *http.Request) {
+	productID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	variant := models.ProductVariant{ProductID: productID}
+	if message := readVariantForm(r, product, &variant); message != "" {
+		h.renderVariants(w, productID, message, "danger")
+		return
+	}
+
+	if err = h.Repo.Variant.CreateVariant(&variant); err != nil {
+		h.renderVariants(w, productID, variantErrorMessage(err), "danger")
+		return
+	}
+	h.renderVariants(w, productID, "Variant "+variant.Label()+" added", "success")
+}
+
+// Updates a variant of a product.
+func (h *Handler) UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	variantID, err := uuid.Parse(vars["variant_id"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.Repo.Product.GetProductByID(productID)
+	if err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	variant := models.ProductVariant{VariantID: variantID, ProductID: productID}
+	if message := readVariantForm(r, product, &variant); message != "" {
+		h.renderVariants(w, productID, message, "danger")
+		return
+	}
+
+	if err = h.Repo.Variant.UpdateVariant(&variant); err != nil {
+		h.renderVariants(w, productID, variantErrorMessage(err), "danger")
+		return
+	}
+	h.renderVariants(w, productID, "Variant "+variant.Label()+" saved", "success")
+}
+
+// Deletes a variant of a product (and removes it from the carts).
+func (h *Handler) DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	productID, err := uuid.Parse(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	variantID, err := uuid.Parse(vars["variant_id"])
+	if err != nil {
+		http.Error(w, "Invalid variant ID", http.StatusBadRequest)
+		return
+	}
+
+	if err = h.Repo.Variant.DeleteVariant(productID, variantID); err != nil {
+		h.renderVariants(w, productID, "Error Deleting The Variant: "+err.Error(), "danger")
+		return
+	}
+	h.renderVariants(w, productID, "Variant deleted", "success")
+}
@@ -0,0 +1,215 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Decoders of the accepted formats
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+/*** Constants ***/
+const MaxPixels = 40_000_000 // Maximum number of pixels of an upload, so a small file can not expand into a huge image
+const jpegQuality = 85        // Quality of the encoded JPEG files
+
+/*** Errors ***/
+var ErrNotImage = errors.New("the file is not a JPEG, PNG, GIF or WebP image")                   // Returned when the content of a file is not an image
+var ErrTooManyPixels = fmt.Errorf("the image is bigger than %d megapixels", MaxPixels/1_000_000) // Returned when an image has more than MaxPixels
+
+/*** Structs ***/
+
+// Custom type that represents a size in which the uploaded images are saved.
+type Size struct {
+	Name  string // Part of the file name of the size (e.g. "card" in "<id>.card.jpg")
+	Width int    // Maximum width (pixels), smaller images are not enlarged
+}
+
+// Sizes in which every uploaded image is saved (smallest first). The name of the full size is the one stored in the database.
+var Sizes = []Size{
+	{Name: "thumb", Width: 160},
+	{Name: "card", Width: 480},
+	{Name: "full", Width: 1200},
+}
+
+// Custom type that contains an uploaded image encoded in every size.
+type Processed struct {
+	Ext   string            // Extension of the files (".jpg" for opaque images, ".png" for images with transparency)
+	Files map[string][]byte // Encoded image by size name
+}
+
+/*** Functions ***/
+
+// Function that decodes an uploaded image (the format is detected from the content, not the file name), applies its EXIF
+// orientation and encodes it again in every size. The files do not keep any metadata of the upload (e.g. EXIF GPS data).
+// It returns ErrNotImage if the content is not an image and ErrTooManyPixels if the image is too big.
+func Process(r io.Reader) (*Processed, error) {
+	data, err := io.ReadAll(r)
+	if err != nil { return nil, err }
+
+	// Check the dimensions before decoding the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil { return nil, ErrNotImage }
+	if config.Width <= 0 || config.Height <= 0 { return nil, ErrNotImage }
+	if int64(config.Width)*int64(config.Height) > MaxPixels { return nil, ErrTooManyPixels }
+
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil { return nil, ErrNotImage }
+
+	img := image.NewNRGBA(decoded.Bounds().Sub(decoded.Bounds().Min))
+	draw.Draw(img, img.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+	img = orient(img, jpegOrientation(data))
+
+	processed := &Processed{Ext: ".jpg", Files: map[string][]byte{}}
+	if !img.Opaque() { processed.Ext = ".png" }
+
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		resized := resize(img, size.Width)
+		if processed.Ext == ".png" {
+			err = png.Encode(&buf, resized)
+		} else {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: jpegQuality})
+		}
+		if err != nil { return nil, err }
+		processed.Files[size.Name] = buf.Bytes()
+	}
+	return processed, nil
+}
+
+// Function that returns the name of the file of a size of an image (e.g. "<id>.card.jpg"), given its ID.
+func FileName(id, size, ext string) string {
+	return id + "." + size + ext
+}
+
+// Function that returns the name of the file of a size of an image, given the name stored in the database (the full size).
+// Images uploaded before they were processed have a single file, which is returned for every size.
+func SizeFileName(filename, size string) string {
+	base, ext, ok := splitFileName(filename)
+	if !ok { return filename }
+	return FileName(base, size, ext)
+}
+
+// Function that returns the names of every file of an image, given the name stored in the database.
+func FileNames(filename string) []string {
+	base, ext, ok := splitFileName(filename)
+	if !ok { return []string{filename} }
+
+	names := make([]string, len(Sizes))
+	for i, size := range Sizes {
+		names[i] = FileName(base, size.Name, ext)
+	}
+	return names
+}
+
+// Function that returns whether an image (by the name stored in the database) is saved in every size.
+func HasSizes(filename string) bool {
+	_, _, ok := splitFileName(filename)
+	return ok
+}
+
+/*** Helper Functions ***/
+
+// Splits the name of the full size file of a processed image into its ID and extension.
+func splitFileName(filename string) (string, string, bool) {
+	full := "." + Sizes[len(Sizes)-1].Name + "."
+	i := strings.LastIndex(filename, full)
+	if i <= 0 { return "", "", false }
+	return filename[:i], filename[i+len(full)-1:], true
+}
+
+// Returns the image scaled down to the width (keeping its aspect ratio), or the image itself if it is not wider.
+func resize(img *image.NRGBA, width int) image.Image {
+	bounds := img.Bounds()
+	if bounds.Dx() <= width { return img }
+
+	height := max(1, bounds.Dy()*width/bounds.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, xdraw.Src, nil)
+	return dst
+}
+
+// Returns the image rotated and flipped by an EXIF orientation (1 to 8), so it is shown upright once the EXIF data is gone.
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 { return img }
+
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 { dw, dh = h, w } // Orientations 5 to 8 swap the width and height
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+				case 2: // Mirrored horizontally
+					sx, sy = w-1-x, y
+				case 3: // Rotated 180°
+					sx, sy = w-1-x, h-1-y
+				case 4: // Mirrored vertically
+					sx, sy = x, h-1-y
+				case 5: // Transposed
+					sx, sy = y, x
+				case 6: // Rotated 90° clockwise
+					sx, sy = y, h-1-x
+				case 7: // Transversed
+					sx, sy = w-1-y, h-1-x
+				case 8: // Rotated 90° counterclockwise
+					sx, sy = w-1-y, x
+			}
+			dst.SetNRGBA(x, y, img.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// Returns the EXIF orientation of a JPEG file (0 if it is not a JPEG or has no orientation).
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 { return 0 }
+
+	// Walk the segments until the APP1 (EXIF) segment or the start of the image data
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF { return 0 }
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if marker == 0xDA || length < 2 || i+2+length > len(data) { return 0 }
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) { return exifOrientation(segment[6:]) }
+		i += 2 + length
+	}
+	return 0
+}
+
+// Returns the orientation tag of the first IFD of the TIFF data of an EXIF segment (0 if it has none).
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 { return 0 }
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+		case "II":
+			order = binary.LittleEndian
+		case "MM":
+			order = binary.BigEndian
+		default:
+			return 0
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) { return 0 }
+	entries := int(order.Uint16(tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiff) { return 0 }
+		if order.Uint16(tiff[entry:]) == 0x0112 { return int(order.Uint16(tiff[entry+8:])) }
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"testing"
+)
+
+/*** Global Variables ***/
+var testColors = map[string]color.NRGBA{ // Colors of the quadrants of the test image
+	"red":   {R: 255, A: 255},
+	"green": {G: 255, A: 255},
+	"blue":  {B: 255, A: 255},
+	"white": {R: 255, G: 255, B: 255, A: 255},
+}
+
+/*** Helper Functions ***/
+
+// Returns a 32x16 image whose top left, top right, bottom left and bottom right quadrants are red, green, blue and white.
+func testImage() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			switch {
+				case x < 16 && y < 8:
+					img.SetNRGBA(x, y, testColors["red"])
+				case y < 8:
+					img.SetNRGBA(x, y, testColors["green"])
+				case x < 16:
+					img.SetNRGBA(x, y, testColors["blue"])
+				default:
+					img.SetNRGBA(x, y, testColors["white"])
+			}
+		}
+	}
+	return img
+}
+
+// Returns the TIFF data of an EXIF segment whose first IFD has the orientation tag.
+func exifTIFF(order binary.AppendByteOrder, orientation uint16) []byte {
+	tiff := []byte("II")
+	if order == binary.BigEndian { tiff = []byte("MM") }
+	tiff = order.AppendUint16(tiff, 42)
+	tiff = order.AppendUint32(tiff, 8) // Offset of the first IFD
+	tiff = order.AppendUint16(tiff, 1) // Number of entries
+	tiff = order.AppendUint16(tiff, 0x0112)
+	tiff = order.AppendUint16(tiff, 3) // SHORT
+	tiff = order.AppendUint32(tiff, 1)
+	tiff = order.AppendUint16(tiff, orientation)
+	tiff = order.AppendUint16(tiff, 0)
+	return order.AppendUint32(tiff, 0) // No next IFD
+}
+
+// Returns a JPEG file of the test image with an APP1 segment right after the start of the image.
+func jpegWithAPP1(t *testing.T, payload []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(), &jpeg.Options{Quality: 100}); err != nil { t.Fatal(err) }
+	data := buf.Bytes()
+
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(2+len(payload)))
+	segment = append(segment, payload...)
+	return slices.Concat(data[:2], segment, data[2:])
+}
+
+// Returns the name of the test color closest to the color.
+func closestColor(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	closest, distance := "", -1
+	for name, test := range testColors {
+		tr, tg, tb, _ := test.RGBA()
+		d := abs(int(r)-int(tr)) + abs(int(g)-int(tg)) + abs(int(b)-int(tb))
+		if distance < 0 || d < distance { closest, distance = name, d }
+	}
+	return closest
+}
+
+// Returns the absolute value of an integer.
+func abs(n int) int {
+	if n < 0 { return -n }
+	return n
+}
+
+/*** Tests ***/
+
+// Tests that every EXIF orientation (in both byte orders) turns the image upright: the width and height are swapped by the
+// orientations 5 to 8 and the quadrants end up in their place.
+func TestProcessOrientation(t *testing.T) {
+	tests := []struct {
+		orientation uint16
+		width       int
+		height      int
+		quadrants   [4]string // Colors of the top left, top right, bottom left and bottom right quadrants
+	}{
+		{orientation: 1, width: 32, height: 16, quadrants: [4]string{"red", "green", "blue", "white"}},
+		{orientation: 2, width: 32, height: 16, quadrants: [4]string{"green", "red", "white", "blue"}},
+		{orientation: 3, width: 32, height: 16, quadrants: [4]string{"white", "blue", "green", "red"}},
+		{orientation: 4, width: 32, height: 16, quadrants: [4]string{"blue", "white", "red", "green"}},
+		{orientation: 5, width: 16, height: 32, quadrants: [4]string{"red", "blue", "green", "white"}},
+		{orientation: 6, width: 16, height: 32, quadrants: [4]string{"blue", "red", "white", "green"}},
+		{orientation: 7, width: 16, height: 32, quadrants: [4]string{"white", "green", "blue", "red"}},
+		{orientation: 8, width: 16, height: 32, quadrants: [4]string{"green", "white", "red", "blue"}},
+		{orientation: 9, width: 32, height: 16, quadrants: [4]string{"red", "green", "blue", "white"}}, // Not an orientation
+	}
+	for _, test := range tests {
+		for _, order := range []binary.AppendByteOrder{binary.LittleEndian, binary.BigEndian} {
+			data := jpegWithAPP1(t, append([]byte("Exif\x00\x00"), exifTIFF(order, test.orientation)...))
+			processed, err := Process(bytes.NewReader(data))
+			if err != nil { t.Fatalf("orientation %d (%s): %v", test.orientation, order, err) }
+			if processed.Ext != ".jpg" { t.Errorf("orientation %d (%s): extension %q, want .jpg", test.orientation, order, processed.Ext) }
+
+			img, err := jpeg.Decode(bytes.NewReader(processed.Files["full"]))
+			if err != nil { t.Fatalf("orientation %d (%s): decoding the full size: %v", test.orientation, order, err) }
+			w, h := img.Bounds().Dx(), img.Bounds().Dy()
+			if w != test.width || h != test.height {
+				t.Errorf("orientation %d (%s): %dx%d, want %dx%d", test.orientation, order, w, h, test.width, test.height)
+				continue
+			}
+			got := [4]string{
+				closestColor(img.At(w/4, h/4)), closestColor(img.At(w*3/4, h/4)),
+				closestColor(img.At(w/4, h*3/4)), closestColor(img.At(w*3/4, h*3/4)),
+			}
+			if got != test.quadrants { t.Errorf("orientation %d (%s): quadrants %v, want %v", test.orientation, order, got, test.quadrants) }
+		}
+	}
+}
+
+// Tests that a truncated or garbage EXIF segment is read as no orientation instead of panicking, and that the image is
+// still processed when the rest of the file is valid.
+func TestProcessBadEXIF(t *testing.T) {
+	valid := exifTIFF(binary.LittleEndian, 6)
+	tests := []struct {
+		name    string
+		payload []byte // Content of the APP1 segment
+	}{
+		{name: "empty segment", payload: nil},
+		{name: "not EXIF", payload: []byte("http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>")},
+		{name: "EXIF header only", payload: []byte("Exif\x00\x00")},
+		{name: "unknown byte order", payload: append([]byte("Exif\x00\x00XX"), valid[2:]...)},
+		{name: "IFD offset past the end", payload: append([]byte("Exif\x00\x00"), binary.LittleEndian.AppendUint32([]byte("II*\x00"), 0xFFFFFFF0)...)},
+		{name: "more entries than data", payload: append([]byte("Exif\x00\x00"), binary.LittleEndian.AppendUint16(slices.Clone(valid[:8]), 0xFFFF)...)},
+		{name: "truncated entry", payload: append([]byte("Exif\x00\x00"), valid[:len(valid)-10]...)},
+		{name: "garbage", payload: []byte("Exif\x00\x00\xFF\xD8\xFF\xE1\x00\x02\x00\x00\x00\x00")},
+	}
+	for _, test := range tests {
+		data := jpegWithAPP1(t, test.payload)
+		if orientation := jpegOrientation(data); orientation != 0 { t.Errorf("%s: orientation %d, want 0", test.name, orientation) }
+
+		processed, err := Process(bytes.NewReader(data))
+		if err != nil { t.Errorf("%s: %v", test.name, err); continue }
+		img, err := jpeg.Decode(bytes.NewReader(processed.Files["full"]))
+		if err != nil { t.Fatalf("%s: decoding the full size: %v", test.name, err) }
+		if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 32 || h != 16 { t.Errorf("%s: %dx%d, want the image as it is (32x16)", test.name, w, h) }
+	}
+
+	// Every truncation of a file with a valid EXIF segment, including in the middle of the segment
+	data := jpegWithAPP1(t, append([]byte("Exif\x00\x00"), valid...))
+	for n := range 80 {
+		jpegOrientation(data[:n])
+		if _, err := Process(bytes.NewReader(data[:n])); !errors.Is(err, ErrNotImage) { t.Errorf("first %d bytes: error %v, want ErrNotImage", n, err) }
+	}
+
+	// A segment longer than the file
+	truncated := slices.Concat(data[:2], []byte{0xFF, 0xE1, 0xFF, 0xFF}, []byte("Exif\x00\x00"), valid)
+	if orientation := jpegOrientation(truncated); orientation != 0 { t.Errorf("segment longer than the file: orientation %d, want 0", orientation) }
+}
+
+// Tests that the format is detected from the content and not from the name of the file: an image with the extension of
+// another format is processed, a file that is not an image is rejected whatever its extension, and the extension of the
+// saved files only depends on whether the image has transparency.
+func TestProcessExtensionMismatch(t *testing.T) {
+	var opaquePNG, transparentPNG, jpegFile bytes.Buffer
+	if err := png.Encode(&opaquePNG, testImage()); err != nil { t.Fatal(err) }
+	if err := png.Encode(&transparentPNG, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil { t.Fatal(err) }
+	if err := jpeg.Encode(&jpegFile, testImage(), nil); err != nil { t.Fatal(err) }
+
+	tests := []struct {
+		name    string // Name of the uploaded file
+		content []byte
+		ext     string // Extension of the saved files, empty if the file is rejected
+	}{
+		{name: "photo.jpg", content: opaquePNG.Bytes(), ext: ".jpg"},
+		{name: "photo.gif", content: transparentPNG.Bytes(), ext: ".png"},
+		{name: "photo.png", content: jpegFile.Bytes(), ext: ".jpg"},
+		{name: "photo.jpg", content: []byte("<html><script>alert(1)</script></html>")},
+		{name: "photo.png", content: jpegFile.Bytes()[:len(jpegFile.Bytes())/2]},
+	}
+	for _, test := range tests {
+		processed, err := Process(bytes.NewReader(test.content))
+		if test.ext == "" {
+			if !errors.Is(err, ErrNotImage) { t.Errorf("%s: error %v, want ErrNotImage", test.name, err) }
+			continue
+		}
+		if err != nil { t.Errorf("%s: %v", test.name, err); continue }
+		if processed.Ext != test.ext { t.Errorf("%s: extension %q, want %q", test.name, processed.Ext, test.ext) }
+		if len(processed.Files) != len(Sizes) { t.Errorf("%s: %d sizes, want %d", test.name, len(processed.Files), len(Sizes)) }
+	}
+}
+
+// Tests the names of the files of the sizes of an image, given the name stored in the database, for processed images and
+// for the single file of the images uploaded before they were processed.
+func TestFileNames(t *testing.T) {
+	tests := []struct {
+		filename string
+		sizes    bool   // Whether the image is saved in every size
+		card     string // Name of the card size
+	}{
+		{filename: "abc.full.jpg", sizes: true, card: "abc.card.jpg"},
+		{filename: "abc.full.png", sizes: true, card: "abc.card.png"},
+		{filename: "a.full.b.full.jpg", sizes: true, card: "a.full.b.card.jpg"},
+		{filename: "legacy.jpg", card: "legacy.jpg"},
+		{filename: "abc.card.jpg", card: "abc.card.jpg"},
+		{filename: ".full.jpg", card: ".full.jpg"},
+		{filename: "abc.full", card: "abc.full"},
+	}
+	for _, test := range tests {
+		if got := HasSizes(test.filename); got != test.sizes { t.Errorf("HasSizes(%q) = %t, want %t", test.filename, got, test.sizes) }
+		if got := SizeFileName(test.filename, "card"); got != test.card { t.Errorf("SizeFileName(%q, card) = %q, want %q", test.filename, got, test.card) }
+
+		names := FileNames(test.filename)
+		if !test.sizes {
+			if !slices.Equal(names, []string{test.filename}) { t.Errorf("FileNames(%q) = %q, want the file itself", test.filename, names) }
+			continue
+		}
+		if len(names) != len(Sizes) { t.Errorf("FileNames(%q) = %q, want one per size", test.filename, names); continue }
+		for i, size := range Sizes {
+			if want := SizeFileName(test.filename, size.Name); names[i] != want { t.Errorf("FileNames(%q)[%d] = %q, want %q", test.filename, i, names[i], want) }
+		}
+		if names[len(names)-1] != test.filename { t.Errorf("FileNames(%q) does not end with the full size", test.filename) }
+	}
+}
@@ -0,0 +1,263 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Embedded SQL migrations. Each version has an up file (NNNN_name.up.sql) and a down file (NNNN_name.down.sql).
+//go:embed sql/*.sql
+var files embed.FS
+
+/*** Constants ***/
+const lockName = "ecommerce_schema_migrations" // Name of the MySQL lock that stops two instances from migrating at the same time
+const lockTimeoutSeconds = 60                  // Time to wait for another instance to finish migrating
+
+// Returned when migrating to a version that does not exist.
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// Custom type that represents a versioned schema change with the SQL that applies it (up) and reverts it (down).
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Custom type that represents a migration and whether it has been applied to the database.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Custom type that holds a pointer to the database connection and the migrations (sorted by version).
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []Migration
+}
+
+// Function that returns a new Migrator (pointer) with the database connection and the embedded migrations.
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := load(files, "sql")
+	if err != nil { return nil, err }
+	return &Migrator{DB: db, Migrations: migrations}, nil
+}
+
+// Reads the migrations of a directory, pairing the up and down files of each version.
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil { return nil, err }
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		var direction string
+		switch {
+			case strings.HasSuffix(name, ".up.sql"):
+				direction = "up"
+			case strings.HasSuffix(name, ".down.sql"):
+				direction = "down"
+			default:
+				continue
+		}
+
+		versionStr, rest, ok := strings.Cut(name, "_")
+		if !ok { return nil, fmt.Errorf("migration %s: file name must be NNNN_name.%s.sql", name, direction) }
+		version, err := strconv.Atoi(versionStr)
+		if err != nil { return nil, fmt.Errorf("migration %s: invalid version: %v", name, err) }
+
+		content, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil { return nil, err }
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(rest, "."+direction+".sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	var migrations []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" { return nil, fmt.Errorf("migration %04d_%s: missing up or down file", m.Version, m.Name) }
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Method that creates the table that records the applied migrations (if it does not exist).
+func (m *Migrator) ensureTable() error {
+	_, err := m.DB.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INT          NOT NULL,
+		name       VARCHAR(255) NOT NULL,
+		applied_at DATETIME     NOT NULL,
+		PRIMARY KEY (version)
+	)`)
+	return err
+}
+
+// Method that returns the applied migrations (version and date applied).
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil { return nil, err }
+
+	rows, err := m.DB.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil { return nil, err }
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// Method that returns every migration and whether it has been applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil { return nil, err }
+
+	statuses := make([]MigrationStatus, len(m.Migrations))
+	for i, migration := range m.Migrations {
+		appliedAt, ok := applied[migration.Version]
+		statuses[i] = MigrationStatus{Migration: migration, Applied: ok, AppliedAt: appliedAt}
+	}
+	return statuses, nil
+}
+
+// Method that returns the version of the latest applied migration (0 if none has been applied).
+func (m *Migrator) Version() (int, error) {
+	applied, err := m.applied()
+	if err != nil { return 0, err }
+
+	version := 0
+	for v := range applied {
+		if v > version { version = v }
+	}
+	return version, nil
+}
+
+// Method that applies every pending migration. It returns the number of applied migrations.
+func (m *Migrator) Up() (int, error) {
+	if len(m.Migrations) == 0 { return 0, nil }
+	return m.To(m.Migrations[len(m.Migrations)-1].Version)
+}
+
+// Method that reverts the latest applied migration. It returns the number of reverted migrations (0 if none was applied).
+func (m *Migrator) Down() (int, error) {
+	version, err := m.Version()
+	if err != nil || version == 0 { return 0, err }
+
+	previous := 0
+	for _, migration := range m.Migrations {
+		if migration.Version < version { previous = migration.Version }
+	}
+	return m.To(previous)
+}
+
+// Method that applies or reverts migrations until the schema is at the version (0 reverts every migration).
+// It returns the number of applied or reverted migrations.
+func (m *Migrator) To(version int) (int, error) {
+	known := version == 0
+	for _, migration := range m.Migrations {
+		if migration.Version == version { known = true }
+	}
+	if !known { return 0, ErrUnknownVersion }
+
+	unlock, err := m.lock()
+	if err != nil { return 0, err }
+	defer unlock()
+
+	applied, err := m.applied()
+	if err != nil { return 0, err }
+
+	count := 0
+
+	// Revert the applied migrations newer than the version (newest first)
+	for i := len(m.Migrations) - 1; i >= 0; i-- {
+		migration := m.Migrations[i]
+		if _, ok := applied[migration.Version]; !ok || migration.Version <= version { continue }
+		if err := m.run(migration, migration.Down); err != nil { return count, err }
+		if _, err := m.DB.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version); err != nil { return count, err }
+		count++
+	}
+
+	// Apply the pending migrations up to the version (oldest first)
+	for _, migration := range m.Migrations {
+		if _, ok := applied[migration.Version]; ok || migration.Version > version { continue }
+		if err := m.run(migration, migration.Up); err != nil { return count, err }
+		_, err := m.DB.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			migration.Version, migration.Name, time.Now())
+		if err != nil { return count, err }
+		count++
+	}
+
+	return count, nil
+}
+
+// Method that runs the statements of a migration file one by one (MySQL does not run several statements in one call
+// and commits schema changes implicitly, so a migration that fails halfway must be fixed by hand).
+func (m *Migrator) run(migration Migration, script string) error {
+	for _, statement := range splitStatements(script) {
+		if _, err := m.DB.Exec(statement); err != nil {
+			return fmt.Errorf("migration %04d_%s: %v", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// Method that takes a MySQL named lock so only one instance migrates at a time. It returns the function that releases it.
+func (m *Migrator) lock() (func(), error) {
+	ctx := context.Background()
+	conn, err := m.DB.Conn(ctx)
+	if err != nil { return nil, err }
+
+	var locked sql.NullInt64
+	if err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName, lockTimeoutSeconds).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if locked.Int64 != 1 {
+		conn.Close()
+		return nil, errors.New("timed out waiting for another instance to finish migrating")
+	}
+
+	return func() {
+		conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", lockName)
+		conn.Close()
+	}, nil
+}
+
+// Splits a SQL script into statements on the semicolons that end a line.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") { continue }
+		current.WriteString(line + "\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(current.String()), ";"))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" { statements = append(statements, rest) }
+	return statements
+}
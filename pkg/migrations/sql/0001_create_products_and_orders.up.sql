@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS products (
+    product_id    CHAR(36)      NOT NULL,
+    product_name  VARCHAR(255)  NOT NULL,
+    price         DECIMAL(10,2) NOT NULL,
+    description   TEXT          NOT NULL,
+    product_image VARCHAR(255)  NOT NULL DEFAULT '',
+    date_created  DATETIME      NOT NULL,
+    date_modified DATETIME      NOT NULL,
+    PRIMARY KEY (product_id),
+    INDEX idx_products_date_created (date_created)
+);
+
+CREATE TABLE IF NOT EXISTS orders (
+    order_id     CHAR(36)     NOT NULL,
+    user_id      VARCHAR(255) NOT NULL,
+    order_status VARCHAR(50)  NOT NULL,
+    order_date   DATETIME     NOT NULL,
+    PRIMARY KEY (order_id),
+    INDEX idx_orders_order_date (order_date)
+);
+
+CREATE TABLE IF NOT EXISTS order_items (
+    order_id   CHAR(36)      NOT NULL,
+    product_id CHAR(36)      NOT NULL,
+    quantity   INT           NOT NULL,
+    cost       DECIMAL(10,2) NOT NULL DEFAULT 0,
+    PRIMARY KEY (order_id, product_id),
+    CONSTRAINT fk_order_items_order FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
@@ -0,0 +1,19 @@
+CREATE TABLE carts (
+    cart_id       CHAR(36)    NOT NULL,
+    session_id    VARCHAR(64) NOT NULL,
+    date_created  DATETIME    NOT NULL,
+    date_modified DATETIME    NOT NULL,
+    PRIMARY KEY (cart_id),
+    UNIQUE KEY uq_carts_session_id (session_id),
+    INDEX idx_carts_date_modified (date_modified)
+);
+
+CREATE TABLE cart_items (
+    cart_id    CHAR(36) NOT NULL,
+    product_id CHAR(36) NOT NULL,
+    quantity   INT      NOT NULL,
+    date_added DATETIME NOT NULL,
+    PRIMARY KEY (cart_id, product_id),
+    CONSTRAINT fk_cart_items_cart FOREIGN KEY (cart_id) REFERENCES carts (cart_id) ON DELETE CASCADE,
+    CONSTRAINT fk_cart_items_product FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE
+);
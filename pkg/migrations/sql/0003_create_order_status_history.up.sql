@@ -0,0 +1,11 @@
+CREATE TABLE order_status_history (
+    id           BIGINT       NOT NULL AUTO_INCREMENT,
+    order_id     CHAR(36)     NOT NULL,
+    from_status  VARCHAR(50)  NOT NULL,
+    to_status    VARCHAR(50)  NOT NULL,
+    changed_by   VARCHAR(255) NOT NULL,
+    date_changed DATETIME     NOT NULL,
+    PRIMARY KEY (id),
+    INDEX idx_order_status_history_order_id (order_id),
+    CONSTRAINT fk_order_status_history_order FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
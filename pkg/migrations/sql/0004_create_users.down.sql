@@ -0,0 +1,6 @@
+UPDATE orders SET user_id = '' WHERE user_id IS NULL;
+ALTER TABLE orders MODIFY COLUMN user_id VARCHAR(255) NOT NULL;
+
+ALTER TABLE carts DROP INDEX uq_carts_user_id, DROP COLUMN user_id;
+
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,13 @@
+CREATE TABLE users (
+    user_id       CHAR(36)     NOT NULL,
+    email         VARCHAR(255) NOT NULL,
+    full_name     VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    date_created  DATETIME     NOT NULL,
+    PRIMARY KEY (user_id),
+    UNIQUE KEY uq_users_email (email)
+);
+
+ALTER TABLE carts ADD COLUMN user_id CHAR(36) NULL AFTER session_id, ADD UNIQUE KEY uq_carts_user_id (user_id);
+
+ALTER TABLE orders MODIFY COLUMN user_id VARCHAR(255) NULL;
@@ -0,0 +1,10 @@
+CREATE TABLE admin_users (
+    admin_id      CHAR(36)     NOT NULL,
+    email         VARCHAR(255) NOT NULL,
+    full_name     VARCHAR(255) NOT NULL,
+    password_hash VARCHAR(255) NOT NULL,
+    role          VARCHAR(50)  NOT NULL,
+    date_created  DATETIME     NOT NULL,
+    PRIMARY KEY (admin_id),
+    UNIQUE KEY uq_admin_users_email (email)
+);
@@ -0,0 +1 @@
+ALTER TABLE products ADD COLUMN stock INT NOT NULL DEFAULT 0 AFTER price;
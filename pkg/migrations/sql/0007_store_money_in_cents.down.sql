@@ -0,0 +1,9 @@
+ALTER TABLE products ADD COLUMN price_decimal DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER price;
+UPDATE products SET price_decimal = price / 100;
+ALTER TABLE products DROP COLUMN price;
+ALTER TABLE products RENAME COLUMN price_decimal TO price;
+
+ALTER TABLE order_items ADD COLUMN cost_decimal DECIMAL(10,2) NOT NULL DEFAULT 0 AFTER cost;
+UPDATE order_items SET cost_decimal = cost / 100;
+ALTER TABLE order_items DROP COLUMN cost;
+ALTER TABLE order_items RENAME COLUMN cost_decimal TO cost;
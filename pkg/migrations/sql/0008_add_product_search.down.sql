@@ -0,0 +1,3 @@
+ALTER TABLE products DROP INDEX ft_products_name_description;
+
+ALTER TABLE products DROP INDEX ft_products_name;
@@ -0,0 +1,3 @@
+ALTER TABLE products ADD FULLTEXT INDEX ft_products_name (product_name);
+
+ALTER TABLE products ADD FULLTEXT INDEX ft_products_name_description (product_name, description);
@@ -0,0 +1,20 @@
+CREATE TABLE categories (
+    category_id   CHAR(36)     NOT NULL,
+    parent_id     CHAR(36)     NULL,
+    name          VARCHAR(255) NOT NULL,
+    description   TEXT         NOT NULL,
+    date_created  DATETIME     NOT NULL,
+    date_modified DATETIME     NOT NULL,
+    PRIMARY KEY (category_id),
+    INDEX idx_categories_parent_id (parent_id),
+    CONSTRAINT fk_categories_parent FOREIGN KEY (parent_id) REFERENCES categories (category_id)
+);
+
+CREATE TABLE product_categories (
+    product_id  CHAR(36) NOT NULL,
+    category_id CHAR(36) NOT NULL,
+    PRIMARY KEY (product_id, category_id),
+    INDEX idx_product_categories_category_id (category_id),
+    CONSTRAINT fk_product_categories_product FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE,
+    CONSTRAINT fk_product_categories_category FOREIGN KEY (category_id) REFERENCES categories (category_id)
+);
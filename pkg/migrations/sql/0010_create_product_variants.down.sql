@@ -0,0 +1,20 @@
+-- The items of variants can not be kept with the previous primary keys
+DELETE FROM order_items WHERE variant_id != '';
+
+ALTER TABLE order_items
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (order_id, product_id),
+    DROP COLUMN variant_id;
+
+DELETE FROM cart_items WHERE variant_id != '';
+
+ALTER TABLE cart_items
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (cart_id, product_id),
+    DROP COLUMN variant_id;
+
+DROP TABLE product_variant_values;
+
+DROP TABLE product_variants;
+
+DROP TABLE product_options;
@@ -0,0 +1,43 @@
+CREATE TABLE product_options (
+    option_id  CHAR(36)     NOT NULL,
+    product_id CHAR(36)     NOT NULL,
+    name       VARCHAR(100) NOT NULL,
+    position   INT          NOT NULL,
+    PRIMARY KEY (option_id),
+    UNIQUE KEY uq_product_options_name (product_id, name),
+    CONSTRAINT fk_product_options_product FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE
+);
+
+CREATE TABLE product_variants (
+    variant_id    CHAR(36)    NOT NULL,
+    product_id    CHAR(36)    NOT NULL,
+    sku           VARCHAR(64) NOT NULL,
+    price         BIGINT      NULL,
+    stock         INT         NOT NULL DEFAULT 0,
+    date_created  DATETIME    NOT NULL,
+    date_modified DATETIME    NOT NULL,
+    PRIMARY KEY (variant_id),
+    UNIQUE KEY uq_product_variants_sku (sku),
+    INDEX idx_product_variants_product_id (product_id),
+    CONSTRAINT fk_product_variants_product FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE
+);
+
+CREATE TABLE product_variant_values (
+    variant_id CHAR(36)     NOT NULL,
+    option_id  CHAR(36)     NOT NULL,
+    value      VARCHAR(100) NOT NULL,
+    PRIMARY KEY (variant_id, option_id),
+    CONSTRAINT fk_product_variant_values_variant FOREIGN KEY (variant_id) REFERENCES product_variants (variant_id) ON DELETE CASCADE,
+    CONSTRAINT fk_product_variant_values_option FOREIGN KEY (option_id) REFERENCES product_options (option_id) ON DELETE CASCADE
+);
+
+-- Items of products without variants have an empty variant ID
+ALTER TABLE cart_items
+    ADD COLUMN variant_id CHAR(36) NOT NULL DEFAULT '' AFTER product_id,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (cart_id, product_id, variant_id);
+
+ALTER TABLE order_items
+    ADD COLUMN variant_id CHAR(36) NOT NULL DEFAULT '' AFTER product_id,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (order_id, product_id, variant_id);
@@ -0,0 +1,15 @@
+CREATE TABLE product_images (
+    image_id     CHAR(36)     NOT NULL,
+    product_id   CHAR(36)     NOT NULL,
+    filename     VARCHAR(255) NOT NULL,
+    is_primary   BOOLEAN      NOT NULL DEFAULT FALSE,
+    sort_order   INT          NOT NULL DEFAULT 0,
+    date_created DATETIME     NOT NULL,
+    PRIMARY KEY (image_id),
+    INDEX idx_product_images_product_id (product_id, sort_order),
+    CONSTRAINT fk_product_images_product FOREIGN KEY (product_id) REFERENCES products (product_id) ON DELETE CASCADE
+);
+
+-- The image of every product becomes its primary image (products.product_image keeps the primary image filename)
+INSERT INTO product_images (image_id, product_id, filename, is_primary, sort_order, date_created)
+SELECT UUID(), product_id, product_image, TRUE, 0, date_created FROM products WHERE product_image != '';
@@ -0,0 +1,3 @@
+ALTER TABLE orders
+    DROP INDEX uq_orders_idempotency_key,
+    DROP COLUMN idempotency_key;
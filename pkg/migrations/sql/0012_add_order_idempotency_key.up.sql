@@ -0,0 +1,4 @@
+-- Key of the checkout that placed the order (the ID of the cart), so a retried checkout returns the order instead of placing it again
+ALTER TABLE orders
+    ADD COLUMN idempotency_key CHAR(36) NULL AFTER order_date,
+    ADD UNIQUE KEY uq_orders_idempotency_key (idempotency_key);
@@ -0,0 +1,5 @@
+-- Price of every cart item (in cents) when it was added to the cart or last confirmed by the shopper, so a checkout can
+-- tell the shopper about the prices that changed since
+ALTER TABLE cart_items ADD COLUMN price BIGINT NOT NULL DEFAULT 0 AFTER quantity;
+UPDATE cart_items ci JOIN products p ON ci.product_id = p.product_id SET ci.price = p.price;
+UPDATE cart_items ci JOIN product_variants v ON ci.variant_id = v.variant_id SET ci.price = v.price WHERE v.price IS NOT NULL;
@@ -0,0 +1,33 @@
+-- Address book of the customers
+CREATE TABLE addresses (
+    address_id   CHAR(36)     NOT NULL,
+    user_id      CHAR(36)     NOT NULL,
+    full_name    VARCHAR(255) NOT NULL,
+    line1        VARCHAR(255) NOT NULL,
+    line2        VARCHAR(255) NOT NULL DEFAULT '',
+    city         VARCHAR(100) NOT NULL,
+    region       VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code  VARCHAR(20)  NOT NULL DEFAULT '',
+    country      CHAR(2)      NOT NULL,
+    phone        VARCHAR(30)  NOT NULL DEFAULT '',
+    date_created DATETIME     NOT NULL,
+    PRIMARY KEY (address_id),
+    INDEX idx_addresses_user_id (user_id, date_created),
+    CONSTRAINT fk_addresses_user FOREIGN KEY (user_id) REFERENCES users (user_id) ON DELETE CASCADE
+);
+
+-- Shipping and billing addresses of the orders (copies of the addresses entered at checkout)
+CREATE TABLE order_addresses (
+    order_id     CHAR(36)     NOT NULL,
+    address_type VARCHAR(10)  NOT NULL,
+    full_name    VARCHAR(255) NOT NULL,
+    line1        VARCHAR(255) NOT NULL,
+    line2        VARCHAR(255) NOT NULL DEFAULT '',
+    city         VARCHAR(100) NOT NULL,
+    region       VARCHAR(100) NOT NULL DEFAULT '',
+    postal_code  VARCHAR(20)  NOT NULL DEFAULT '',
+    country      CHAR(2)      NOT NULL,
+    phone        VARCHAR(30)  NOT NULL DEFAULT '',
+    PRIMARY KEY (order_id, address_type),
+    CONSTRAINT fk_order_addresses_order FOREIGN KEY (order_id) REFERENCES orders (order_id) ON DELETE CASCADE
+);
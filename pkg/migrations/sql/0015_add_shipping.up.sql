@@ -0,0 +1,13 @@
+-- Weight (grams) and dimensions (centimetres) of a unit of every product, which the weight based shipping rates use
+ALTER TABLE products
+    ADD COLUMN weight INT NOT NULL DEFAULT 0 AFTER stock,
+    ADD COLUMN length INT NOT NULL DEFAULT 0 AFTER weight,
+    ADD COLUMN width INT NOT NULL DEFAULT 0 AFTER length,
+    ADD COLUMN height INT NOT NULL DEFAULT 0 AFTER width;
+
+-- Shipping method chosen at checkout (its code and name then) and its cost in cents, so the total of the order does not
+-- change with the shipping settings
+ALTER TABLE orders
+    ADD COLUMN shipping_method VARCHAR(50) NOT NULL DEFAULT '' AFTER order_date,
+    ADD COLUMN shipping_name VARCHAR(100) NOT NULL DEFAULT '' AFTER shipping_method,
+    ADD COLUMN shipping_cost BIGINT NOT NULL DEFAULT 0 AFTER shipping_name;
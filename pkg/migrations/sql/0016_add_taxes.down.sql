@@ -0,0 +1,10 @@
+ALTER TABLE orders
+    DROP COLUMN tax_inclusive;
+
+ALTER TABLE order_items
+    DROP COLUMN tax,
+    DROP COLUMN tax_rate,
+    DROP COLUMN tax_name;
+
+ALTER TABLE products
+    DROP COLUMN tax_class;
@@ -0,0 +1,14 @@
+-- Tax class of every product, which chooses the tax rule of the region an order is shipped to
+ALTER TABLE products
+    ADD COLUMN tax_class VARCHAR(20) NOT NULL DEFAULT 'standard' AFTER price;
+
+-- Tax of every order line with the name and rate (hundredths of a percent) of its rule when the order was placed and the
+-- amount in cents, so the order stays an exact record when the rates change
+ALTER TABLE order_items
+    ADD COLUMN tax_name VARCHAR(100) NOT NULL DEFAULT '' AFTER cost,
+    ADD COLUMN tax_rate INT NOT NULL DEFAULT 0 AFTER tax_name,
+    ADD COLUMN tax BIGINT NOT NULL DEFAULT 0 AFTER tax_rate;
+
+-- Whether the prices of the order included the tax (inclusive pricing) or the tax was added to its total
+ALTER TABLE orders
+    ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE AFTER shipping_cost;
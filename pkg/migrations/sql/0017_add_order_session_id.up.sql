@@ -0,0 +1,4 @@
+-- Session of the visitor that placed the order, so a retried checkout only shows the order to them (guest orders have no
+-- customer to check)
+ALTER TABLE orders
+    ADD COLUMN session_id VARCHAR(64) NULL AFTER idempotency_key;
@@ -0,0 +1,3 @@
+UPDATE order_items SET cost = 0 WHERE cost IS NULL;
+ALTER TABLE order_items
+    MODIFY COLUMN cost BIGINT NOT NULL DEFAULT 0;
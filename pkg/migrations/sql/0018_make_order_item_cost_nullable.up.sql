@@ -0,0 +1,6 @@
+-- The cost of the order lines is NULL for the lines stored without one (added without a price), which are shown at the
+-- current price of their product, so a line bought for 0 (e.g. a free item) keeps its cost. The lines stored before
+-- this migration can not be told apart, so the ones with a cost of 0 are taken as lines without one, like until now.
+ALTER TABLE order_items
+    MODIFY COLUMN cost BIGINT NULL DEFAULT NULL;
+UPDATE order_items SET cost = NULL WHERE cost = 0;
@@ -0,0 +1,137 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"time"
+	"github.com/google/uuid"
+)
+
+/*** Address Types ***/
+const (
+	AddressTypeShipping = "shipping"
+	AddressTypeBilling  = "billing"
+)
+
+// Custom type (model) that represents a postal address: a saved address of a customer (address book) or the shipping or
+// billing address of an order (a copy, so changing the address book does not change the orders).
+type Address struct {
+	AddressID   uuid.UUID `json:"address_id"` // uuid.Nil for the addresses of orders
+	UserID      uuid.UUID `json:"-"`          // Customer of a saved address
+	FullName    string    `json:"full_name"`
+	Line1       string    `json:"line1"`
+	Line2       string    `json:"line2"`
+	City        string    `json:"city"`
+	Region      string    `json:"region"` // State, province or county (see Country.RegionLabel)
+	PostalCode  string    `json:"postal_code"`
+	Country     string    `json:"country"` // ISO 3166-1 alpha-2 code (e.g. "US")
+	Phone       string    `json:"phone"`
+	DateCreated time.Time `json:"date_created"`
+}
+
+// Custom type that describes the fields an address needs in a country.
+type Country struct {
+	Code               string
+	Name               string
+	RegionLabel        string // Name of the region field in the country (e.g. "State"), empty if addresses have none
+	RegionRequired     bool
+	PostalCodeLabel    string
+	PostalCodeRequired bool
+	Regions            []Region       // Regions the addresses must use (the region is free text if there are none)
+	postalCode         *regexp.Regexp // Format of the postal codes (nil if any is accepted)
+}
+
+// Countries the shop delivers to (in the order of the country lists).
+var countries = []Country{
+	{Code: "US", Name: "United States", RegionLabel: "State", RegionRequired: true, PostalCodeLabel: "ZIP Code", PostalCodeRequired: true,
+		Regions: usRegions, postalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`)},
+	{Code: "MX", Name: "Mexico", RegionLabel: "State", RegionRequired: true, PostalCodeLabel: "Postal Code", PostalCodeRequired: true,
+		Regions: mxRegions, postalCode: regexp.MustCompile(`^\d{5}$`)},
+	{Code: "CA", Name: "Canada", RegionLabel: "Province", RegionRequired: true, PostalCodeLabel: "Postal Code", PostalCodeRequired: true,
+		Regions: caRegions, postalCode: regexp.MustCompile(`^[A-Za-z]\d[A-Za-z] ?\d[A-Za-z]\d$`)},
+	{Code: "GB", Name: "United Kingdom", RegionLabel: "County", PostalCodeLabel: "Postcode", PostalCodeRequired: true,
+		postalCode: regexp.MustCompile(`^[A-Za-z]{1,2}\d[A-Za-z\d]? ?\d[A-Za-z]{2}$`)},
+	{Code: "IE", Name: "Ireland", RegionLabel: "County", PostalCodeLabel: "Eircode",
+		postalCode: regexp.MustCompile(`^[A-Za-z]\d[\dWw] ?[A-Za-z\d]{4}$`)},
+	{Code: "DE", Name: "Germany", PostalCodeLabel: "Postal Code", PostalCodeRequired: true, postalCode: regexp.MustCompile(`^\d{5}$`)},
+	{Code: "FR", Name: "France", PostalCodeLabel: "Postal Code", PostalCodeRequired: true, postalCode: regexp.MustCompile(`^\d{5}$`)},
+	{Code: "ES", Name: "Spain", RegionLabel: "Province", PostalCodeLabel: "Postal Code", PostalCodeRequired: true,
+		postalCode: regexp.MustCompile(`^\d{5}$`)},
+	{Code: "AU", Name: "Australia", RegionLabel: "State", RegionRequired: true, PostalCodeLabel: "Postcode", PostalCodeRequired: true,
+		Regions: auRegions, postalCode: regexp.MustCompile(`^\d{4}$`)},
+}
+
+// Function that returns the countries the shop delivers to.
+func Countries() []Country {
+	return countries
+}
+
+// Function that returns the country with the ISO code (case insensitive) and true, or false if the shop does not deliver there.
+func CountryByCode(code string) (Country, bool) {
+	for _, country := range countries {
+		if strings.EqualFold(country.Code, code) { return country, true }
+	}
+	return Country{}, false
+}
+
+// Method that trims the spaces of every field, upper cases the country code and the postal code, and replaces the region
+// with its code if the country has a list of regions and the region is one of them (e.g. "Texas" becomes "TX").
+func (a *Address) Normalize() {
+	a.FullName = strings.TrimSpace(a.FullName)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	a.PostalCode = strings.ToUpper(strings.TrimSpace(a.PostalCode))
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	a.Phone = strings.TrimSpace(a.Phone)
+	if country, ok := CountryByCode(a.Country); ok {
+		if region, ok := country.FindRegion(a.Region); ok { a.Region = region.Code }
+	}
+}
+
+// Method that returns the problems of the address with the fields its country requires (empty if it is valid).
+func (a Address) Validate() []string {
+	var problems []string
+	if a.FullName == "" { problems = append(problems, "The Full Name Is Required") }
+	if a.Line1 == "" { problems = append(problems, "The Address Is Required") }
+	if a.City == "" { problems = append(problems, "The City Is Required") }
+
+	country, ok := CountryByCode(a.Country)
+	if !ok { return append(problems, "Choose a Country We Deliver To") }
+	if country.RegionRequired && a.Region == "" {
+		problems = append(problems, "The "+country.RegionLabel+" Is Required")
+	} else if _, ok := country.FindRegion(a.Region); a.Region != "" && len(country.Regions) > 0 && !ok {
+		problems = append(problems, "The "+country.RegionLabel+" Is Not Valid For "+country.Name)
+	}
+	if a.PostalCode == "" {
+		if country.PostalCodeRequired { problems = append(problems, "The "+country.PostalCodeLabel+" Is Required") }
+	} else if country.postalCode != nil && !country.postalCode.MatchString(a.PostalCode) {
+		problems = append(problems, "The "+country.PostalCodeLabel+" Is Not Valid For "+country.Name)
+	}
+	return problems
+}
+
+// Method that returns the lines of the address as they are printed on a label (e.g. "Springfield, IL 62704").
+func (a Address) Lines() []string {
+	lines := []string{a.FullName, a.Line1}
+	if a.Line2 != "" { lines = append(lines, a.Line2) }
+
+	cityLine := a.City
+	if a.Region != "" { cityLine += ", " + a.Region }
+	if a.PostalCode != "" { cityLine += " " + a.PostalCode }
+	lines = append(lines, cityLine)
+
+	if country, ok := CountryByCode(a.Country); ok {
+		lines = append(lines, country.Name)
+	} else if a.Country != "" {
+		lines = append(lines, a.Country)
+	}
+	if a.Phone != "" { lines = append(lines, a.Phone) }
+	return lines
+}
+
+// Method that returns the address in one line (e.g. for the options of the saved addresses).
+func (a Address) String() string {
+	return strings.Join(a.Lines(), ", ")
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+	"github.com/google/uuid"
+)
+
+/*** Admin Roles ***/
+const (
+	RoleOwner            = "owner"
+	RoleCatalogEditor    = "catalog editor"
+	RoleFulfillmentClerk = "fulfillment clerk"
+)
+
+/*** Admin Permissions ***/
+const (
+	PermViewProducts      = "view products"
+	PermEditProducts      = "edit products"
+	PermDeleteProducts    = "delete products"
+	PermSeedProducts      = "seed products"
+	PermManageCategories  = "manage categories"
+	PermViewOrders        = "view orders"
+	PermUpdateOrderStatus = "update order status"
+	PermManageStaff       = "manage staff"
+)
+
+// Permissions granted to each admin role.
+var rolePermissions = map[string][]string{
+	RoleOwner: {
+		PermViewProducts, PermEditProducts, PermDeleteProducts, PermSeedProducts, PermManageCategories,
+		PermViewOrders, PermUpdateOrderStatus, PermManageStaff,
+	},
+	RoleCatalogEditor:    {PermViewProducts, PermEditProducts, PermDeleteProducts, PermManageCategories},
+	RoleFulfillmentClerk: {PermViewProducts, PermViewOrders, PermUpdateOrderStatus},
+}
+
+// Function that returns the admin roles (in the order they are shown to the owner).
+func AdminRoles() []string {
+	return []string{RoleOwner, RoleCatalogEditor, RoleFulfillmentClerk}
+}
+
+// Custom type (model) that represents a member of the staff (AdminUser) that can log in to the admin dashboard
+type AdminUser struct {
+	AdminID      uuid.UUID `json:"admin_id"`
+	Email        string    `json:"email"`
+	FullName     string    `json:"full_name"`
+	PasswordHash string    `json:"-"`
+	Role         string    `json:"role"`
+	DateCreated  time.Time `json:"date_created"`
+}
+
+// Method that returns true if the role of the admin grants the permission.
+func (a *AdminUser) Can(permission string) bool {
+	if a == nil { return false }
+	for _, p := range rolePermissions[a.Role] {
+		if p == permission { return true }
+	}
+	return false
+}
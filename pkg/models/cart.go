@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+	"github.com/google/uuid"
+)
+
+// Custom type (model) that represents a shopping Cart (of a visitor session) from the database
+type Cart struct {
+	CartID       uuid.UUID
+	SessionID    string
+	UserID       string // Empty for guests
+	DateCreated  time.Time
+	DateModified time.Time
+	Items        []OrderItem
+}
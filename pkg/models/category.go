@@ -0,0 +1,56 @@
+package models
+
+import (
+	"sort"
+	"time"
+	"github.com/google/uuid"
+)
+
+// Custom type (model) that represents a product Category. Categories form a tree, a category without a parent is a
+// top level category.
+type Category struct {
+	CategoryID   uuid.UUID     `json:"category_id"`
+	ParentID     uuid.NullUUID `json:"parent_id"` // Not valid for top level categories
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	DateCreated  time.Time     `json:"date_created"`
+	DateModified time.Time     `json:"date_modified"`
+	Depth        int           `json:"depth"`         // Level of the category in the tree (0 for top level), set by CategoryTree
+	ProductCount int           `json:"product_count"` // Number of products in the category (without the ones of its subcategories)
+}
+
+// Function that sorts the categories in tree order (every category followed by its subcategories, siblings by name)
+// and sets their depth.
+func CategoryTree(categories []Category) []Category {
+	children := map[uuid.UUID][]Category{} // Subcategories by parent ID (uuid.Nil for the top level categories)
+	for _, c := range categories {
+		parentID := uuid.Nil
+		if c.ParentID.Valid { parentID = c.ParentID.UUID }
+		children[parentID] = append(children[parentID], c)
+	}
+
+	tree := make([]Category, 0, len(categories))
+	var addChildren func(parentID uuid.UUID, depth int)
+	addChildren = func(parentID uuid.UUID, depth int) {
+		siblings := children[parentID]
+		sort.Slice(siblings, func(i, j int) bool { return siblings[i].Name < siblings[j].Name })
+		for _, c := range siblings {
+			c.Depth = depth
+			tree = append(tree, c)
+			addChildren(c.CategoryID, depth+1)
+		}
+	}
+	addChildren(uuid.Nil, 0)
+	return tree
+}
+
+// Function that returns the ID of a category followed by the IDs of all its subcategories (at any depth).
+func CategoryDescendants(categories []Category, categoryID uuid.UUID) []uuid.UUID {
+	ids := []uuid.UUID{categoryID}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range categories {
+			if c.ParentID.Valid && c.ParentID.UUID == ids[i] { ids = append(ids, c.CategoryID) }
+		}
+	}
+	return ids
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Returned when a text can not be parsed as an amount of money.
+var ErrInvalidMoney = errors.New("invalid amount of money")
+
+// Custom type that represents an amount of money in cents (minor units). It is stored as an integer, so adding and
+// multiplying amounts is exact (unlike float64, which drifts).
+type Money int64
+
+// Function that parses an amount with at most two decimals (e.g. "12", "12.5", "$1,234.56") into Money. The thousands
+// separators are optional but must split the units in groups of three, and amounts with more decimals are rejected
+// instead of rounded (e.g. "1,23" and "12.345" are invalid), so a mistyped amount is never stored as another one.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	s = strings.TrimPrefix(s, "$")
+
+	whole, fraction, hasFraction := strings.Cut(s, ".")
+	if strings.Contains(whole, ",") {
+		groups := strings.Split(whole, ",")
+		if len(groups[0]) == 0 || len(groups[0]) > 3 { return 0, ErrInvalidMoney }
+		for _, group := range groups[1:] {
+			if len(group) != 3 { return 0, ErrInvalidMoney }
+		}
+		whole = strings.Join(groups, "")
+	}
+	if whole == "" && (!hasFraction || fraction == "") { return 0, ErrInvalidMoney }
+	if len(fraction) > 2 || (hasFraction && fraction == "") { return 0, ErrInvalidMoney }
+	if whole == "" { whole = "0" }
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	for _, part := range []string{whole, fraction} {
+		for _, c := range part {
+			if c < '0' || c > '9' { return 0, ErrInvalidMoney }
+		}
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/100-1 { return 0, ErrInvalidMoney }
+	cents, _ := strconv.ParseInt(fraction, 10, 64)
+
+	amount := Money(units*100 + cents)
+	if negative { amount = -amount }
+	return amount, nil
+}
+
+// Method that returns the amount multiplied by a quantity.
+func (m Money) Times(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Method that returns the amount with two decimals and thousands separators (e.g. "1,234.50"), without currency symbol.
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+
+	units := strconv.FormatInt(int64(m/100), 10)
+	for i := len(units) - 3; i > 0; i -= 3 {
+		units = units[:i] + "," + units[i:]
+	}
+	return sign + units + "." + strconv.FormatInt(int64(m%100)/10, 10) + strconv.FormatInt(int64(m%10), 10)
+}
+
+// Method that returns the amount with two decimals and without separators (e.g. "1234.50"), as used in form inputs.
+func (m Money) Input() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+		m = -m
+	}
+	return sign + strconv.FormatInt(int64(m/100), 10) + "." + strconv.FormatInt(int64(m%100)/10, 10) + strconv.FormatInt(int64(m%10), 10)
+}
@@ -0,0 +1,88 @@
+package models
+
+import "testing"
+
+/*** Tests ***/
+
+// Tests that amounts are parsed into cents: the thousands separators must be in groups of three and more than two
+// decimals are rejected, so a mistyped amount is never read as another one.
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		text string
+		want Money
+		ok   bool
+	}{
+		{text: "12", want: 1200, ok: true},
+		{text: "12.5", want: 1250, ok: true},
+		{text: "12.05", want: 1205, ok: true},
+		{text: ".5", want: 50, ok: true},
+		{text: "0.99", want: 99, ok: true},
+		{text: " $1,234.56 ", want: 123456, ok: true},
+		{text: "1,234,567", want: 123456700, ok: true},
+		{text: "999,999.99", want: 99999999, ok: true},
+		{text: "-5.25", want: -525, ok: true},
+		{text: "-$1,000", want: -100000, ok: true},
+		{text: "1234.50", want: 123450, ok: true},
+
+		// Thousands separators
+		{text: "1,23"},
+		{text: "1,2345"},
+		{text: "12,34.56"},
+		{text: "1234,567"},
+		{text: ",123"},
+		{text: "1,,234"},
+		{text: "1,234,"},
+		{text: "1,234,56.78"},
+		{text: "1.234,56"},
+
+		// Decimals
+		{text: "12.345"},
+		{text: "0.001"},
+		{text: "12."},
+		{text: "12.5.0"},
+
+		// Not amounts
+		{text: ""},
+		{text: "."},
+		{text: "-"},
+		{text: "$"},
+		{text: "abc"},
+		{text: "12a"},
+		{text: "1 234"},
+		{text: "+5"},
+		{text: "$-5"},
+		{text: "--5"},
+		{text: "1e3"},
+		{text: "92233720368547758"}, // Does not fit in cents
+	}
+	for _, test := range tests {
+		got, err := ParseMoney(test.text)
+		if test.ok && (err != nil || got != test.want) { t.Errorf("ParseMoney(%q) = %d, %v, want %d", test.text, got, err, test.want) }
+		if !test.ok && err != ErrInvalidMoney { t.Errorf("ParseMoney(%q) = %d, %v, want ErrInvalidMoney", test.text, got, err) }
+	}
+}
+
+// Tests that the amounts are formatted with two decimals, with thousands separators for the pages and without them for
+// the form inputs, and that both are parsed back into the same amount.
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		amount Money
+		text   string
+		input  string
+	}{
+		{amount: 0, text: "0.00", input: "0.00"},
+		{amount: 5, text: "0.05", input: "0.05"},
+		{amount: 1250, text: "12.50", input: "12.50"},
+		{amount: 123456, text: "1,234.56", input: "1234.56"},
+		{amount: 100000000, text: "1,000,000.00", input: "1000000.00"},
+		{amount: -123456, text: "-1,234.56", input: "-1234.56"},
+	}
+	for _, test := range tests {
+		if got := test.amount.String(); got != test.text { t.Errorf("%d: String() = %q, want %q", test.amount, got, test.text) }
+		if got := test.amount.Input(); got != test.input { t.Errorf("%d: Input() = %q, want %q", test.amount, got, test.input) }
+		for _, text := range []string{test.text, test.input} {
+			if parsed, err := ParseMoney(text); err != nil || parsed != test.amount { t.Errorf("ParseMoney(%q) = %d, %v, want %d", text, parsed, err, test.amount) }
+		}
+	}
+	if got := Money(1999).Times(3); got != 5997 { t.Errorf("19.99 times 3 = %d, want 5997", got) }
+}
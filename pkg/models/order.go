@@ -5,11 +5,94 @@ import (
 	"github.com/google/uuid"
 )
 
+/*** Order Statuses ***/
+const (
+	OrderStatusOrdered        = "ordered"
+	OrderStatusPaid           = "paid"
+	OrderStatusPacked         = "packed"
+	OrderStatusOutForDelivery = "out for delivery"
+	OrderStatusDelivered      = "delivered"
+	OrderStatusCancelled      = "cancelled"
+	OrderStatusReturned       = "returned"
+)
+
 // Custom type (model) that represents an Order from the database
 type Order struct {
-	OrderID     uuid.UUID
-	UserID      string
-	OrderStatus string
-	OrderDate   time.Time
-	Items       []OrderItem
-}
\ No newline at end of file
+	OrderID         uuid.UUID   `json:"order_id"`
+	UserID          string      `json:"user_id"`    // Empty for guest orders
+	UserEmail       string      `json:"user_email"` // Email of the customer (empty for guest orders)
+	SessionID       string      `json:"-"`          // Session of the visitor that placed it (empty for orders placed before sessions were stored)
+	OrderStatus     string      `json:"order_status"`
+	OrderDate       time.Time   `json:"order_date"`
+	ShippingMethod  string      `json:"shipping_method"` // Code of the shipping method (empty for orders placed before shipping methods)
+	ShippingName    string      `json:"shipping_name"`   // Name of the shipping method when the order was placed
+	ShippingCost    Money       `json:"shipping_cost"`   // In cents
+	TaxInclusive    bool        `json:"tax_inclusive"`   // Whether the prices of the items included their tax
+	Items           []OrderItem `json:"items"`
+	ShippingAddress *Address    `json:"shipping_address"` // nil for orders placed before addresses were captured
+	BillingAddress  *Address    `json:"billing_address"`
+}
+
+// Method that returns the cost of the items of the order.
+func (o Order) Subtotal() Money {
+	var subtotal Money
+	for _, item := range o.Items {
+		subtotal += item.Cost
+	}
+	return subtotal
+}
+
+// Method that returns the tax of the items of the order.
+func (o Order) Tax() Money {
+	var tax Money
+	for _, item := range o.Items {
+		tax += item.Tax
+	}
+	return tax
+}
+
+// Method that returns the tax of the order by tax rule (the breakdown shown with the totals).
+func (o Order) TaxLines() []TaxLine {
+	return TaxLines(o.Items)
+}
+
+// Method that returns the grand total of the order: the cost of the items plus the shipping, plus the tax unless the
+// prices included it.
+func (o Order) Total() Money {
+	if o.TaxInclusive { return o.Subtotal() + o.ShippingCost }
+	return o.Subtotal() + o.ShippingCost + o.Tax()
+}
+
+// Custom type that represents the tax of the items of an order (or cart) charged with the same tax rule.
+type TaxLine struct {
+	Name   string  `json:"name"`
+	Rate   Percent `json:"rate"`   // In hundredths of a percent
+	Amount Money   `json:"amount"` // In cents
+}
+
+// Function that adds up the tax of the items by tax rule (name and rate), in the order the rules first appear. Untaxed
+// items are left out.
+func TaxLines(items []OrderItem) []TaxLine {
+	var lines []TaxLine
+	for _, item := range items {
+		if item.TaxName == "" && item.Tax == 0 { continue }
+		found := false
+		for i := range lines {
+			if lines[i].Name == item.TaxName && lines[i].Rate == item.TaxRate {
+				lines[i].Amount += item.Tax
+				found = true
+			}
+		}
+		if !found { lines = append(lines, TaxLine{Name: item.TaxName, Rate: item.TaxRate, Amount: item.Tax}) }
+	}
+	return lines
+}
+
+// Custom type (model) that represents a change of the status of an Order (status history) from the database
+type OrderStatusChange struct {
+	OrderID     uuid.UUID `json:"order_id"`
+	FromStatus  string    `json:"from_status"`
+	ToStatus    string    `json:"to_status"`
+	ChangedBy   string    `json:"changed_by"`
+	DateChanged time.Time `json:"date_changed"`
+}
@@ -4,9 +4,14 @@ import "github.com/google/uuid"
 
 // Custom type (model) that represents an order item (product in an order) from the database
 type OrderItem struct {
-	OrderID   uuid.UUID
-	ProductID uuid.UUID
-	Quantity  int
-	Product   Product
-	Cost      float64
+	OrderID   uuid.UUID       `json:"order_id"`
+	ProductID uuid.UUID       `json:"product_id"`
+	VariantID uuid.UUID       `json:"-"` // uuid.Nil for products without variants
+	Quantity  int             `json:"quantity"`
+	Product   Product         `json:"product"`           // Product with the price and stock of the variant (if any)
+	Variant   *ProductVariant `json:"variant,omitempty"` // nil for products without variants
+	Cost      Money           `json:"cost"`              // Quantity times the price of the product, in cents
+	TaxName   string          `json:"tax_name"`          // Name of the tax rule of the line when the order was placed (empty if untaxed)
+	TaxRate   Percent         `json:"tax_rate"`          // Rate of the tax rule then, in hundredths of a percent
+	Tax       Money           `json:"tax"`               // Tax of the line, in cents (included in the cost with tax inclusive prices)
 }
\ No newline at end of file
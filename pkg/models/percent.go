@@ -0,0 +1,14 @@
+package models
+
+import "strings"
+
+// Custom type that represents a percentage in hundredths of a percent (basis points, e.g. 825 is 8.25%). Like Money it is
+// an integer, so the rates stored with the orders are exact.
+type Percent int
+
+// Method that returns the percentage without trailing zeros and without the percent sign (e.g. "8.25", "7.5" or "20").
+func (p Percent) String() string {
+	s := Money(p).Input()
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -7,11 +7,21 @@ import (
 
 // Custom type (model) that represents a Product from the database
 type Product struct {
-	ProductID    uuid.UUID
-	ProductName  string
-	Price        float64
-	Description  string
-	ProductImage string
-	DateCreated  time.Time
-	DateModified time.Time
+	ProductID    uuid.UUID        `json:"product_id"`
+	ProductName  string           `json:"product_name"`
+	Price        Money            `json:"price"` // Price in cents
+	TaxClass     string           `json:"tax_class"` // Tax class (see the tax package) that chooses the tax rules of the product
+	Stock        int              `json:"stock"` // Quantity available to sell (of products without variants)
+	Weight       int              `json:"weight"` // Weight of a unit in grams (0 if unknown)
+	Length       int              `json:"length"` // Dimensions of a (packed) unit in centimetres (0 if unknown)
+	Width        int              `json:"width"`
+	Height       int              `json:"height"`
+	Description  string           `json:"description"`
+	ProductImage string           `json:"-"` // Filename of the primary image
+	DateCreated  time.Time        `json:"date_created"`
+	DateModified time.Time        `json:"date_modified"`
+	Categories   []Category       `json:"categories"` // Categories the product belongs to (loaded by GetProductByID)
+	Options      []ProductOption  `json:"options"`
+	Variants     []ProductVariant `json:"variants"`
+	Images       []ProductImage   `json:"-"` // Images of the product in gallery order
 }
\ No newline at end of file
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+	"github.com/google/uuid"
+)
+
+// Custom type (model) that represents an image of a product. The primary image is the one shown in the product listings.
+type ProductImage struct {
+	ImageID     uuid.UUID `json:"image_id"`
+	ProductID   uuid.UUID `json:"product_id"`
+	Filename    string    `json:"-"` // Name of the file in the upload directory
+	IsPrimary   bool      `json:"is_primary"`
+	SortOrder   int       `json:"sort_order"` // Position of the image in the gallery (0 first)
+	DateCreated time.Time `json:"date_created"`
+}
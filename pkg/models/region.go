@@ -0,0 +1,92 @@
+package models
+
+import "strings"
+
+// Custom type that represents a region (state, province or territory) of a country, with its ISO 3166-2 subdivision code
+// without the country prefix (e.g. "TX" for "US-TX"), which is how the addresses and the tax rules store it.
+type Region struct {
+	Code    string
+	Name    string
+	aliases []string // Other names the shoppers write (e.g. "CDMX" for Ciudad de México)
+}
+
+/*** Global Variables ***/
+
+// Replaces the accents and the periods of the folded region names (e.g. "Querétaro" or "N.Y.").
+var regionFolder = strings.NewReplacer("á", "a", "à", "a", "â", "a", "ä", "a", "é", "e", "è", "e", "ê", "e", "ë", "e", "í", "i", "ì", "i",
+	"î", "i", "ï", "i", "ó", "o", "ò", "o", "ô", "o", "ö", "o", "ú", "u", "ù", "u", "û", "u", "ü", "u", "ñ", "n", "ç", "c", ".", "")
+
+// States, federal district and territories of the United States.
+var usRegions = []Region{
+	{Code: "AL", Name: "Alabama"}, {Code: "AK", Name: "Alaska"}, {Code: "AZ", Name: "Arizona"}, {Code: "AR", Name: "Arkansas"},
+	{Code: "CA", Name: "California"}, {Code: "CO", Name: "Colorado"}, {Code: "CT", Name: "Connecticut"}, {Code: "DE", Name: "Delaware"},
+	{Code: "DC", Name: "District of Columbia", aliases: []string{"Washington DC", "Washington, DC"}}, {Code: "FL", Name: "Florida"},
+	{Code: "GA", Name: "Georgia"}, {Code: "HI", Name: "Hawaii"}, {Code: "ID", Name: "Idaho"}, {Code: "IL", Name: "Illinois"},
+	{Code: "IN", Name: "Indiana"}, {Code: "IA", Name: "Iowa"}, {Code: "KS", Name: "Kansas"}, {Code: "KY", Name: "Kentucky"},
+	{Code: "LA", Name: "Louisiana"}, {Code: "ME", Name: "Maine"}, {Code: "MD", Name: "Maryland"}, {Code: "MA", Name: "Massachusetts"},
+	{Code: "MI", Name: "Michigan"}, {Code: "MN", Name: "Minnesota"}, {Code: "MS", Name: "Mississippi"}, {Code: "MO", Name: "Missouri"},
+	{Code: "MT", Name: "Montana"}, {Code: "NE", Name: "Nebraska"}, {Code: "NV", Name: "Nevada"}, {Code: "NH", Name: "New Hampshire"},
+	{Code: "NJ", Name: "New Jersey"}, {Code: "NM", Name: "New Mexico"}, {Code: "NY", Name: "New York"}, {Code: "NC", Name: "North Carolina"},
+	{Code: "ND", Name: "North Dakota"}, {Code: "OH", Name: "Ohio"}, {Code: "OK", Name: "Oklahoma"}, {Code: "OR", Name: "Oregon"},
+	{Code: "PA", Name: "Pennsylvania"}, {Code: "RI", Name: "Rhode Island"}, {Code: "SC", Name: "South Carolina"}, {Code: "SD", Name: "South Dakota"},
+	{Code: "TN", Name: "Tennessee"}, {Code: "TX", Name: "Texas"}, {Code: "UT", Name: "Utah"}, {Code: "VT", Name: "Vermont"},
+	{Code: "VA", Name: "Virginia"}, {Code: "WA", Name: "Washington"}, {Code: "WV", Name: "West Virginia"}, {Code: "WI", Name: "Wisconsin"},
+	{Code: "WY", Name: "Wyoming"}, {Code: "AS", Name: "American Samoa"}, {Code: "GU", Name: "Guam"}, {Code: "MP", Name: "Northern Mariana Islands"},
+	{Code: "PR", Name: "Puerto Rico"}, {Code: "UM", Name: "United States Minor Outlying Islands"},
+	{Code: "VI", Name: "U.S. Virgin Islands", aliases: []string{"Virgin Islands", "US Virgin Islands"}},
+}
+
+// States of Mexico (and its capital).
+var mxRegions = []Region{
+	{Code: "AGU", Name: "Aguascalientes"}, {Code: "BCN", Name: "Baja California"}, {Code: "BCS", Name: "Baja California Sur"},
+	{Code: "CAM", Name: "Campeche"}, {Code: "CHP", Name: "Chiapas"}, {Code: "CHH", Name: "Chihuahua"},
+	{Code: "CMX", Name: "Ciudad de México", aliases: []string{"CDMX", "Mexico City", "Distrito Federal", "DF"}},
+	{Code: "COA", Name: "Coahuila", aliases: []string{"Coahuila de Zaragoza"}}, {Code: "COL", Name: "Colima"}, {Code: "DUR", Name: "Durango"},
+	{Code: "GUA", Name: "Guanajuato"}, {Code: "GRO", Name: "Guerrero"}, {Code: "HID", Name: "Hidalgo"}, {Code: "JAL", Name: "Jalisco"},
+	{Code: "MEX", Name: "Estado de México", aliases: []string{"México", "State of Mexico", "Edomex"}},
+	{Code: "MIC", Name: "Michoacán", aliases: []string{"Michoacán de Ocampo"}}, {Code: "MOR", Name: "Morelos"}, {Code: "NAY", Name: "Nayarit"},
+	{Code: "NLE", Name: "Nuevo León"}, {Code: "OAX", Name: "Oaxaca"}, {Code: "PUE", Name: "Puebla"}, {Code: "QUE", Name: "Querétaro"},
+	{Code: "ROO", Name: "Quintana Roo"}, {Code: "SLP", Name: "San Luis Potosí"}, {Code: "SIN", Name: "Sinaloa"}, {Code: "SON", Name: "Sonora"},
+	{Code: "TAB", Name: "Tabasco"}, {Code: "TAM", Name: "Tamaulipas"}, {Code: "TLA", Name: "Tlaxcala"},
+	{Code: "VER", Name: "Veracruz", aliases: []string{"Veracruz de Ignacio de la Llave"}}, {Code: "YUC", Name: "Yucatán"},
+	{Code: "ZAC", Name: "Zacatecas"},
+}
+
+// Provinces and territories of Canada.
+var caRegions = []Region{
+	{Code: "AB", Name: "Alberta"}, {Code: "BC", Name: "British Columbia"}, {Code: "MB", Name: "Manitoba"}, {Code: "NB", Name: "New Brunswick"},
+	{Code: "NL", Name: "Newfoundland and Labrador", aliases: []string{"Newfoundland"}}, {Code: "NS", Name: "Nova Scotia"},
+	{Code: "NT", Name: "Northwest Territories"}, {Code: "NU", Name: "Nunavut"}, {Code: "ON", Name: "Ontario"},
+	{Code: "PE", Name: "Prince Edward Island"}, {Code: "QC", Name: "Quebec"}, {Code: "SK", Name: "Saskatchewan"}, {Code: "YT", Name: "Yukon"},
+}
+
+// States and territories of Australia.
+var auRegions = []Region{
+	{Code: "ACT", Name: "Australian Capital Territory"}, {Code: "NSW", Name: "New South Wales"}, {Code: "NT", Name: "Northern Territory"},
+	{Code: "QLD", Name: "Queensland"}, {Code: "SA", Name: "South Australia"}, {Code: "TAS", Name: "Tasmania"}, {Code: "VIC", Name: "Victoria"},
+	{Code: "WA", Name: "Western Australia"},
+}
+
+// Method that returns the region of the country written as its code (e.g. "TX" or "US-TX") or its name (e.g. "Texas"),
+// ignoring the case, the accents and the periods, and true, or false if the country has no such region (or no list of
+// regions).
+func (c Country) FindRegion(value string) (Region, bool) {
+	key := foldRegion(value)
+	key = strings.TrimPrefix(key, strings.ToLower(c.Code)+"-")
+	if key == "" { return Region{}, false }
+
+	for _, region := range c.Regions {
+		if key == strings.ToLower(region.Code) || key == foldRegion(region.Name) { return region, true }
+		for _, alias := range region.aliases {
+			if key == foldRegion(alias) { return region, true }
+		}
+	}
+	return Region{}, false
+}
+
+/*** Helper Functions ***/
+
+// Returns a region code or name in lower case, without accents, periods and repeated spaces, to compare it.
+func foldRegion(value string) string {
+	return strings.Join(strings.Fields(regionFolder.Replace(strings.ToLower(value))), " ")
+}
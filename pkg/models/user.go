@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+	"github.com/google/uuid"
+)
+
+// Custom type (model) that represents a customer (User) account from the database
+type User struct {
+	UserID       uuid.UUID `json:"user_id"`
+	Email        string    `json:"email"`
+	FullName     string    `json:"full_name"`
+	PasswordHash string    `json:"-"`
+	DateCreated  time.Time `json:"date_created"`
+}
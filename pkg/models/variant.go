@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"github.com/google/uuid"
+)
+
+// Custom type (model) that represents an option shoppers choose for a product (e.g. size or colour)
+type ProductOption struct {
+	OptionID  uuid.UUID `json:"option_id"`
+	ProductID uuid.UUID `json:"product_id"`
+	Name      string    `json:"name"`
+	Position  int       `json:"position"` // Order of the option in the product (0 first)
+}
+
+// Custom type (model) that represents a Variant of a product (a combination of option values) with its own SKU, price and stock
+type ProductVariant struct {
+	VariantID     uuid.UUID `json:"variant_id"`
+	ProductID     uuid.UUID `json:"product_id"`
+	SKU           string    `json:"sku"`
+	PriceOverride *Money    `json:"price_override"` // Price of the variant in cents, nil to use the price of the product
+	Stock         int       `json:"stock"`          // Quantity available to sell
+	Values        []string  `json:"values"`         // Value of every option of the product, in option order (e.g. "M", "Red")
+	DateCreated   time.Time `json:"date_created"`
+	DateModified  time.Time `json:"date_modified"`
+}
+
+// Method that returns the option values of the variant as a label (e.g. "M / Red").
+func (v ProductVariant) Label() string {
+	return strings.Join(v.Values, " / ")
+}
+
+// Method that returns the price of the variant: its own price or, if it has none, the price of the product.
+func (v ProductVariant) Price(productPrice Money) Money {
+	if v.PriceOverride != nil { return *v.PriceOverride }
+	return productPrice
+}
+
+// Method that returns true if the product is sold in variants (the shopper must choose one).
+func (p Product) HasVariants() bool {
+	return len(p.Variants) > 0
+}
+
+// Method that returns true if the product (or any of its variants) has stock.
+func (p Product) InStock() bool {
+	return p.TotalStock() > 0
+}
+
+// Method that returns the stock of the product, which is the sum of the stock of its variants if it has any.
+func (p Product) TotalStock() int {
+	if !p.HasVariants() { return p.Stock }
+	total := 0
+	for _, v := range p.Variants {
+		total += v.Stock
+	}
+	return total
+}
+
+// Method that returns a copy of the product with the price and stock of one of its variants, and the variant. It returns
+// false if the product has no variant with the ID.
+func (p Product) WithVariant(variantID uuid.UUID) (Product, *ProductVariant, bool) {
+	for i := range p.Variants {
+		if p.Variants[i].VariantID != variantID { continue }
+		variant := p.Variants[i]
+		p.Price = variant.Price(p.Price)
+		p.Stock = variant.Stock
+		return p, &variant, true
+	}
+	return p, nil, false
+}
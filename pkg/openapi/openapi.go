@@ -0,0 +1,268 @@
+package openapi
+
+import (
+	"encoding"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+/*** Constants ***/
+const Version = "3.0.3" // Version of the OpenAPI specification the documents follow
+
+/*** Global Variables ***/
+var timeType = reflect.TypeOf(time.Time{})                                    // Encoded as a date-time string
+var uuidType = reflect.TypeOf(uuid.UUID{})                                    // Encoded as a uuid string
+var nullUUIDType = reflect.TypeOf(uuid.NullUUID{})                            // Encoded as a uuid string or null
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem() // Types encoded as strings
+
+/*** Structs ***/
+
+// Custom type that represents an OpenAPI document (the subset of the specification the app uses).
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Custom type that contains the title and version of the described API.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Custom type that contains the operations of a path by (lowercase) method.
+type PathItem map[string]*Operation
+
+// Custom type that describes what a method of a path does, what it receives and what it responds.
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Custom type that describes a path, query or header parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // "path", "query" or "header"
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Custom type that describes the body of a request.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Custom type that describes a response of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Custom type that contains the schema of a body of a media type (e.g. application/json).
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Custom type that describes a JSON value (a subset of JSON Schema), or references a schema of the components.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Custom type that contains the reusable schemas and the security schemes of a document.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// Custom type that describes how requests are authenticated (e.g. with a cookie).
+type SecurityScheme struct {
+	Type        string `json:"type"` // "apiKey" for cookies
+	In          string `json:"in"`   // "cookie"
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+/*** Functions ***/
+
+// Function that returns a new (empty) document of an API.
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       Info{Title: title, Version: version, Description: description},
+		Paths:      map[string]*PathItem{},
+		Components: Components{Schemas: map[string]*Schema{}, SecuritySchemes: map[string]*SecurityScheme{}},
+	}
+}
+
+// Method that adds an operation to a path of the document. The path uses the mux syntax, the patterns of its variables
+// (e.g. "{id:[0-9]+}") are removed.
+func (d *Document) AddOperation(method, path string, op *Operation) {
+	path = PathTemplate(path)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Method that returns whether the document has an operation for the method and path.
+func (d *Document) HasOperation(method, path string) bool {
+	item, ok := d.Paths[PathTemplate(path)]
+	if !ok { return false }
+	_, ok = (*item)[strings.ToLower(method)]
+	return ok
+}
+
+// Method that returns the schema of the JSON encoding of a value (or reflect.Type), following the json struct tags. Named
+// structs are added to the components (once) and referenced, so the schemas of the models are shared by the operations.
+func (d *Document) Schema(v any) *Schema {
+	t, ok := v.(reflect.Type)
+	if !ok { t = reflect.TypeOf(v) }
+	return d.schemaOf(t)
+}
+
+// Function that returns the path parameters of a path template (e.g. "id" of "/products/{id}").
+func PathParameters(path string) []string {
+	var names []string
+	for _, part := range strings.Split(path, "/") {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name, _, _ := strings.Cut(part[1:len(part)-1], ":")
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Function that returns a mux path template without the patterns of its variables (e.g. "/products/{id}").
+func PathTemplate(path string) string {
+	parts := strings.Split(path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			name, _, _ := strings.Cut(part[1:len(part)-1], ":")
+			parts[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+/*** Helper Functions ***/
+
+// Returns the schema of a type, adding the named structs to the components.
+func (d *Document) schemaOf(t reflect.Type) *Schema {
+	if t == nil { return &Schema{} } // Any value
+
+	switch t {
+		case timeType:
+			return &Schema{Type: "string", Format: "date-time"}
+		case uuidType:
+			return &Schema{Type: "string", Format: "uuid"}
+		case nullUUIDType:
+			return &Schema{Type: "string", Format: "uuid", Nullable: true}
+	}
+	if t.Kind() != reflect.Pointer && t.Implements(textMarshalerType) { return &Schema{Type: "string"} }
+
+	switch t.Kind() {
+		case reflect.Pointer:
+			schema := d.schemaOf(t.Elem())
+			if schema.Ref != "" { return &Schema{AllOf: []*Schema{schema}, Nullable: true} } // A $ref can not have siblings in OpenAPI 3.0
+			nullable := *schema
+			nullable.Nullable = true
+			return &nullable
+		case reflect.Bool:
+			return &Schema{Type: "boolean"}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return &Schema{Type: "integer", Format: "int32"}
+		case reflect.Int64, reflect.Uint64:
+			return &Schema{Type: "integer", Format: "int64"}
+		case reflect.Float32, reflect.Float64:
+			return &Schema{Type: "number"}
+		case reflect.String:
+			return &Schema{Type: "string"}
+		case reflect.Slice, reflect.Array:
+			if t.Elem().Kind() == reflect.Uint8 { return &Schema{Type: "string", Format: "byte"} }
+			return &Schema{Type: "array", Items: d.schemaOf(t.Elem()), Nullable: t.Kind() == reflect.Slice}
+		case reflect.Map:
+			return &Schema{Type: "object", AdditionalProperties: d.schemaOf(t.Elem())}
+		case reflect.Struct:
+			if t.Name() == "" { return d.structSchema(t) }
+
+			name := componentName(t)
+			if _, ok := d.Components.Schemas[name]; !ok {
+				d.Components.Schemas[name] = &Schema{} // Placeholder, so self referencing types do not recurse forever
+				*d.Components.Schemas[name] = *d.structSchema(t)
+			}
+			return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{} // Interfaces accept any value
+}
+
+// Returns the schema of the fields of a struct, with the fields of the embedded structs promoted like encoding/json does
+// (a field of the struct hides a field of an embedded struct with the same name).
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" { continue }
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Pointer { fieldType = fieldType.Elem() }
+			if fieldType.Kind() == reflect.Struct {
+				embedded = append(embedded, fieldType)
+				continue
+			}
+		}
+		if !field.IsExported() { continue }
+
+		if name == "" { name = field.Name }
+		schema.Properties[name] = d.schemaOf(field.Type)
+		if !strings.Contains(options, "omitempty") { schema.Required = append(schema.Required, name) }
+	}
+
+	for _, embeddedType := range embedded {
+		promoted := d.structSchema(embeddedType)
+		for name, property := range promoted.Properties {
+			if _, ok := schema.Properties[name]; ok { continue }
+			schema.Properties[name] = property
+			if slices.Contains(promoted.Required, name) { schema.Required = append(schema.Required, name) }
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// Returns the name of the component of a named struct, starting with an upper case letter (e.g. "APICart" for apiCart).
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	if rest, ok := strings.CutPrefix(name, "api"); ok { return "API" + rest }
+	return strings.ToUpper(name[:1]) + name[1:]
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Custom type that holds a pointer to the database connection.
+type AddressRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new AddressRepository (pointer) with the database connection.
+func NewAddressRepository(db *sql.DB) *AddressRepository {
+	return &AddressRepository{DB: db}
+}
+
+// Method that returns the saved addresses of a customer (oldest first).
+func (r *AddressRepository) ListAddresses(userID uuid.UUID) ([]models.Address, error) {
+	query := `
+	SELECT address_id, user_id, full_name, line1, line2, city, region, postal_code, country, phone, date_created
+	FROM addresses WHERE user_id = ? ORDER BY date_created
+	`
+	rows, err := r.DB.Query(query, userID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	var addresses []models.Address
+	for rows.Next() {
+		var a models.Address
+		err := rows.Scan(&a.AddressID, &a.UserID, &a.FullName, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country, &a.Phone, &a.DateCreated)
+		if err != nil { return nil, err }
+		addresses = append(addresses, a)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	return addresses, nil
+}
+
+// Method that returns a saved address of a customer. It returns sql.ErrNoRows if the customer does not have it.
+func (r *AddressRepository) GetAddress(userID, addressID uuid.UUID) (*models.Address, error) {
+	query := `
+	SELECT address_id, user_id, full_name, line1, line2, city, region, postal_code, country, phone, date_created
+	FROM addresses WHERE address_id = ? AND user_id = ?
+	`
+	var a models.Address
+	err := r.DB.QueryRow(query, addressID, userID).Scan(&a.AddressID, &a.UserID, &a.FullName, &a.Line1, &a.Line2, &a.City, &a.Region,
+		&a.PostalCode, &a.Country, &a.Phone, &a.DateCreated)
+	if err != nil { return nil, err }
+	return &a, nil
+}
+
+// Method that saves an address in the address book of its customer (UserID).
+func (r *AddressRepository) CreateAddress(address *models.Address) error {
+	query := `
+	INSERT INTO addresses (address_id, user_id, full_name, line1, line2, city, region, postal_code, country, phone, date_created)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	address.AddressID = uuid.New()
+	address.DateCreated = time.Now()
+	_, err := r.DB.Exec(query, address.AddressID, address.UserID, address.FullName, address.Line1, address.Line2, address.City, address.Region,
+		address.PostalCode, address.Country, address.Phone, address.DateCreated)
+	return err
+}
+
+// Method that deletes a saved address of a customer. It returns sql.ErrNoRows if the customer does not have it.
+func (r *AddressRepository) DeleteAddress(userID, addressID uuid.UUID) error {
+	result, err := r.DB.Exec(`DELETE FROM addresses WHERE address_id = ? AND user_id = ?`, addressID, userID)
+	if err != nil { return err }
+	deleted, err := result.RowsAffected()
+	if err != nil { return err }
+	if deleted == 0 { return sql.ErrNoRows }
+	return nil
+}
+
+// Inserts the shipping and billing addresses (if any) of an order in the transaction.
+func insertOrderAddresses(tx *sql.Tx, order *models.Order) error {
+	if err := insertOrderAddress(tx, order.OrderID, models.AddressTypeShipping, order.ShippingAddress); err != nil { return err }
+	return insertOrderAddress(tx, order.OrderID, models.AddressTypeBilling, order.BillingAddress)
+}
+
+// Inserts an address of an order (nothing if it is nil) in the transaction.
+func insertOrderAddress(tx *sql.Tx, orderID uuid.UUID, addressType string, a *models.Address) error {
+	if a == nil { return nil }
+	query := `
+	INSERT INTO order_addresses (order_id, address_type, full_name, line1, line2, city, region, postal_code, country, phone)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	_, err := tx.Exec(query, orderID, addressType, a.FullName, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone)
+	return err
+}
+
+// Sets the shipping and billing addresses of an order (they stay nil if the order has none).
+func loadOrderAddresses(db *sql.DB, order *models.Order) error {
+	query := `
+	SELECT address_type, full_name, line1, line2, city, region, postal_code, country, phone FROM order_addresses WHERE order_id = ?
+	`
+	rows, err := db.Query(query, order.OrderID)
+	if err != nil { return err }
+	defer rows.Close()
+
+	for rows.Next() {
+		var addressType string
+		var a models.Address
+		err := rows.Scan(&addressType, &a.FullName, &a.Line1, &a.Line2, &a.City, &a.Region, &a.PostalCode, &a.Country, &a.Phone)
+		if err != nil { return err }
+		switch addressType {
+			case models.AddressTypeShipping:
+				order.ShippingAddress = &a
+			case models.AddressTypeBilling:
+				order.BillingAddress = &a
+		}
+	}
+	return rows.Err()
+}
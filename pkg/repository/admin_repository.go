@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Returned when creating an admin with a role that does not exist.
+var ErrInvalidRole = errors.New("invalid admin role")
+
+// Custom type that holds a pointer to the database connection.
+type AdminRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new AdminRepository (pointer) with the database connection.
+func NewAdminRepository(db *sql.DB) *AdminRepository {
+	return &AdminRepository{DB: db}
+}
+
+// Method that creates a new admin (staff member) in the database with the password hashed (bcrypt).
+func (r *AdminRepository) CreateAdmin(admin *models.AdminUser, password string) error {
+	validRole := false
+	for _, role := range models.AdminRoles() {
+		if role == admin.Role { validRole = true }
+	}
+	if !validRole { return ErrInvalidRole }
+
+	admin.Email = strings.ToLower(strings.TrimSpace(admin.Email))
+
+	var count int
+	err := r.DB.QueryRow("SELECT COUNT(*) FROM admin_users WHERE email = ?", admin.Email).Scan(&count)
+	if err != nil { return err }
+	if count > 0 { return ErrEmailTaken }
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil { return err }
+
+	query := `INSERT INTO admin_users (admin_id, email, full_name, password_hash, role, date_created) VALUES (?, ?, ?, ?, ?, ?)`
+	admin.AdminID = uuid.New()
+	admin.PasswordHash = string(hash)
+	admin.DateCreated = time.Now()
+	_, err = r.DB.Exec(query, admin.AdminID, admin.Email, admin.FullName, admin.PasswordHash, admin.Role, admin.DateCreated)
+	return err
+}
+
+// Method that returns an admin by its ID from the database.
+func (r *AdminRepository) GetAdminByID(adminID uuid.UUID) (*models.AdminUser, error) {
+	query := `SELECT admin_id, email, full_name, password_hash, role, date_created FROM admin_users WHERE admin_id = ?`
+	var admin models.AdminUser
+	err := r.DB.QueryRow(query, adminID).Scan(&admin.AdminID, &admin.Email, &admin.FullName, &admin.PasswordHash, &admin.Role, &admin.DateCreated)
+	if err != nil { return nil, err }
+	return &admin, nil
+}
+
+// Method that returns the admin with the email if the password matches. It returns ErrInvalidCredentials otherwise.
+func (r *AdminRepository) Authenticate(email, password string) (*models.AdminUser, error) {
+	query := `SELECT admin_id, email, full_name, password_hash, role, date_created FROM admin_users WHERE email = ?`
+	var admin models.AdminUser
+	err := r.DB.QueryRow(query, strings.ToLower(strings.TrimSpace(email))).Scan(&admin.AdminID, &admin.Email, &admin.FullName,
+		&admin.PasswordHash, &admin.Role, &admin.DateCreated)
+	if err == sql.ErrNoRows { return nil, ErrInvalidCredentials }
+	if err != nil { return nil, err }
+
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)) != nil { return nil, ErrInvalidCredentials }
+	return &admin, nil
+}
+
+// Method that returns all the admins (staff members) in the database.
+func (r *AdminRepository) ListAdmins() ([]models.AdminUser, error) {
+	query := `SELECT admin_id, email, full_name, role, date_created FROM admin_users ORDER BY date_created`
+	rows, err := r.DB.Query(query)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	var admins []models.AdminUser
+	for rows.Next() {
+		var admin models.AdminUser
+		err := rows.Scan(&admin.AdminID, &admin.Email, &admin.FullName, &admin.Role, &admin.DateCreated)
+		if err != nil { return nil, err }
+		admins = append(admins, admin)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	return admins, nil
+}
+
+// Method that returns the total number of admins in the database.
+func (r *AdminRepository) GetTotalAdminsCount() (int, error) {
+	var count int
+	err := r.DB.QueryRow("SELECT COUNT(*) FROM admin_users").Scan(&count)
+	if err != nil { return 0, err }
+	return count, nil
+}
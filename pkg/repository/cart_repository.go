@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Custom type that holds a pointer to the database connection.
+type CartRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new CartRepository (pointer) with the database connection.
+func NewCartRepository(db *sql.DB) *CartRepository {
+	return &CartRepository{DB: db}
+}
+
+// Method that returns the cart of a session with its items (and their products). It returns sql.ErrNoRows if the session has no cart.
+func (r *CartRepository) GetCartBySession(sessionID string) (*models.Cart, error) {
+	return r.getCart(`SELECT cart_id, session_id, COALESCE(user_id, ''), date_created, date_modified FROM carts WHERE session_id = ?`, sessionID)
+}
+
+// Method that returns the cart of a customer with its items (and their products). It returns sql.ErrNoRows if the customer has no cart.
+func (r *CartRepository) GetCartByUser(userID string) (*models.Cart, error) {
+	return r.getCart(`SELECT cart_id, session_id, COALESCE(user_id, ''), date_created, date_modified FROM carts WHERE user_id = ?`, userID)
+}
+
+// Returns the cart found by the query with its items (and their products, with the stock of the chosen variant and the
+// weight, dimensions and tax class the shipping rates and the tax rules use). The price of every product is the price of the cart item (the one the
+// shopper saw), not the current one.
+func (r *CartRepository) getCart(cartQuery string, arg any) (*models.Cart, error) {
+	var cart models.Cart
+	err := r.DB.QueryRow(cartQuery, arg).Scan(&cart.CartID, &cart.SessionID, &cart.UserID, &cart.DateCreated, &cart.DateModified)
+	if err != nil { return nil, err }
+
+	itemsQuery := `
+	SELECT ci.product_id, ci.variant_id, ci.quantity, ci.price, p.product_name, p.price, p.tax_class, p.stock, p.weight, p.length, p.width, p.height,
+		p.description, p.product_image, p.date_created, p.date_modified
+	FROM cart_items ci JOIN products p ON ci.product_id = p.product_id WHERE ci.cart_id = ? ORDER BY ci.date_added
+	`
+	rows, err := r.DB.Query(itemsQuery, cart.CartID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	var prices []models.Money
+	for rows.Next() {
+		var item models.OrderItem
+		var price models.Money
+		err := rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity, &price, &item.Product.ProductName, &item.Product.Price, &item.Product.TaxClass,
+			&item.Product.Stock, &item.Product.Weight, &item.Product.Length, &item.Product.Width, &item.Product.Height, &item.Product.Description, &item.Product.ProductImage,
+			&item.Product.DateCreated, &item.Product.DateModified)
+		if err != nil { return nil, err }
+		item.OrderID = cart.CartID
+		item.Product.ProductID = item.ProductID
+		cart.Items = append(cart.Items, item)
+		prices = append(prices, price)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	if err = attachVariants(r.DB, cart.Items); err != nil { return nil, err }
+
+	for i := range cart.Items {
+		cart.Items[i].Product.Price = prices[i]
+	}
+	return &cart, nil
+}
+
+// Method that creates a new (empty) cart for a session (and customer, if logged in) in the database.
+func (r *CartRepository) CreateCart(cart *models.Cart) error {
+	query := `INSERT INTO carts (cart_id, session_id, user_id, date_created, date_modified) VALUES (?, ?, ?, ?, ?)`
+	cart.CartID = uuid.New()
+	cart.DateCreated = time.Now()
+	cart.DateModified = time.Now()
+	_, err := r.DB.Exec(query, cart.CartID, cart.SessionID, nullString(cart.UserID), cart.DateCreated, cart.DateModified)
+	return err
+}
+
+// Method that links a cart to a session and a customer (used when a customer logs in).
+func (r *CartRepository) AssignCart(cartID uuid.UUID, sessionID, userID string) error {
+	query := `UPDATE carts SET session_id = ?, user_id = ?, date_modified = ? WHERE cart_id = ?`
+	_, err := r.DB.Exec(query, sessionID, nullString(userID), time.Now(), cartID)
+	return err
+}
+
+// Method that inserts an item (a product or one of its variants) at a price in a cart and marks the cart as modified.
+func (r *CartRepository) AddCartItem(cartID, productID, variantID uuid.UUID, quantity int, price models.Money) error {
+	return r.withCartTx(cartID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, price, date_added) VALUES (?, ?, ?, ?, ?, ?)`,
+			cartID, productID, variantValue(variantID), quantity, price, time.Now())
+		return err
+	})
+}
+
+// Method that updates the quantity of an item in a cart and marks the cart as modified.
+func (r *CartRepository) UpdateCartItemQuantity(cartID, productID, variantID uuid.UUID, quantity int) error {
+	return r.withCartTx(cartID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE cart_items SET quantity = ? WHERE cart_id = ? AND product_id = ? AND variant_id = ?`,
+			quantity, cartID, productID, variantValue(variantID))
+		return err
+	})
+}
+
+// Method that removes an item from a cart and marks the cart as modified.
+func (r *CartRepository) RemoveCartItem(cartID, productID, variantID uuid.UUID) error {
+	return r.withCartTx(cartID, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`DELETE FROM cart_items WHERE cart_id = ? AND product_id = ? AND variant_id = ?`, cartID, productID, variantValue(variantID))
+		return err
+	})
+}
+
+// Method that deletes a cart and its items from the database.
+func (r *CartRepository) DeleteCart(cartID uuid.UUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	if _, err = tx.Exec(`DELETE FROM cart_items WHERE cart_id = ?`, cartID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM carts WHERE cart_id = ?`, cartID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Method that deletes the carts (and their items) that have not been modified for longer than the idle period.
+// It returns the number of deleted carts.
+func (r *CartRepository) DeleteExpiredCarts(idle time.Duration) (int64, error) {
+	cutoff := time.Now().Add(-idle)
+
+	tx, err := r.DB.Begin()
+	if err != nil { return 0, err }
+
+	_, err = tx.Exec(`DELETE ci FROM cart_items ci JOIN carts c ON ci.cart_id = c.cart_id WHERE c.date_modified < ?`, cutoff)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	result, err := tx.Exec(`DELETE FROM carts WHERE date_modified < ?`, cutoff)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil { return 0, err }
+	return result.RowsAffected()
+}
+
+// Runs a change to the items of a cart in a transaction that also updates the cart modification date (so it does not expire).
+func (r *CartRepository) withCartTx(cartID uuid.UUID, change func(tx *sql.Tx) error) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	if err = change(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE carts SET date_modified = ? WHERE cart_id = ?`, time.Now(), cartID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+
+// Returns a NULL database value for an empty string.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Returned when a category would become its own parent (directly or through one of its subcategories).
+var ErrCategoryCycle = errors.New("a category can not be moved into itself or one of its subcategories")
+
+// Custom type (error) returned when deleting a category that still has products or subcategories without choosing the
+// category they are moved to, so products are never left without their category silently.
+type CategoryInUseError struct {
+	Products      int
+	Subcategories int
+}
+
+func (e *CategoryInUseError) Error() string {
+	return fmt.Sprintf("the category has %d products and %d subcategories", e.Products, e.Subcategories)
+}
+
+// Custom type that runs a query that returns one row (a *sql.DB or a *sql.Tx).
+type rowQuerier interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// Custom type that holds a pointer to the database connection.
+type CategoryRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new CategoryRepository (pointer) with the database connection.
+func NewCategoryRepository(db *sql.DB) *CategoryRepository {
+	return &CategoryRepository{DB: db}
+}
+
+// Method that returns every category (with its number of products) in tree order.
+func (r *CategoryRepository) ListCategories() ([]models.Category, error) {
+	query := `SELECT c.category_id, c.parent_id, c.name, c.description, c.date_created, c.date_modified,
+		(SELECT COUNT(*) FROM product_categories pc WHERE pc.category_id = c.category_id)
+		FROM categories c`
+	rows, err := r.DB.Query(query)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	var categories []models.Category
+	for rows.Next() {
+		var c models.Category
+		err := rows.Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Description, &c.DateCreated, &c.DateModified, &c.ProductCount)
+		if err != nil { return nil, err }
+		categories = append(categories, c)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	return models.CategoryTree(categories), nil
+}
+
+// Method that returns a category by its ID from the database.
+func (r *CategoryRepository) GetCategoryByID(categoryID uuid.UUID) (*models.Category, error) {
+	query := `SELECT c.category_id, c.parent_id, c.name, c.description, c.date_created, c.date_modified,
+		(SELECT COUNT(*) FROM product_categories pc WHERE pc.category_id = c.category_id)
+		FROM categories c WHERE c.category_id = ?`
+	var c models.Category
+	err := r.DB.QueryRow(query, categoryID).Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Description, &c.DateCreated, &c.DateModified, &c.ProductCount)
+	if err != nil { return nil, err }
+	return &c, nil
+}
+
+// Method that creates a new category in the database. It returns sql.ErrNoRows if the parent category does not exist.
+func (r *CategoryRepository) CreateCategory(category *models.Category) error {
+	if category.ParentID.Valid {
+		var exists int
+		err := r.DB.QueryRow("SELECT 1 FROM categories WHERE category_id = ?", category.ParentID.UUID).Scan(&exists)
+		if err != nil { return err }
+	}
+
+	query := `INSERT INTO categories (category_id, parent_id, name, description, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?)`
+	category.CategoryID = uuid.New()
+	category.DateCreated = time.Now()
+	category.DateModified = time.Now()
+	_, err := r.DB.Exec(query, category.CategoryID, category.ParentID, category.Name, category.Description, category.DateCreated, category.DateModified)
+	return err
+}
+
+// Method that updates the name, description and parent of a category. It returns ErrCategoryCycle if the new parent is
+// the category itself or one of its subcategories and sql.ErrNoRows if the parent does not exist.
+func (r *CategoryRepository) UpdateCategory(category *models.Category) error {
+	if category.ParentID.Valid {
+		if err := checkParent(r.DB, category.CategoryID, category.ParentID.UUID); err != nil { return err }
+	}
+
+	query := `UPDATE categories SET parent_id = ?, name = ?, description = ?, date_modified = ? WHERE category_id = ?`
+	category.DateModified = time.Now()
+	_, err := r.DB.Exec(query, category.ParentID, category.Name, category.Description, category.DateModified, category.CategoryID)
+	return err
+}
+
+// Method that deletes a category. A category that still has products or subcategories is only deleted if moveTo is set:
+// its products are added to the moveTo category and its subcategories become children of it. Otherwise it returns a
+// *CategoryInUseError (the foreign keys also stop a product added meanwhile from being unlinked).
+func (r *CategoryRepository) DeleteCategory(categoryID uuid.UUID, moveTo uuid.NullUUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	// Lock the category, so products can not be added to it while it is being deleted
+	var locked uuid.UUID
+	if err = tx.QueryRow("SELECT category_id FROM categories WHERE category_id = ? FOR UPDATE", categoryID).Scan(&locked); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	var inUse CategoryInUseError
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM product_categories WHERE category_id = ?), (SELECT COUNT(*) FROM categories WHERE parent_id = ?)`,
+		categoryID, categoryID).Scan(&inUse.Products, &inUse.Subcategories)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if inUse.Products > 0 || inUse.Subcategories > 0 {
+		if !moveTo.Valid {
+			tx.Rollback()
+			return &inUse
+		}
+		if err = checkParent(tx, categoryID, moveTo.UUID); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		// Move the products (the ones already in the target category keep a single link) and the subcategories
+		_, err = tx.Exec(`INSERT IGNORE INTO product_categories (product_id, category_id) SELECT product_id, ? FROM product_categories WHERE category_id = ?`,
+			moveTo.UUID, categoryID)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Exec(`DELETE FROM product_categories WHERE category_id = ?`, categoryID); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err = tx.Exec(`UPDATE categories SET parent_id = ?, date_modified = ? WHERE parent_id = ?`, moveTo.UUID, time.Now(), categoryID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM categories WHERE category_id = ?`, categoryID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Method that replaces the categories of a product.
+func (r *CategoryRepository) SetProductCategories(productID uuid.UUID, categoryIDs []uuid.UUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	if _, err = tx.Exec(`DELETE FROM product_categories WHERE product_id = ?`, productID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, categoryID := range categoryIDs {
+		if _, err = tx.Exec(`INSERT IGNORE INTO product_categories (product_id, category_id) VALUES (?, ?)`, productID, categoryID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Checks that a category can be moved under the parent by walking up from the parent to the top level. It returns
+// ErrCategoryCycle if the category is found on the way and sql.ErrNoRows if the parent does not exist.
+func checkParent(q rowQuerier, categoryID, parentID uuid.UUID) error {
+	for id := parentID; ; {
+		if id == categoryID { return ErrCategoryCycle }
+
+		var next uuid.NullUUID
+		if err := q.QueryRow("SELECT parent_id FROM categories WHERE category_id = ?", id).Scan(&next); err != nil { return err }
+		if !next.Valid { return nil }
+		id = next.UUID
+	}
+}
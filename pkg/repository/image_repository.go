@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Returned when reordering the images of a product with a list that is not exactly the images of the product.
+var ErrInvalidImageOrder = errors.New("the new order must have every image of the product once")
+
+// Custom type that holds a pointer to the database connection.
+type ImageRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new ImageRepository (pointer) with the database connection.
+func NewImageRepository(db *sql.DB) *ImageRepository {
+	return &ImageRepository{DB: db}
+}
+
+// Method that returns the images of a product in gallery order.
+func (r *ImageRepository) ListImages(productID uuid.UUID) ([]models.ProductImage, error) {
+	products := []models.Product{{ProductID: productID}}
+	if err := loadImages(r.DB, products); err != nil { return nil, err }
+	return products[0].Images, nil
+}
+
+// Method that adds images (file names in the upload directory) at the end of the gallery of a product. The first image of
+// a product without images becomes its primary image.
+func (r *ImageRepository) AddImages(productID uuid.UUID, filenames []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	// Lock the product, so concurrent uploads do not get the same positions
+	var count, next int
+	if err = tx.QueryRow(`SELECT 1 FROM products WHERE product_id = ? FOR UPDATE`, productID).Scan(&count); err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.QueryRow(`SELECT COUNT(*), COALESCE(MAX(sort_order) + 1, 0) FROM product_images WHERE product_id = ?`, productID).Scan(&count, &next)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for i, filename := range filenames {
+		_, err = tx.Exec(`INSERT INTO product_images (image_id, product_id, filename, is_primary, sort_order, date_created) VALUES (?, ?, ?, ?, ?, ?)`,
+			uuid.New(), productID, filename, count == 0 && i == 0, next+i, time.Now())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err = syncPrimaryImage(tx, productID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Method that makes an image the primary image of its product. It returns sql.ErrNoRows if the product has no such image.
+func (r *ImageRepository) SetPrimaryImage(productID, imageID uuid.UUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	var exists int
+	if err = tx.QueryRow(`SELECT 1 FROM product_images WHERE image_id = ? AND product_id = ?`, imageID, productID).Scan(&exists); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(`UPDATE product_images SET is_primary = (image_id = ?) WHERE product_id = ?`, imageID, productID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err = syncPrimaryImage(tx, productID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Method that sets the gallery order of the images of a product. The IDs must be every image of the product once,
+// otherwise it returns ErrInvalidImageOrder.
+func (r *ImageRepository) ReorderImages(productID uuid.UUID, imageIDs []uuid.UUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	rows, err := tx.Query(`SELECT image_id FROM product_images WHERE product_id = ? FOR UPDATE`, productID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	current := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var imageID uuid.UUID
+		if err = rows.Scan(&imageID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		current[imageID] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Every image of the product once
+	if len(imageIDs) != len(current) {
+		tx.Rollback()
+		return ErrInvalidImageOrder
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, imageID := range imageIDs {
+		if !current[imageID] || seen[imageID] {
+			tx.Rollback()
+			return ErrInvalidImageOrder
+		}
+		seen[imageID] = true
+	}
+
+	for position, imageID := range imageIDs {
+		if _, err = tx.Exec(`UPDATE product_images SET sort_order = ? WHERE image_id = ?`, position, imageID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Method that deletes an image of a product and returns its file name, so the file can be removed once the image is no
+// longer referenced. If it was the primary image, the first image left in the gallery becomes the primary image.
+func (r *ImageRepository) DeleteImage(productID, imageID uuid.UUID) (string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil { return "", err }
+
+	var filename string
+	var isPrimary bool
+	err = tx.QueryRow(`SELECT filename, is_primary FROM product_images WHERE image_id = ? AND product_id = ? FOR UPDATE`, imageID, productID).Scan(&filename, &isPrimary)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM product_images WHERE image_id = ?`, imageID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if isPrimary {
+		_, err = tx.Exec(`UPDATE product_images SET is_primary = TRUE WHERE product_id = ? ORDER BY sort_order LIMIT 1`, productID)
+		if err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	if err = syncPrimaryImage(tx, productID); err != nil {
+		tx.Rollback()
+		return "", err
+	}
+	if err = tx.Commit(); err != nil { return "", err }
+	return filename, nil
+}
+
+// Replaces the file of the primary image of a product (adding a primary image at the start of the gallery if it has none)
+// and returns the file name of the replaced image.
+func replacePrimaryImage(tx *sql.Tx, productID uuid.UUID, filename string) (string, error) {
+	var imageID uuid.UUID
+	var oldFilename string
+	err := tx.QueryRow(`SELECT image_id, filename FROM product_images WHERE product_id = ? AND is_primary FOR UPDATE`, productID).Scan(&imageID, &oldFilename)
+	switch err {
+		case nil:
+			_, err = tx.Exec(`UPDATE product_images SET filename = ? WHERE image_id = ?`, filename, imageID)
+		case sql.ErrNoRows:
+			_, err = tx.Exec(`INSERT INTO product_images (image_id, product_id, filename, is_primary, sort_order, date_created)
+				SELECT ?, ?, ?, TRUE, COALESCE(MIN(sort_order) - 1, 0), ? FROM product_images WHERE product_id = ?`,
+				uuid.New(), productID, filename, time.Now(), productID)
+	}
+	if err != nil { return "", err }
+
+	if err = syncPrimaryImage(tx, productID); err != nil { return "", err }
+	return oldFilename, nil
+}
+
+// Copies the file name of the primary image of a product to products.product_image (empty if it has no images), so the
+// product listings do not have to join the images.
+func syncPrimaryImage(tx *sql.Tx, productID uuid.UUID) error {
+	_, err := tx.Exec(`UPDATE products SET product_image = COALESCE(
+		(SELECT filename FROM product_images WHERE product_id = ? AND is_primary LIMIT 1), '') WHERE product_id = ?`, productID, productID)
+	return err
+}
+
+// Loads the images (in gallery order) of the products.
+func loadImages(db *sql.DB, products []models.Product) error {
+	if len(products) == 0 { return nil }
+
+	index := map[uuid.UUID]int{}
+	args := make([]any, len(products))
+	for i, p := range products {
+		index[p.ProductID] = i
+		args[i] = p.ProductID
+		products[i].Images = nil
+	}
+
+	query := `SELECT image_id, product_id, filename, is_primary, sort_order, date_created FROM product_images
+		WHERE product_id IN (?` + strings.Repeat(", ?", len(products)-1) + `) ORDER BY sort_order, date_created`
+	rows, err := db.Query(query, args...)
+	if err != nil { return err }
+	defer rows.Close()
+
+	for rows.Next() {
+		var image models.ProductImage
+		err := rows.Scan(&image.ImageID, &image.ProductID, &image.Filename, &image.IsPrimary, &image.SortOrder, &image.DateCreated)
+		if err != nil { return err }
+		p := &products[index[image.ProductID]]
+		p.Images = append(p.Images, image)
+	}
+	return rows.Err()
+}
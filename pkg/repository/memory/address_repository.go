@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the address books of the customers in memory (repository.AddressStore).
+type AddressRepository struct {
+	db *database
+}
+
+// Method that returns the saved addresses of a customer (oldest first).
+func (r *AddressRepository) ListAddresses(userID uuid.UUID) ([]models.Address, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var addresses []models.Address
+	for _, a := range r.db.addresses {
+		if a.UserID == userID { addresses = append(addresses, a) }
+	}
+	return addresses, nil
+}
+
+// Method that returns a saved address of a customer. It returns sql.ErrNoRows if the customer does not have it.
+func (r *AddressRepository) GetAddress(userID, addressID uuid.UUID) (*models.Address, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := r.db.addressIndex(userID, addressID)
+	if i < 0 { return nil, sql.ErrNoRows }
+	a := r.db.addresses[i]
+	return &a, nil
+}
+
+// Method that saves an address in the address book of its customer (UserID). It returns sql.ErrNoRows if the customer
+// does not exist.
+func (r *AddressRepository) CreateAddress(address *models.Address) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if !slices.ContainsFunc(r.db.users, func(u models.User) bool { return u.UserID == address.UserID }) { return sql.ErrNoRows }
+
+	address.AddressID = uuid.New()
+	address.DateCreated = time.Now()
+	r.db.addresses = append(r.db.addresses, *address)
+	return nil
+}
+
+// Method that deletes a saved address of a customer. It returns sql.ErrNoRows if the customer does not have it.
+func (r *AddressRepository) DeleteAddress(userID, addressID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i := r.db.addressIndex(userID, addressID)
+	if i < 0 { return sql.ErrNoRows }
+	r.db.addresses = slices.Delete(r.db.addresses, i, i+1)
+	return nil
+}
+
+/*** Helper Functions ***/
+
+// Returns the index of a saved address of a customer in the addresses table (-1 if the customer does not have it).
+func (db *database) addressIndex(userID, addressID uuid.UUID) int {
+	return slices.IndexFunc(db.addresses, func(a models.Address) bool { return a.AddressID == addressID && a.UserID == userID })
+}
@@ -0,0 +1,87 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Custom type that stores the admins (staff members) in memory (repository.AdminStore).
+type AdminRepository struct {
+	db *database
+}
+
+// Method that creates a new admin (staff member) with the password hashed (bcrypt). It returns repository.ErrInvalidRole
+// if the role does not exist and repository.ErrEmailTaken if another admin has the email.
+func (r *AdminRepository) CreateAdmin(admin *models.AdminUser, password string) error {
+	if !slices.Contains(models.AdminRoles(), admin.Role) { return repository.ErrInvalidRole }
+	admin.Email = strings.ToLower(strings.TrimSpace(admin.Email))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil { return err }
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, a := range r.db.admins {
+		if a.Email == admin.Email { return repository.ErrEmailTaken }
+	}
+
+	admin.AdminID = uuid.New()
+	admin.PasswordHash = string(hash)
+	admin.DateCreated = time.Now()
+	r.db.admins = append(r.db.admins, *admin)
+	return nil
+}
+
+// Method that returns an admin by its ID.
+func (r *AdminRepository) GetAdminByID(adminID uuid.UUID) (*models.AdminUser, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, a := range r.db.admins {
+		if a.AdminID == adminID { return &a, nil }
+	}
+	return nil, sql.ErrNoRows
+}
+
+// Method that returns the admin with the email if the password matches. It returns repository.ErrInvalidCredentials otherwise.
+func (r *AdminRepository) Authenticate(email, password string) (*models.AdminUser, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, a := range r.db.admins {
+		if a.Email != email { continue }
+		if bcrypt.CompareHashAndPassword([]byte(a.PasswordHash), []byte(password)) != nil { return nil, repository.ErrInvalidCredentials }
+		return &a, nil
+	}
+	return nil, repository.ErrInvalidCredentials
+}
+
+// Method that returns all the admins (oldest first, without their password hash).
+func (r *AdminRepository) ListAdmins() ([]models.AdminUser, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var admins []models.AdminUser
+	for _, a := range r.db.admins {
+		a.PasswordHash = ""
+		admins = append(admins, a)
+	}
+	sort.SliceStable(admins, func(i, j int) bool { return admins[i].DateCreated.Before(admins[j].DateCreated) })
+	return admins, nil
+}
+
+// Method that returns the total number of admins.
+func (r *AdminRepository) GetTotalAdminsCount() (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return len(r.db.admins), nil
+}
@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"sort"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the carts of the sessions and customers in memory (repository.CartStore).
+type CartRepository struct {
+	db *database
+}
+
+// Method that returns the cart of a session with its items (and their products). It returns sql.ErrNoRows if the session has no cart.
+func (r *CartRepository) GetCartBySession(sessionID string) (*models.Cart, error) {
+	return r.getCart(func(c models.Cart) bool { return c.SessionID == sessionID })
+}
+
+// Method that returns the cart of a customer with its items (and their products). It returns sql.ErrNoRows if the customer has no cart.
+func (r *CartRepository) GetCartByUser(userID string) (*models.Cart, error) {
+	return r.getCart(func(c models.Cart) bool { return userID != "" && c.UserID == userID })
+}
+
+// Returns the cart found by the check with its items (and their products, with the stock of the chosen variant). The price
+// of every product is the price of the cart item (the one the shopper saw), not the current one.
+func (r *CartRepository) getCart(check func(c models.Cart) bool) (*models.Cart, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := slices.IndexFunc(r.db.carts, check)
+	if i < 0 { return nil, sql.ErrNoRows }
+	cart := r.db.carts[i]
+
+	var items []cartItem
+	for _, item := range r.db.cartItems {
+		if item.cartID == cart.CartID { items = append(items, item) }
+	}
+	sort.SliceStable(items, func(i, j int) bool { return items[i].dateAdded.Before(items[j].dateAdded) })
+	var prices []models.Money
+	for _, item := range items {
+		p := r.db.productIndex(item.productID)
+		if p < 0 { continue }
+		cart.Items = append(cart.Items, models.OrderItem{
+			OrderID:   cart.CartID,
+			ProductID: item.productID,
+			VariantID: item.variantID,
+			Quantity:  item.quantity,
+			Product:   r.db.products[p],
+		})
+		prices = append(prices, item.price)
+	}
+	r.db.attachVariants(cart.Items)
+
+	for i := range cart.Items {
+		cart.Items[i].Product.Price = prices[i]
+	}
+	return &cart, nil
+}
+
+// Method that creates a new (empty) cart for a session (and customer, if logged in). It returns ErrDuplicate if the
+// session or the customer already has a cart.
+func (r *CartRepository) CreateCart(cart *models.Cart) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, c := range r.db.carts {
+		if c.SessionID == cart.SessionID || (cart.UserID != "" && c.UserID == cart.UserID) { return ErrDuplicate }
+	}
+
+	cart.CartID = uuid.New()
+	cart.DateCreated = time.Now()
+	cart.DateModified = time.Now()
+	r.db.carts = append(r.db.carts, models.Cart{
+		CartID:       cart.CartID,
+		SessionID:    cart.SessionID,
+		UserID:       cart.UserID,
+		DateCreated:  cart.DateCreated,
+		DateModified: cart.DateModified,
+	})
+	return nil
+}
+
+// Method that links a cart to a session and a customer (used when a customer logs in).
+func (r *CartRepository) AssignCart(cartID uuid.UUID, sessionID, userID string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, c := range r.db.carts {
+		if c.CartID == cartID { continue }
+		if c.SessionID == sessionID || (userID != "" && c.UserID == userID) { return ErrDuplicate }
+	}
+	if i := r.db.cartIndex(cartID); i >= 0 {
+		r.db.carts[i].SessionID = sessionID
+		r.db.carts[i].UserID = userID
+		r.db.carts[i].DateModified = time.Now()
+	}
+	return nil
+}
+
+// Method that inserts an item (a product or one of its variants) at a price in a cart and marks the cart as modified. It
+// returns ErrDuplicate if the item is already in the cart and sql.ErrNoRows if the cart or the product does not exist.
+func (r *CartRepository) AddCartItem(cartID, productID, variantID uuid.UUID, quantity int, price models.Money) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.cartIndex(cartID) < 0 || r.db.productIndex(productID) < 0 { return sql.ErrNoRows }
+	if r.db.cartItemIndex(cartID, productID, variantID) >= 0 { return ErrDuplicate }
+
+	r.db.cartItems = append(r.db.cartItems, cartItem{cartID: cartID, productID: productID, variantID: variantID, quantity: quantity, price: price,
+		dateAdded: time.Now()})
+	r.db.touchCart(cartID)
+	return nil
+}
+
+// Method that updates the quantity of an item in a cart and marks the cart as modified.
+func (r *CartRepository) UpdateCartItemQuantity(cartID, productID, variantID uuid.UUID, quantity int) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if i := r.db.cartItemIndex(cartID, productID, variantID); i >= 0 { r.db.cartItems[i].quantity = quantity }
+	r.db.touchCart(cartID)
+	return nil
+}
+
+// Method that removes an item from a cart and marks the cart as modified.
+func (r *CartRepository) RemoveCartItem(cartID, productID, variantID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if i := r.db.cartItemIndex(cartID, productID, variantID); i >= 0 { r.db.cartItems = slices.Delete(r.db.cartItems, i, i+1) }
+	r.db.touchCart(cartID)
+	return nil
+}
+
+// Method that deletes a cart and its items.
+func (r *CartRepository) DeleteCart(cartID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.cartItems = slices.DeleteFunc(r.db.cartItems, func(item cartItem) bool { return item.cartID == cartID })
+	r.db.carts = slices.DeleteFunc(r.db.carts, func(c models.Cart) bool { return c.CartID == cartID })
+	return nil
+}
+
+// Method that deletes the carts (and their items) that have not been modified for longer than the idle period.
+// It returns the number of deleted carts.
+func (r *CartRepository) DeleteExpiredCarts(idle time.Duration) (int64, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	cutoff := time.Now().Add(-idle)
+	expired := map[uuid.UUID]bool{}
+	r.db.carts = slices.DeleteFunc(r.db.carts, func(c models.Cart) bool {
+		if !c.DateModified.Before(cutoff) { return false }
+		expired[c.CartID] = true
+		return true
+	})
+	r.db.cartItems = slices.DeleteFunc(r.db.cartItems, func(item cartItem) bool { return expired[item.cartID] })
+	return int64(len(expired)), nil
+}
+
+/*** Helper Functions ***/
+
+// Returns the index of the cart in the carts table (-1 if it does not exist).
+func (db *database) cartIndex(cartID uuid.UUID) int {
+	return slices.IndexFunc(db.carts, func(c models.Cart) bool { return c.CartID == cartID })
+}
+
+// Returns the index of an item of a cart in the cart items table (-1 if the cart does not have it).
+func (db *database) cartItemIndex(cartID, productID, variantID uuid.UUID) int {
+	return slices.IndexFunc(db.cartItems, func(item cartItem) bool {
+		return item.cartID == cartID && item.productID == productID && item.variantID == variantID
+	})
+}
+
+// Updates the modification date of a cart (so it does not expire).
+func (db *database) touchCart(cartID uuid.UUID) {
+	if i := db.cartIndex(cartID); i >= 0 { db.carts[i].DateModified = time.Now() }
+}
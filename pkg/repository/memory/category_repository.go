@@ -0,0 +1,171 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the categories and the categories of the products in memory (repository.CategoryStore).
+type CategoryRepository struct {
+	db *database
+}
+
+// Method that returns every category (with its number of products) in tree order.
+func (r *CategoryRepository) ListCategories() ([]models.Category, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	categories := make([]models.Category, len(r.db.categories))
+	for i, c := range r.db.categories {
+		c.ProductCount = r.db.productCount(c.CategoryID)
+		categories[i] = c
+	}
+	return models.CategoryTree(categories), nil
+}
+
+// Method that returns a category by its ID (with its number of products).
+func (r *CategoryRepository) GetCategoryByID(categoryID uuid.UUID) (*models.Category, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := r.db.categoryIndex(categoryID)
+	if i < 0 { return nil, sql.ErrNoRows }
+	c := r.db.categories[i]
+	c.ProductCount = r.db.productCount(categoryID)
+	return &c, nil
+}
+
+// Method that creates a new category. It returns sql.ErrNoRows if the parent category does not exist.
+func (r *CategoryRepository) CreateCategory(category *models.Category) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if category.ParentID.Valid && r.db.categoryIndex(category.ParentID.UUID) < 0 { return sql.ErrNoRows }
+
+	category.CategoryID = uuid.New()
+	category.DateCreated = time.Now()
+	category.DateModified = time.Now()
+	r.db.categories = append(r.db.categories, models.Category{
+		CategoryID:   category.CategoryID,
+		ParentID:     category.ParentID,
+		Name:         category.Name,
+		Description:  category.Description,
+		DateCreated:  category.DateCreated,
+		DateModified: category.DateModified,
+	})
+	return nil
+}
+
+// Method that updates the name, description and parent of a category. It returns repository.ErrCategoryCycle if the new
+// parent is the category itself or one of its subcategories and sql.ErrNoRows if the parent does not exist.
+func (r *CategoryRepository) UpdateCategory(category *models.Category) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if category.ParentID.Valid {
+		if err := r.db.checkParent(category.CategoryID, category.ParentID.UUID); err != nil { return err }
+	}
+
+	category.DateModified = time.Now()
+	if i := r.db.categoryIndex(category.CategoryID); i >= 0 {
+		stored := &r.db.categories[i]
+		stored.ParentID = category.ParentID
+		stored.Name = category.Name
+		stored.Description = category.Description
+		stored.DateModified = category.DateModified
+	}
+	return nil
+}
+
+// Method that deletes a category. A category that still has products or subcategories is only deleted if moveTo is set:
+// its products are added to the moveTo category and its subcategories become children of it. Otherwise it returns a
+// *repository.CategoryInUseError.
+func (r *CategoryRepository) DeleteCategory(categoryID uuid.UUID, moveTo uuid.NullUUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.categoryIndex(categoryID) < 0 { return sql.ErrNoRows }
+
+	inUse := repository.CategoryInUseError{Products: r.db.productCount(categoryID)}
+	for _, c := range r.db.categories {
+		if c.ParentID.Valid && c.ParentID.UUID == categoryID { inUse.Subcategories++ }
+	}
+
+	if inUse.Products > 0 || inUse.Subcategories > 0 {
+		if !moveTo.Valid { return &inUse }
+		if err := r.db.checkParent(categoryID, moveTo.UUID); err != nil { return err }
+
+		// Move the products (the ones already in the target category keep a single link) and the subcategories
+		for _, link := range r.db.productCategories {
+			if link.categoryID == categoryID { r.db.linkProduct(link.productID, moveTo.UUID) }
+		}
+		for i := range r.db.categories {
+			c := &r.db.categories[i]
+			if c.ParentID.Valid && c.ParentID.UUID == categoryID {
+				c.ParentID = moveTo
+				c.DateModified = time.Now()
+			}
+		}
+	}
+
+	r.db.productCategories = slices.DeleteFunc(r.db.productCategories, func(link productCategory) bool { return link.categoryID == categoryID })
+	r.db.categories = slices.DeleteFunc(r.db.categories, func(c models.Category) bool { return c.CategoryID == categoryID })
+	return nil
+}
+
+// Method that replaces the categories of a product. It returns sql.ErrNoRows if the product or one of the categories
+// does not exist (and changes nothing).
+func (r *CategoryRepository) SetProductCategories(productID uuid.UUID, categoryIDs []uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, categoryID := range categoryIDs {
+		if r.db.categoryIndex(categoryID) < 0 { return sql.ErrNoRows }
+	}
+	if len(categoryIDs) > 0 && r.db.productIndex(productID) < 0 { return sql.ErrNoRows }
+
+	r.db.productCategories = slices.DeleteFunc(r.db.productCategories, func(link productCategory) bool { return link.productID == productID })
+	for _, categoryID := range categoryIDs {
+		r.db.linkProduct(productID, categoryID)
+	}
+	return nil
+}
+
+/*** Helper Functions ***/
+
+// Returns the index of the category in the categories table (-1 if it does not exist).
+func (db *database) categoryIndex(categoryID uuid.UUID) int {
+	return slices.IndexFunc(db.categories, func(c models.Category) bool { return c.CategoryID == categoryID })
+}
+
+// Returns the number of products in a category (without the ones of its subcategories).
+func (db *database) productCount(categoryID uuid.UUID) int {
+	count := 0
+	for _, link := range db.productCategories {
+		if link.categoryID == categoryID { count++ }
+	}
+	return count
+}
+
+// Adds a product to a category, unless it is already in it.
+func (db *database) linkProduct(productID, categoryID uuid.UUID) {
+	link := productCategory{productID: productID, categoryID: categoryID}
+	if !slices.Contains(db.productCategories, link) { db.productCategories = append(db.productCategories, link) }
+}
+
+// Checks that a category can be moved under the parent by walking up from the parent to the top level. It returns
+// repository.ErrCategoryCycle if the category is found on the way and sql.ErrNoRows if the parent does not exist.
+func (db *database) checkParent(categoryID, parentID uuid.UUID) error {
+	for id := parentID; ; {
+		if id == categoryID { return repository.ErrCategoryCycle }
+
+		i := db.categoryIndex(id)
+		if i < 0 { return sql.ErrNoRows }
+		if !db.categories[i].ParentID.Valid { return nil }
+		id = db.categories[i].ParentID.UUID
+	}
+}
@@ -0,0 +1,147 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the image galleries of the products in memory (repository.ImageStore).
+type ImageRepository struct {
+	db *database
+}
+
+// Method that returns the images of a product in gallery order.
+func (r *ImageRepository) ListImages(productID uuid.UUID) ([]models.ProductImage, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return r.db.productImages(productID), nil
+}
+
+// Method that adds images (file names in the upload directory) at the end of the gallery of a product. The first image of
+// a product without images becomes its primary image.
+func (r *ImageRepository) AddImages(productID uuid.UUID, filenames []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.productIndex(productID) < 0 { return sql.ErrNoRows }
+
+	images := r.db.productImages(productID)
+	next := 0
+	for _, image := range images {
+		next = max(next, image.SortOrder+1)
+	}
+	for i, filename := range filenames {
+		r.db.images = append(r.db.images, models.ProductImage{
+			ImageID:     uuid.New(),
+			ProductID:   productID,
+			Filename:    filename,
+			IsPrimary:   len(images) == 0 && i == 0,
+			SortOrder:   next + i,
+			DateCreated: time.Now(),
+		})
+	}
+
+	r.db.syncPrimaryImage(productID)
+	return nil
+}
+
+// Method that makes an image the primary image of its product. It returns sql.ErrNoRows if the product has no such image.
+func (r *ImageRepository) SetPrimaryImage(productID, imageID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.imageIndex(productID, imageID) < 0 { return sql.ErrNoRows }
+	for i := range r.db.images {
+		if r.db.images[i].ProductID == productID { r.db.images[i].IsPrimary = r.db.images[i].ImageID == imageID }
+	}
+
+	r.db.syncPrimaryImage(productID)
+	return nil
+}
+
+// Method that sets the gallery order of the images of a product. The IDs must be every image of the product once,
+// otherwise it returns repository.ErrInvalidImageOrder.
+func (r *ImageRepository) ReorderImages(productID uuid.UUID, imageIDs []uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	// Every image of the product once
+	if len(imageIDs) != len(r.db.productImages(productID)) { return repository.ErrInvalidImageOrder }
+	seen := map[uuid.UUID]bool{}
+	for _, imageID := range imageIDs {
+		if r.db.imageIndex(productID, imageID) < 0 || seen[imageID] { return repository.ErrInvalidImageOrder }
+		seen[imageID] = true
+	}
+
+	for position, imageID := range imageIDs {
+		r.db.images[r.db.imageIndex(productID, imageID)].SortOrder = position
+	}
+	return nil
+}
+
+// Method that deletes an image of a product and returns its file name. If it was the primary image, the first image
+// left in the gallery becomes the primary image.
+func (r *ImageRepository) DeleteImage(productID, imageID uuid.UUID) (string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i := r.db.imageIndex(productID, imageID)
+	if i < 0 { return "", sql.ErrNoRows }
+	deleted := r.db.images[i]
+	r.db.images = slices.Delete(r.db.images, i, i+1)
+
+	if deleted.IsPrimary {
+		if images := r.db.productImages(productID); len(images) > 0 {
+			r.db.images[r.db.imageIndex(productID, images[0].ImageID)].IsPrimary = true
+		}
+	}
+
+	r.db.syncPrimaryImage(productID)
+	return deleted.Filename, nil
+}
+
+/*** Helper Functions ***/
+
+// Returns the index of the image of a product in the images table (-1 if the product has no such image).
+func (db *database) imageIndex(productID, imageID uuid.UUID) int {
+	return slices.IndexFunc(db.images, func(image models.ProductImage) bool { return image.ImageID == imageID && image.ProductID == productID })
+}
+
+// Replaces the file of the primary image of a product (adding a primary image at the start of the gallery if it has none)
+// and returns the file name of the replaced image.
+func (db *database) replacePrimaryImage(productID uuid.UUID, filename string) string {
+	var oldFilename string
+	images := db.productImages(productID)
+	if i := slices.IndexFunc(db.images, func(image models.ProductImage) bool { return image.ProductID == productID && image.IsPrimary }); i >= 0 {
+		oldFilename = db.images[i].Filename
+		db.images[i].Filename = filename
+	} else {
+		sortOrder := 0
+		if len(images) > 0 { sortOrder = images[0].SortOrder - 1 }
+		db.images = append(db.images, models.ProductImage{
+			ImageID:     uuid.New(),
+			ProductID:   productID,
+			Filename:    filename,
+			IsPrimary:   true,
+			SortOrder:   sortOrder,
+			DateCreated: time.Now(),
+		})
+	}
+
+	db.syncPrimaryImage(productID)
+	return oldFilename
+}
+
+// Copies the file name of the primary image of a product to its ProductImage (empty if it has no images).
+func (db *database) syncPrimaryImage(productID uuid.UUID) {
+	i := db.productIndex(productID)
+	if i < 0 { return }
+	db.products[i].ProductImage = ""
+	for _, image := range db.images {
+		if image.ProductID == productID && image.IsPrimary { db.products[i].ProductImage = image.Filename }
+	}
+}
@@ -0,0 +1,183 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Returned when a row would repeat the key of another one (the unique keys of the MySQL tables).
+var ErrDuplicate = errors.New("memory: duplicate entry")
+
+// Custom type that contains the rows of every table in memory, in insertion order like the MySQL tables. A single lock
+// guards all of them, so every method of the stores runs as one transaction.
+type database struct {
+	mu                sync.RWMutex
+	products          []models.Product // Without categories, options, variants and images
+	options           []models.ProductOption
+	variants          []models.ProductVariant // Without values
+	variantValues     []variantValue
+	images            []models.ProductImage
+	categories        []models.Category
+	productCategories []productCategory
+	orders            []models.Order       // Without items
+	orderItems        []storedOrderItem    // Without products
+	idempotencyKeys   map[string]uuid.UUID // Order placed with every idempotency key
+	statusHistory     []models.OrderStatusChange
+	orderAddresses    []orderAddress // Shipping and billing addresses of the orders
+	carts             []models.Cart  // Without items
+	cartItems         []cartItem
+	users             []models.User
+	addresses         []models.Address // Address books of the customers
+	admins            []models.AdminUser
+}
+
+// Custom type that contains the value of an option of a variant.
+type variantValue struct {
+	variantID uuid.UUID
+	optionID  uuid.UUID
+	value     string
+}
+
+// Custom type that links a product to a category.
+type productCategory struct {
+	productID  uuid.UUID
+	categoryID uuid.UUID
+}
+
+// Custom type that contains an item of an order: only the IDs, the quantity, the cost and the tax.
+type storedOrderItem struct {
+	models.OrderItem
+	costStored bool // False for the items added without a cost (like a NULL cost in MySQL), shown at the current price
+}
+
+// Custom type that contains the shipping or billing address of an order.
+type orderAddress struct {
+	orderID     uuid.UUID
+	addressType string
+	address     models.Address
+}
+
+// Custom type that contains an item of a cart.
+type cartItem struct {
+	cartID    uuid.UUID
+	productID uuid.UUID
+	variantID uuid.UUID
+	quantity  int
+	price     models.Money // Price of a unit when it was added
+	dateAdded time.Time
+}
+
+// Function that returns a new Repository whose stores keep the data in memory (empty when the server starts). The stores
+// are safe for concurrent use and behave like the MySQL ones, so the server can run without a database (demo mode) and the
+// handlers can be tried without MySQL.
+func NewRepository() *repository.Repository {
+	db := &database{idempotencyKeys: map[string]uuid.UUID{}}
+	return &repository.Repository{
+		Product:  &ProductRepository{db: db},
+		Variant:  &VariantRepository{db: db},
+		Image:    &ImageRepository{db: db},
+		Category: &CategoryRepository{db: db},
+		Order:    &OrderRepository{db: db},
+		Cart:     &CartRepository{db: db},
+		User:     &UserRepository{db: db},
+		Address:  &AddressRepository{db: db},
+		Admin:    &AdminRepository{db: db},
+	}
+}
+
+/*** Helper Functions ***/
+
+// Returns the index of the product in the products table (-1 if it does not exist).
+func (db *database) productIndex(productID uuid.UUID) int {
+	for i := range db.products {
+		if db.products[i].ProductID == productID { return i }
+	}
+	return -1
+}
+
+// Returns copies of the products with their options, variants (with their values in option order) and images, like
+// loadVariants and loadImages of the MySQL repositories.
+func (db *database) withDetails(products []models.Product) []models.Product {
+	for i := range products {
+		products[i].Options = db.productOptions(products[i].ProductID)
+		products[i].Variants = db.productVariants(products[i].ProductID, products[i].Options)
+		products[i].Images = db.productImages(products[i].ProductID)
+	}
+	return products
+}
+
+// Returns the options of a product in position order.
+func (db *database) productOptions(productID uuid.UUID) []models.ProductOption {
+	var options []models.ProductOption
+	for _, o := range db.options {
+		if o.ProductID == productID { options = append(options, o) }
+	}
+	sort.SliceStable(options, func(i, j int) bool { return options[i].Position < options[j].Position })
+	return options
+}
+
+// Returns the variants of a product (oldest first) with their values in the order of the options.
+func (db *database) productVariants(productID uuid.UUID, options []models.ProductOption) []models.ProductVariant {
+	var variants []models.ProductVariant
+	for _, v := range db.variants {
+		if v.ProductID != productID { continue }
+		if v.PriceOverride != nil {
+			price := *v.PriceOverride
+			v.PriceOverride = &price
+		}
+		v.Values = make([]string, len(options))
+		for _, value := range db.variantValues {
+			if value.variantID != v.VariantID { continue }
+			for position, o := range options {
+				if o.OptionID == value.optionID { v.Values[position] = value.value }
+			}
+		}
+		variants = append(variants, v)
+	}
+	sort.SliceStable(variants, func(i, j int) bool {
+		if !variants[i].DateCreated.Equal(variants[j].DateCreated) { return variants[i].DateCreated.Before(variants[j].DateCreated) }
+		return variants[i].SKU < variants[j].SKU
+	})
+	return variants
+}
+
+// Returns the images of a product in gallery order.
+func (db *database) productImages(productID uuid.UUID) []models.ProductImage {
+	var images []models.ProductImage
+	for _, image := range db.images {
+		if image.ProductID == productID { images = append(images, image) }
+	}
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].SortOrder != images[j].SortOrder { return images[i].SortOrder < images[j].SortOrder }
+		return images[i].DateCreated.Before(images[j].DateCreated)
+	})
+	return images
+}
+
+// Sets the variant of the items that reference one, with the price and stock of the variant on their product (like
+// attachVariants of the MySQL repositories).
+func (db *database) attachVariants(items []models.OrderItem) {
+	for i := range items {
+		if items[i].VariantID == uuid.Nil { continue }
+		product := items[i].Product
+		product.Options = db.productOptions(product.ProductID)
+		product.Variants = db.productVariants(product.ProductID, product.Options)
+		withVariant, variant, ok := product.WithVariant(items[i].VariantID)
+		if !ok { continue }
+		items[i].Product = withVariant
+		items[i].Variant = variant
+	}
+}
+
+// Returns the email of a customer (empty for guests and unknown customers).
+func (db *database) userEmail(userID string) string {
+	for _, u := range db.users {
+		if u.UserID.String() == userID { return u.Email }
+	}
+	return ""
+}
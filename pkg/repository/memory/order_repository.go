@@ -0,0 +1,306 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"sort"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the orders, their items and their status history in memory (repository.OrderStore).
+type OrderRepository struct {
+	db *database
+}
+
+// Method that places an order of a customer (UserID, empty for guests) with its items (and their tax), addresses and
+// shipping method (and cost) and returns its ID (the order gets its ID, status and date). It returns a
+// *repository.InsufficientStockError or a *repository.PriceChangedError (and changes nothing) if any item asks for more
+// units than there are in stock or its price is not the current one, repository.ErrEmptyOrder if there are no items, and
+// the ID of the order with repository.ErrOrderAlreadyPlaced if an order was already placed with the idempotency key.
+func (r *OrderRepository) PlaceOrderWithItems(order *models.Order, idempotencyKey string) (uuid.UUID, error) {
+	if len(order.Items) == 0 { return uuid.Nil, repository.ErrEmptyOrder }
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if orderID, ok := r.db.idempotencyKeys[idempotencyKey]; ok && idempotencyKey != "" { return orderID, repository.ErrOrderAlreadyPlaced }
+	if err := r.db.reserveItems(order.Items); err != nil { return uuid.Nil, err }
+
+	order.OrderID = uuid.New()
+	order.OrderStatus = models.OrderStatusOrdered
+	order.OrderDate = time.Now()
+	r.db.orders = append(r.db.orders, models.Order{OrderID: order.OrderID, UserID: order.UserID, SessionID: order.SessionID, OrderStatus: order.OrderStatus,
+		OrderDate: order.OrderDate, ShippingMethod: order.ShippingMethod, ShippingName: order.ShippingName, ShippingCost: order.ShippingCost,
+		TaxInclusive: order.TaxInclusive})
+	if idempotencyKey != "" { r.db.idempotencyKeys[idempotencyKey] = order.OrderID }
+	for _, item := range order.Items {
+		r.db.orderItems = append(r.db.orderItems, storedOrderItem{OrderItem: models.OrderItem{
+			OrderID:   order.OrderID,
+			ProductID: item.ProductID,
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			Cost:      item.Cost,
+			TaxName:   item.TaxName,
+			TaxRate:   item.TaxRate,
+			Tax:       item.Tax,
+		}, costStored: true})
+	}
+
+	// Copies of the shipping and billing addresses
+	r.db.addOrderAddress(order.OrderID, models.AddressTypeShipping, order.ShippingAddress)
+	r.db.addOrderAddress(order.OrderID, models.AddressTypeBilling, order.BillingAddress)
+
+	// Start the status history of the order
+	r.db.statusHistory = append(r.db.statusHistory, models.OrderStatusChange{
+		OrderID:     order.OrderID,
+		ToStatus:    order.OrderStatus,
+		ChangedBy:   repository.ChangedByCustomer(order.UserID),
+		DateChanged: order.OrderDate,
+	})
+	return order.OrderID, nil
+}
+
+// Method that returns the ID of the order placed with an idempotency key. It returns sql.ErrNoRows if there is none.
+func (r *OrderRepository) GetOrderIDByIdempotencyKey(idempotencyKey string) (uuid.UUID, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	orderID, ok := r.db.idempotencyKeys[idempotencyKey]
+	if !ok || idempotencyKey == "" { return uuid.Nil, sql.ErrNoRows }
+	return orderID, nil
+}
+
+// Method that returns a page of orders (newest first) with the email of their customer.
+func (r *OrderRepository) ListOrders(limit, offset int) ([]models.Order, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	orders := slices.Clone(r.db.orders)
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].OrderDate.After(orders[j].OrderDate) })
+	if offset >= len(orders) { return nil, nil }
+	orders = orders[offset:]
+	if limit < len(orders) { orders = orders[:limit] }
+	for i := range orders {
+		orders[i].UserEmail = r.db.userEmail(orders[i].UserID)
+	}
+	return orders, nil
+}
+
+// Method that returns the total number of orders.
+func (r *OrderRepository) GetTotalOrdersCount() (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return len(r.db.orders), nil
+}
+
+// Method that creates an order (without items or status history).
+func (r *OrderRepository) CreateOrder(order *models.Order) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	order.OrderID = uuid.New()
+	order.OrderDate = time.Now()
+	r.db.orders = append(r.db.orders, models.Order{OrderID: order.OrderID, UserID: order.UserID, OrderStatus: order.OrderStatus, OrderDate: order.OrderDate})
+	return nil
+}
+
+// Method that adds an item to an order. It returns sql.ErrNoRows if the order does not exist.
+func (r *OrderRepository) AddOrderItem(orderItem *models.OrderItem) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.orderIndex(orderItem.OrderID) < 0 { return sql.ErrNoRows }
+	for _, item := range r.db.orderItems {
+		if item.OrderID == orderItem.OrderID && item.ProductID == orderItem.ProductID && item.VariantID == orderItem.VariantID { return ErrDuplicate }
+	}
+	r.db.orderItems = append(r.db.orderItems, storedOrderItem{OrderItem: models.OrderItem{
+		OrderID:   orderItem.OrderID,
+		ProductID: orderItem.ProductID,
+		VariantID: orderItem.VariantID,
+		Quantity:  orderItem.Quantity,
+	}})
+	return nil
+}
+
+// Method that returns an order with its items, their products (at the price they were ordered at) and its addresses. Items
+// of deleted products are left out, like the join of the MySQL repository.
+func (r *OrderRepository) GetOrderWithProducts(orderID uuid.UUID) (*models.Order, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := r.db.orderIndex(orderID)
+	if i < 0 { return nil, sql.ErrNoRows }
+	order := r.db.orders[i]
+	order.UserEmail = r.db.userEmail(order.UserID)
+
+	var costStored []bool
+	for _, stored := range r.db.orderItems {
+		if stored.OrderID != orderID { continue }
+		p := r.db.productIndex(stored.ProductID)
+		if p < 0 { continue }
+
+		// The stock is not loaded, like the query of the MySQL repository
+		product := r.db.products[p]
+		product.Stock = 0
+		order.Items = append(order.Items, models.OrderItem{
+			OrderID:   orderID,
+			ProductID: stored.ProductID,
+			VariantID: stored.VariantID,
+			Quantity:  stored.Quantity,
+			Product:   product,
+			Cost:      stored.Cost,
+			TaxName:   stored.TaxName,
+			TaxRate:   stored.TaxRate,
+			Tax:       stored.Tax,
+		})
+		costStored = append(costStored, stored.costStored)
+	}
+
+	// Variants of the items, at the price they were ordered at (the current price for items added without a cost)
+	r.db.attachVariants(order.Items)
+	for i := range order.Items {
+		if !costStored[i] || order.Items[i].Quantity == 0 {
+			order.Items[i].Cost = order.Items[i].Product.Price.Times(order.Items[i].Quantity)
+			continue
+		}
+		order.Items[i].Product.Price = order.Items[i].Cost / models.Money(order.Items[i].Quantity)
+	}
+
+	// Shipping and billing addresses
+	for _, stored := range r.db.orderAddresses {
+		if stored.orderID != orderID { continue }
+		address := stored.address
+		switch stored.addressType {
+			case models.AddressTypeShipping:
+				order.ShippingAddress = &address
+			case models.AddressTypeBilling:
+				order.BillingAddress = &address
+		}
+	}
+	return &order, nil
+}
+
+// Method that changes the status of an order and records the change in the status history. When the order is cancelled
+// or returned, the units of its items go back to the stock of their products (variants). It returns
+// repository.ErrInvalidStatusTransition if the order lifecycle does not allow the change.
+func (r *OrderRepository) UpdateOrderStatus(orderID uuid.UUID, status, changedBy string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i := r.db.orderIndex(orderID)
+	if i < 0 { return sql.ErrNoRows }
+	currentStatus := r.db.orders[i].OrderStatus
+	if !repository.CanChangeOrderStatus(currentStatus, status) { return repository.ErrInvalidStatusTransition }
+
+	r.db.orders[i].OrderStatus = status
+	if repository.ReleasesStock(status) { r.db.releaseItems(orderID) }
+	r.db.statusHistory = append(r.db.statusHistory, models.OrderStatusChange{
+		OrderID:     orderID,
+		FromStatus:  currentStatus,
+		ToStatus:    status,
+		ChangedBy:   changedBy,
+		DateChanged: time.Now(),
+	})
+	return nil
+}
+
+// Method that returns the status history of an order (oldest change first).
+func (r *OrderRepository) GetOrderStatusHistory(orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	var history []models.OrderStatusChange
+	for _, change := range r.db.statusHistory {
+		if change.OrderID == orderID { history = append(history, change) }
+	}
+	return history, nil
+}
+
+/*** Helper Functions ***/
+
+// Stores a copy of an address of an order (nothing if it is nil) with the fields of the order_addresses table of the
+// MySQL repositories.
+func (db *database) addOrderAddress(orderID uuid.UUID, addressType string, a *models.Address) {
+	if a == nil { return }
+	db.orderAddresses = append(db.orderAddresses, orderAddress{orderID: orderID, addressType: addressType, address: models.Address{
+		FullName:   a.FullName,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      a.Phone,
+	}})
+}
+
+// Returns the index of the order in the orders table (-1 if it does not exist).
+func (db *database) orderIndex(orderID uuid.UUID) int {
+	return slices.IndexFunc(db.orders, func(o models.Order) bool { return o.OrderID == orderID })
+}
+
+// Decrements the stock of the products (or variants) of the order items after checking them. It returns a
+// *repository.InsufficientStockError with every short line if any item asks for more units than there are in stock, or
+// else a *repository.PriceChangedError with every changed line if the price of any item is not the current one (and
+// changes nothing).
+func (db *database) reserveItems(items []models.OrderItem) error {
+	stocks := make([]*int, len(items))
+	var shortages []repository.StockShortage
+	var changes []repository.PriceChange
+	for i, item := range items {
+		name := item.Product.ProductName
+		if item.Variant != nil { name += " (" + item.Variant.Label() + ")" }
+
+		var price models.Money
+		if p := db.productIndex(item.ProductID); p >= 0 {
+			price = db.products[p].Price
+			if item.VariantID == uuid.Nil { stocks[i] = &db.products[p].Stock }
+		}
+		if item.VariantID != uuid.Nil {
+			v := slices.IndexFunc(db.variants, func(v models.ProductVariant) bool { return v.VariantID == item.VariantID && v.ProductID == item.ProductID })
+			if v >= 0 {
+				stocks[i] = &db.variants[v].Stock
+				if db.variants[v].PriceOverride != nil { price = *db.variants[v].PriceOverride }
+			}
+		}
+
+		shortage := repository.StockShortage{ProductID: item.ProductID, VariantID: item.VariantID, ProductName: name, Requested: item.Quantity}
+		if stocks[i] == nil {
+			shortages = append(shortages, shortage)
+			continue
+		}
+		if *stocks[i] < item.Quantity {
+			shortage.Available = *stocks[i]
+			shortages = append(shortages, shortage)
+		}
+		if price != item.Product.Price {
+			changes = append(changes, repository.PriceChange{ProductID: item.ProductID, VariantID: item.VariantID, ProductName: name, Quantity: item.Quantity,
+				OldPrice: item.Product.Price, NewPrice: price})
+		}
+	}
+	if len(shortages) > 0 { return &repository.InsufficientStockError{Shortages: shortages} }
+	if len(changes) > 0 { return &repository.PriceChangedError{Changes: changes} }
+
+	for i, item := range items {
+		*stocks[i] -= item.Quantity
+	}
+	return nil
+}
+
+// Gives the units of the items of an order back to the stock of their products (or variants), the opposite of
+// reserveItems. Items of deleted products (or variants) are skipped.
+func (db *database) releaseItems(orderID uuid.UUID) {
+	for _, item := range db.orderItems {
+		if item.OrderID != orderID { continue }
+		if item.VariantID == uuid.Nil {
+			if p := db.productIndex(item.ProductID); p >= 0 { db.products[p].Stock += item.Quantity }
+			continue
+		}
+		if v := slices.IndexFunc(db.variants, func(v models.ProductVariant) bool { return v.VariantID == item.VariantID }); v >= 0 {
+			db.variants[v].Stock += item.Quantity
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Tests ***/
+
+// Tests that an order keeps the prices its items were bought at when the prices change, including a line bought for 0,
+// while the items added without a cost are shown at the current price.
+func TestOrderKeepsPaidPrices(t *testing.T) {
+	repo := NewRepository()
+	laptop := models.Product{ProductName: "Laptop", Price: 1999, Stock: 5}
+	gift := models.Product{ProductName: "Gift", Price: 0, Stock: 5}
+	for _, product := range []*models.Product{&laptop, &gift} {
+		if err := repo.Product.CreateProduct(product); err != nil { t.Fatal(err) }
+	}
+
+	order := models.Order{Items: []models.OrderItem{
+		{ProductID: laptop.ProductID, Quantity: 2, Product: laptop, Cost: 3998},
+		{ProductID: gift.ProductID, Quantity: 1, Product: gift, Cost: 0},
+	}}
+	orderID, err := repo.Order.PlaceOrderWithItems(&order, uuid.NewString())
+	if err != nil { t.Fatal(err) }
+
+	// An order whose item was added without a cost
+	legacy := models.Order{OrderStatus: models.OrderStatusOrdered}
+	if err = repo.Order.CreateOrder(&legacy); err != nil { t.Fatal(err) }
+	if err = repo.Order.AddOrderItem(&models.OrderItem{OrderID: legacy.OrderID, ProductID: laptop.ProductID, Quantity: 1}); err != nil { t.Fatal(err) }
+
+	laptop.Price, gift.Price = 2499, 500
+	for _, product := range []*models.Product{&laptop, &gift} {
+		if _, err = repo.Product.UpdateProduct(product); err != nil { t.Fatal(err) }
+	}
+
+	placed, err := repo.Order.GetOrderWithProducts(orderID)
+	if err != nil { t.Fatal(err) }
+	want := map[uuid.UUID][2]models.Money{laptop.ProductID: {3998, 1999}, gift.ProductID: {0, 0}} // Cost and price
+	for _, item := range placed.Items {
+		if got := [2]models.Money{item.Cost, item.Product.Price}; got != want[item.ProductID] {
+			t.Errorf("%s: cost and price %v, want %v", item.Product.ProductName, got, want[item.ProductID])
+		}
+	}
+	if placed.Subtotal() != 3998 { t.Errorf("subtotal %d, want 3998", placed.Subtotal()) }
+
+	stored, err := repo.Order.GetOrderWithProducts(legacy.OrderID)
+	if err != nil { t.Fatal(err) }
+	if len(stored.Items) != 1 || stored.Items[0].Cost != 2499 { t.Errorf("the item added without a cost: %+v, want the current price 2499", stored.Items) }
+}
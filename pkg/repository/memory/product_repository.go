@@ -0,0 +1,207 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the products in memory (repository.ProductStore).
+type ProductRepository struct {
+	db *database
+}
+
+// Method that returns a product by its ID with its categories, options, variants and images.
+func (r *ProductRepository) GetProductByID(productID uuid.UUID) (*models.Product, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	i := r.db.productIndex(productID)
+	if i < 0 { return nil, sql.ErrNoRows }
+	product := r.db.withDetails([]models.Product{r.db.products[i]})[0]
+
+	// Categories of the product (by name, without their number of products)
+	for _, link := range r.db.productCategories {
+		if link.productID != productID { continue }
+		for _, c := range r.db.categories {
+			if c.CategoryID == link.categoryID { product.Categories = append(product.Categories, c) }
+		}
+	}
+	sort.SliceStable(product.Categories, func(i, j int) bool { return product.Categories[i].Name < product.Categories[j].Name })
+	return &product, nil
+}
+
+// Method that creates a new product.
+func (r *ProductRepository) CreateProduct(product *models.Product) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	product.ProductID = uuid.New()
+	product.DateCreated = time.Now()
+	product.DateModified = time.Now()
+	r.db.products = append(r.db.products, models.Product{
+		ProductID:    product.ProductID,
+		ProductName:  product.ProductName,
+		Price:        product.Price,
+		TaxClass:     product.TaxClass,
+		Stock:        product.Stock,
+		Weight:       product.Weight,
+		Length:       product.Length,
+		Width:        product.Width,
+		Height:       product.Height,
+		Description:  product.Description,
+		ProductImage: product.ProductImage,
+		DateCreated:  product.DateCreated,
+		DateModified: product.DateModified,
+	})
+	return nil
+}
+
+// Method that updates a product. If the product has an image (file name), it replaces the primary image and returns the
+// file name of the replaced image (empty if there was none).
+func (r *ProductRepository) UpdateProduct(product *models.Product) (string, error) {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	i := r.db.productIndex(product.ProductID)
+	if i < 0 { return "", sql.ErrNoRows }
+
+	product.DateModified = time.Now()
+	stored := &r.db.products[i]
+	stored.ProductName = product.ProductName
+	stored.Price = product.Price
+	stored.TaxClass = product.TaxClass
+	stored.Stock = product.Stock
+	stored.Weight = product.Weight
+	stored.Length = product.Length
+	stored.Width = product.Width
+	stored.Height = product.Height
+	stored.Description = product.Description
+	stored.DateModified = product.DateModified
+
+	if product.ProductImage == "" { return "", nil }
+	return r.db.replacePrimaryImage(product.ProductID, product.ProductImage), nil
+}
+
+// Method that deletes a product with its categories, options, variants, images and cart items (the cascades of the
+// MySQL foreign keys). The order items keep the ID of the product, but no longer show it.
+func (r *ProductRepository) DeleteProduct(productID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.products = slices.DeleteFunc(r.db.products, func(p models.Product) bool { return p.ProductID == productID })
+	r.db.productCategories = slices.DeleteFunc(r.db.productCategories, func(link productCategory) bool { return link.productID == productID })
+	r.db.options = slices.DeleteFunc(r.db.options, func(o models.ProductOption) bool { return o.ProductID == productID })
+	var variantIDs []uuid.UUID
+	r.db.variants = slices.DeleteFunc(r.db.variants, func(v models.ProductVariant) bool {
+		if v.ProductID != productID { return false }
+		variantIDs = append(variantIDs, v.VariantID)
+		return true
+	})
+	r.db.variantValues = slices.DeleteFunc(r.db.variantValues, func(value variantValue) bool { return slices.Contains(variantIDs, value.variantID) })
+	r.db.images = slices.DeleteFunc(r.db.images, func(image models.ProductImage) bool { return image.ProductID == productID })
+	r.db.cartItems = slices.DeleteFunc(r.db.cartItems, func(item cartItem) bool { return item.productID == productID })
+	return nil
+}
+
+// Method that returns a page of products (newest first).
+func (r *ProductRepository) ListProducts(limit, offset int) ([]models.Product, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	products := r.db.newestProducts(func(models.Product) bool { return true })
+	if offset >= len(products) { return nil, nil }
+	products = products[offset:]
+	if limit < len(products) { products = products[:limit] }
+	return r.db.withDetails(products), nil
+}
+
+// Method that returns the total number of products.
+func (r *ProductRepository) GetTotalProductsCount() (int, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+	return len(r.db.products), nil
+}
+
+// Method that returns the products that match the filter (newest first).
+func (r *ProductRepository) GetProducts(filter repository.ProductFilter) ([]models.Product, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	products := r.db.newestProducts(func(p models.Product) bool { return r.db.matches(filter, p) })
+	return r.db.withDetails(products), nil
+}
+
+// Method that returns up to limit products that match the filter and whose name or description contain words starting
+// with the words of the query, ranked like the MySQL full-text search (matches in the name weigh twice as much).
+func (r *ProductRepository) SearchProducts(query string, filter repository.ProductFilter, limit int) ([]models.Product, error) {
+	terms := repository.SearchTerms(query)
+	if len(terms) == 0 { return nil, nil }
+
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	relevance := map[uuid.UUID]int{}
+	whole := strings.ToLower(strings.TrimSpace(query))
+	products := r.db.newestProducts(func(p models.Product) bool {
+		if !r.db.matches(filter, p) { return false }
+		nameWords := repository.SearchTerms(p.ProductName)
+		allWords := slices.Concat(nameWords, repository.SearchTerms(p.Description))
+		inName, inAll := matchingTerms(terms, nameWords), matchingTerms(terms, allWords)
+		relevance[p.ProductID] = inName*2 + inAll
+		return inAll > 0 || strings.Contains(strings.ToLower(p.ProductName), whole)
+	})
+	sort.SliceStable(products, func(i, j int) bool { return relevance[products[i].ProductID] > relevance[products[j].ProductID] })
+	if limit < len(products) { products = products[:limit] }
+	return r.db.withDetails(products), nil
+}
+
+/*** Helper Functions ***/
+
+// Returns copies of the products that pass the check, newest first.
+func (db *database) newestProducts(check func(p models.Product) bool) []models.Product {
+	var products []models.Product
+	for _, p := range db.products {
+		if check(p) { products = append(products, p) }
+	}
+	sort.SliceStable(products, func(i, j int) bool { return products[i].DateCreated.After(products[j].DateCreated) })
+	return products
+}
+
+// Returns true if the product passes every condition of the filter (like the WHERE clause of the MySQL repository).
+func (db *database) matches(f repository.ProductFilter, p models.Product) bool {
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(p.ProductName), strings.ToLower(f.NameContains)) { return false }
+	if f.MinPrice != nil && p.Price < *f.MinPrice { return false }
+	if f.MaxPrice != nil && p.Price > *f.MaxPrice { return false }
+	if f.HasImage != nil && *f.HasImage != (p.ProductImage != "") { return false }
+	if !f.CreatedAfter.IsZero() && p.DateCreated.Before(f.CreatedAfter) { return false }
+	if !f.CreatedBefore.IsZero() && !p.DateCreated.Before(f.CreatedBefore) { return false }
+	if f.IDs != nil && !slices.Contains(f.IDs, p.ProductID) { return false }
+
+	if len(f.CategoryIDs) > 0 {
+		for _, link := range db.productCategories {
+			if link.productID == p.ProductID && slices.Contains(f.CategoryIDs, link.categoryID) { return true }
+		}
+		return false
+	}
+	return true
+}
+
+// Returns the number of search terms that are the start of one of the words.
+func matchingTerms(terms, words []string) int {
+	count := 0
+	for _, term := range terms {
+		for _, word := range words {
+			if strings.HasPrefix(word, term) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
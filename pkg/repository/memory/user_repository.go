@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Custom type that stores the customer accounts in memory (repository.UserStore).
+type UserRepository struct {
+	db *database
+}
+
+// Method that creates a new customer account with the password hashed (bcrypt). It returns repository.ErrEmailTaken if
+// the email already has an account.
+func (r *UserRepository) CreateUser(user *models.User, password string) error {
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil { return err }
+
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	for _, u := range r.db.users {
+		if u.Email == user.Email { return repository.ErrEmailTaken }
+	}
+
+	user.UserID = uuid.New()
+	user.PasswordHash = string(hash)
+	user.DateCreated = time.Now()
+	r.db.users = append(r.db.users, *user)
+	return nil
+}
+
+// Method that returns a customer by its ID.
+func (r *UserRepository) GetUserByID(userID uuid.UUID) (*models.User, error) {
+	return r.findUser(func(u models.User) bool { return u.UserID == userID })
+}
+
+// Method that returns a customer by its email.
+func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	return r.findUser(func(u models.User) bool { return u.Email == email })
+}
+
+// Method that returns the customer with the email if the password matches. It returns repository.ErrInvalidCredentials otherwise.
+func (r *UserRepository) Authenticate(email, password string) (*models.User, error) {
+	user, err := r.GetUserByEmail(email)
+	if err == sql.ErrNoRows { return nil, repository.ErrInvalidCredentials }
+	if err != nil { return nil, err }
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil { return nil, repository.ErrInvalidCredentials }
+	return user, nil
+}
+
+// Returns (a copy of) the first customer that passes the check, or sql.ErrNoRows.
+func (r *UserRepository) findUser(check func(u models.User) bool) (*models.User, error) {
+	r.db.mu.RLock()
+	defer r.db.mu.RUnlock()
+
+	for _, u := range r.db.users {
+		if check(u) { return &u, nil }
+	}
+	return nil, sql.ErrNoRows
+}
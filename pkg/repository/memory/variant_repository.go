@@ -0,0 +1,152 @@
+package memory
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/repository"
+	"github.com/google/uuid"
+)
+
+// Custom type that stores the options and variants of the products in memory (repository.VariantStore).
+type VariantRepository struct {
+	db *database
+}
+
+// Method that replaces the options of a product by the names (in order). Options that keep their name keep the values of
+// the variants, the values of removed options are deleted and variants get an empty value for new options.
+func (r *VariantRepository) SetProductOptions(productID uuid.UUID, names []string) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	if r.db.productIndex(productID) < 0 { return sql.ErrNoRows }
+
+	kept := map[string]bool{}
+	for _, name := range names {
+		kept[strings.ToLower(name)] = true
+	}
+
+	// Remove the options that are not in the new list (with their values)
+	var removed []uuid.UUID
+	r.db.options = slices.DeleteFunc(r.db.options, func(o models.ProductOption) bool {
+		if o.ProductID != productID || kept[strings.ToLower(o.Name)] { return false }
+		removed = append(removed, o.OptionID)
+		return true
+	})
+	r.db.variantValues = slices.DeleteFunc(r.db.variantValues, func(value variantValue) bool { return slices.Contains(removed, value.optionID) })
+
+	// Update (rename and reorder) the kept options and insert the new ones
+	for position, name := range names {
+		found := false
+		for i := range r.db.options {
+			o := &r.db.options[i]
+			if o.ProductID != productID || !strings.EqualFold(o.Name, name) { continue }
+			o.Name, o.Position = name, position
+			found = true
+		}
+		if !found {
+			r.db.options = append(r.db.options, models.ProductOption{OptionID: uuid.New(), ProductID: productID, Name: name, Position: position})
+		}
+	}
+	return nil
+}
+
+// Method that creates a new variant of a product with its option values. It returns repository.ErrSKUTaken if another
+// variant has the SKU and repository.ErrVariantValues if it does not have one (non-empty) value per option of the product.
+func (r *VariantRepository) CreateVariant(variant *models.ProductVariant) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	variant.VariantID = uuid.New()
+	optionIDs, err := r.db.checkVariant(variant)
+	if err != nil { return err }
+	if r.db.productIndex(variant.ProductID) < 0 { return sql.ErrNoRows }
+
+	variant.DateCreated = time.Now()
+	variant.DateModified = time.Now()
+	stored := *variant
+	stored.Values = nil
+	if variant.PriceOverride != nil {
+		price := *variant.PriceOverride
+		stored.PriceOverride = &price
+	}
+	r.db.variants = append(r.db.variants, stored)
+	r.db.setVariantValues(variant.VariantID, optionIDs, variant.Values)
+	return nil
+}
+
+// Method that updates the SKU, price, stock and option values of a variant. It returns the same errors as CreateVariant
+// and sql.ErrNoRows if the product has no such variant.
+func (r *VariantRepository) UpdateVariant(variant *models.ProductVariant) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	optionIDs, err := r.db.checkVariant(variant)
+	if err != nil { return err }
+
+	i := slices.IndexFunc(r.db.variants, func(v models.ProductVariant) bool {
+		return v.VariantID == variant.VariantID && v.ProductID == variant.ProductID
+	})
+	if i < 0 { return sql.ErrNoRows }
+
+	variant.DateModified = time.Now()
+	stored := &r.db.variants[i]
+	stored.SKU = variant.SKU
+	stored.PriceOverride = nil
+	if variant.PriceOverride != nil {
+		price := *variant.PriceOverride
+		stored.PriceOverride = &price
+	}
+	stored.Stock = variant.Stock
+	stored.DateModified = variant.DateModified
+	r.db.setVariantValues(variant.VariantID, optionIDs, variant.Values)
+	return nil
+}
+
+// Method that deletes a variant and removes it from the carts. Orders keep the ID of the variant, but no longer show it.
+func (r *VariantRepository) DeleteVariant(productID, variantID uuid.UUID) error {
+	r.db.mu.Lock()
+	defer r.db.mu.Unlock()
+
+	r.db.cartItems = slices.DeleteFunc(r.db.cartItems, func(item cartItem) bool { return item.productID == productID && item.variantID == variantID })
+	deleted := false
+	r.db.variants = slices.DeleteFunc(r.db.variants, func(v models.ProductVariant) bool {
+		if v.VariantID != variantID || v.ProductID != productID { return false }
+		deleted = true
+		return true
+	})
+	if deleted {
+		r.db.variantValues = slices.DeleteFunc(r.db.variantValues, func(value variantValue) bool { return value.variantID == variantID })
+	}
+	return nil
+}
+
+/*** Helper Functions ***/
+
+// Checks that the SKU of a variant is not used by another variant and that it has one (non-empty) value per option of
+// its product. It returns the IDs of the options in order, to pair them with the values.
+func (db *database) checkVariant(variant *models.ProductVariant) ([]uuid.UUID, error) {
+	for _, v := range db.variants {
+		if v.SKU == variant.SKU && v.VariantID != variant.VariantID { return nil, repository.ErrSKUTaken }
+	}
+
+	var optionIDs []uuid.UUID
+	for _, o := range db.productOptions(variant.ProductID) {
+		optionIDs = append(optionIDs, o.OptionID)
+	}
+	if len(optionIDs) == 0 || len(variant.Values) != len(optionIDs) { return nil, repository.ErrVariantValues }
+	for _, value := range variant.Values {
+		if strings.TrimSpace(value) == "" { return nil, repository.ErrVariantValues }
+	}
+	return optionIDs, nil
+}
+
+// Replaces the option values of a variant.
+func (db *database) setVariantValues(variantID uuid.UUID, optionIDs []uuid.UUID, values []string) {
+	db.variantValues = slices.DeleteFunc(db.variantValues, func(value variantValue) bool { return value.variantID == variantID })
+	for i, optionID := range optionIDs {
+		db.variantValues = append(db.variantValues, variantValue{variantID: variantID, optionID: optionID, value: values[i]})
+	}
+}
@@ -2,11 +2,110 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
+	"github.com/go-sql-driver/mysql"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
 	"github.com/google/uuid"
 )
 
+/*** Errors ***/
+var ErrInvalidStatusTransition = errors.New("invalid order status transition")                 // Returned when an order status can not be changed to the requested status
+var ErrOrderAlreadyPlaced = errors.New("an order was already placed with the idempotency key") // Returned (with the ID of that order) when a checkout is retried
+var ErrEmptyOrder = errors.New("an order needs at least one item")                             // Returned when placing an order without items
+
+/*** Constants ***/
+const mysqlDuplicateEntry = 1062 // MySQL error number of a duplicate value of a unique key
+
+// Allowed order status transitions (order lifecycle). An order can only move to one of the statuses listed for its current status.
+var orderStatusTransitions = map[string][]string{
+	models.OrderStatusOrdered:        {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:           {models.OrderStatusPacked, models.OrderStatusCancelled},
+	models.OrderStatusPacked:         {models.OrderStatusOutForDelivery, models.OrderStatusCancelled},
+	models.OrderStatusOutForDelivery: {models.OrderStatusDelivered},
+	models.OrderStatusDelivered:      {models.OrderStatusReturned},
+	models.OrderStatusCancelled:      {},
+	models.OrderStatusReturned:       {},
+}
+
+// Function that returns the statuses an order can move to from its current status.
+func NextOrderStatuses(status string) []string {
+	return orderStatusTransitions[status]
+}
+
+// Function that returns true if an order can move from one status to another.
+func CanChangeOrderStatus(from, to string) bool {
+	for _, next := range orderStatusTransitions[from] {
+		if next == to { return true }
+	}
+	return false
+}
+
+// Function that returns true if moving an order to the status gives its units back to the stock (cancelled orders are not
+// sent and returned orders come back). Both statuses are final, so the stock of an order is given back at most once.
+func ReleasesStock(status string) bool {
+	return status == models.OrderStatusCancelled || status == models.OrderStatusReturned
+}
+
+// Custom type that describes an order line that asks for more units than there are in stock.
+type StockShortage struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	VariantID   uuid.UUID `json:"variant_id"`   // uuid.Nil for products without variants
+	ProductName string    `json:"product_name"` // Name of the product, with the option values of the variant (e.g. "T-Shirt (M / Red)")
+	Requested   int       `json:"requested"`
+	Available   int       `json:"available"`
+}
+
+// Custom type (error) returned when an order can not be placed because one or more items are short of stock.
+type InsufficientStockError struct {
+	Shortages []StockShortage
+}
+
+// Method that returns the error message with every short line.
+func (e *InsufficientStockError) Error() string {
+	lines := make([]string, len(e.Shortages))
+	for i, shortage := range e.Shortages {
+		lines[i] = fmt.Sprintf("%s: %d requested, %d available", shortage.ProductName, shortage.Requested, shortage.Available)
+	}
+	return "insufficient stock (" + strings.Join(lines, "; ") + ")"
+}
+
+// Custom type that describes an order line whose price is not the one the shopper saw (the price of the cart item).
+type PriceChange struct {
+	ProductID   uuid.UUID    `json:"product_id"`
+	VariantID   uuid.UUID    `json:"variant_id"`   // uuid.Nil for products without variants
+	ProductName string       `json:"product_name"` // Name of the product, with the option values of the variant (e.g. "T-Shirt (M / Red)")
+	Quantity    int          `json:"quantity"`
+	OldPrice    models.Money `json:"old_price"` // Price of a unit in the cart, in cents
+	NewPrice    models.Money `json:"new_price"` // Current price of a unit, in cents
+}
+
+// Method that returns the cost of the line at the price in the cart.
+func (c PriceChange) OldCost() models.Money {
+	return c.OldPrice.Times(c.Quantity)
+}
+
+// Method that returns the cost of the line at the current price.
+func (c PriceChange) NewCost() models.Money {
+	return c.NewPrice.Times(c.Quantity)
+}
+
+// Custom type (error) returned when an order can not be placed because the price of one or more items changed.
+type PriceChangedError struct {
+	Changes []PriceChange
+}
+
+// Method that returns the error message with every changed line.
+func (e *PriceChangedError) Error() string {
+	lines := make([]string, len(e.Changes))
+	for i, change := range e.Changes {
+		lines[i] = fmt.Sprintf("%s: %s now %s", change.ProductName, change.OldPrice, change.NewPrice)
+	}
+	return "prices changed (" + strings.Join(lines, "; ") + ")"
+}
+
 // Custom type that holds a pointer to the database connection.
 type OrderRepository struct {
 	DB *sql.DB
@@ -17,48 +116,95 @@ func NewOrderRepository(db *sql.DB) *OrderRepository {
 	return &OrderRepository{DB: db}
 }
 
-// Method that places an order with its items in the database.
-func (r *OrderRepository) PlaceOrderWithItems(orderItems []models.OrderItem) error {
+// Method that places an order of a customer (UserID, empty for guests) with its items (and their tax), addresses and
+// shipping method (and cost) in the database and returns its ID (the order gets its ID, status and date). The
+// idempotency key of the checkout is stored with the order: if an order was already placed with the key, nothing is
+// inserted and it returns the ID of that order with ErrOrderAlreadyPlaced. The price of every item (Product.Price) must
+// be the current price of the product (variant), read again inside the transaction: it returns a *PriceChangedError
+// (and changes nothing) if any is not, like the *InsufficientStockError of the items short of stock, and ErrEmptyOrder
+// if there are no items.
+func (r *OrderRepository) PlaceOrderWithItems(order *models.Order, idempotencyKey string) (uuid.UUID, error) {
+	if len(order.Items) == 0 { return uuid.Nil, ErrEmptyOrder }
+
+	// An order placed with the key by an earlier attempt
+	if orderID, err := r.GetOrderIDByIdempotencyKey(idempotencyKey); err != sql.ErrNoRows {
+		if err != nil { return uuid.Nil, err }
+		return orderID, ErrOrderAlreadyPlaced
+	}
+
 	// Begin transaction
 	tx, err := r.DB.Begin()
-	if err != nil { return err }
+	if err != nil { return uuid.Nil, err }
 
-	order := models.Order{
-		OrderID:     uuid.New(),
-		UserID:      "jdoe@email.com",
-		OrderStatus: "ordered",
-		OrderDate:   time.Now(),
-		Items:       orderItems,
-	}
+	order.OrderID = uuid.New()
+	order.OrderStatus = models.OrderStatusOrdered
+	order.OrderDate = time.Now()
 
-	// Insert order into orders table
-	_, err = tx.Exec("INSERT INTO orders (order_id, user_id, order_status, order_date) VALUES (?, ?, ?, ?)",
-		order.OrderID, order.UserID, order.OrderStatus, order.OrderDate)
+	// Insert order into orders table (the unique key stops a concurrent attempt with the same key, e.g. on another server)
+	_, err = tx.Exec(`INSERT INTO orders (order_id, user_id, order_status, order_date, shipping_method, shipping_name, shipping_cost, tax_inclusive,
+		idempotency_key, session_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, order.OrderID, nullString(order.UserID), order.OrderStatus, order.OrderDate,
+		order.ShippingMethod, order.ShippingName, order.ShippingCost, order.TaxInclusive, nullString(idempotencyKey), nullString(order.SessionID))
 	if err != nil {
 		tx.Rollback()
-		return err
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			if orderID, err := r.GetOrderIDByIdempotencyKey(idempotencyKey); err == nil { return orderID, ErrOrderAlreadyPlaced }
+		}
+		return uuid.Nil, err
+	}
+
+	// Check the price and reserve the stock of every item (the product rows stay locked until the transaction ends)
+	if err = reserveItems(tx, order.Items); err != nil {
+		tx.Rollback()
+		return uuid.Nil, err
 	}
 
 	// Insert order items into order_items table
 	for _, item := range order.Items {
-		_, err = tx.Exec("INSERT INTO order_items (order_id, product_id, quantity, cost) VALUES (?, ?, ?, ?)",
-			order.OrderID, item.ProductID, item.Quantity, item.Cost)
+		_, err = tx.Exec("INSERT INTO order_items (order_id, product_id, variant_id, quantity, cost, tax_name, tax_rate, tax) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			order.OrderID, item.ProductID, variantValue(item.VariantID), item.Quantity, item.Cost, item.TaxName, item.TaxRate, item.Tax)
 		if err != nil {
 			tx.Rollback()
-			return err
+			return uuid.Nil, err
 		}
 	}
 
+	// Insert the shipping and billing addresses into order_addresses table
+	if err = insertOrderAddresses(tx, order); err != nil {
+		tx.Rollback()
+		return uuid.Nil, err
+	}
+
+	// Start the status history of the order
+	_, err = tx.Exec("INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, date_changed) VALUES (?, ?, ?, ?, ?)",
+		order.OrderID, "", order.OrderStatus, ChangedByCustomer(order.UserID), order.OrderDate)
+	if err != nil {
+		tx.Rollback()
+		return uuid.Nil, err
+	}
+
 	// Commit transaction
 	err = tx.Commit()
-	if err != nil { return err }
+	if err != nil { return uuid.Nil, err }
 
-	return nil
+	return order.OrderID, nil
+}
+
+// Method that returns the ID of the order placed with an idempotency key. It returns sql.ErrNoRows if there is none (or
+// the key is empty).
+func (r *OrderRepository) GetOrderIDByIdempotencyKey(idempotencyKey string) (uuid.UUID, error) {
+	if idempotencyKey == "" { return uuid.Nil, sql.ErrNoRows }
+	var orderID uuid.UUID
+	err := r.DB.QueryRow("SELECT order_id FROM orders WHERE idempotency_key = ?", idempotencyKey).Scan(&orderID)
+	return orderID, err
 }
 
 // Method that returns a list of orders from the database. It takes a limit and offset as parameters in order to paginate the results.
 func (r *OrderRepository) ListOrders(limit, offset int) ([]models.Order, error) {
-	query := `SELECT order_id, user_id, order_status, order_date FROM orders ORDER BY order_date DESC LIMIT ? OFFSET ?`
+	query := `
+	SELECT o.order_id, COALESCE(o.user_id, ''), COALESCE(u.email, ''), o.order_status, o.order_date
+	FROM orders o LEFT JOIN users u ON o.user_id = u.user_id ORDER BY o.order_date DESC LIMIT ? OFFSET ?
+	`
 
 	rows, err := r.DB.Query(query, limit, offset)
 	if err != nil { return nil, err }
@@ -67,7 +213,7 @@ func (r *OrderRepository) ListOrders(limit, offset int) ([]models.Order, error)
 	var orders []models.Order
 	for rows.Next() {
 		var order models.Order
-		err := rows.Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.OrderDate)
+		err := rows.Scan(&order.OrderID, &order.UserID, &order.UserEmail, &order.OrderStatus, &order.OrderDate)
 		if err != nil { return nil, err }
 		orders = append(orders, order)
 	}
@@ -87,42 +233,216 @@ func (r *OrderRepository) CreateOrder(order *models.Order) error {
 	query := `INSERT INTO orders (order_id, user_id, order_status, order_date) VALUES (?, ?, ?, ?)`
 	order.OrderID = uuid.New()
 	order.OrderDate = time.Now()
-	_, err := r.DB.Exec(query,order.OrderID, order.UserID, order.OrderStatus, order.OrderDate)
+	_, err := r.DB.Exec(query,order.OrderID, nullString(order.UserID), order.OrderStatus, order.OrderDate)
 	return err
 }
 
 // Method that inserts an order item in the database.
 func (r *OrderRepository) AddOrderItem(orderItem *models.OrderItem) error {
-	query := `INSERT INTO order_items (order_id, product_id, quantity) VALUES (?, ?, ?)`
-	_, err := r.DB.Exec(query,orderItem.OrderID, orderItem.ProductID, orderItem.Quantity)
+	query := `INSERT INTO order_items (order_id, product_id, variant_id, quantity) VALUES (?, ?, ?, ?)`
+	_, err := r.DB.Exec(query,orderItem.OrderID, orderItem.ProductID, variantValue(orderItem.VariantID), orderItem.Quantity)
 	return err
 }
 
-// Method that returns a list of order items from the database.
+// Method that returns an order with its items (and their products and tax), its addresses and its shipping from the database.
 func (r *OrderRepository) GetOrderWithProducts(orderID uuid.UUID) (*models.Order, error) {
 	// First, get the order details
-	orderQuery := `SELECT order_id, user_id, order_status, order_date FROM orders WHERE order_id = ?`
+	orderQuery := `
+	SELECT o.order_id, COALESCE(o.user_id, ''), COALESCE(u.email, ''), COALESCE(o.session_id, ''), o.order_status, o.order_date, o.shipping_method,
+		o.shipping_name, o.shipping_cost, o.tax_inclusive
+	FROM orders o LEFT JOIN users u ON o.user_id = u.user_id WHERE o.order_id = ?
+	`
 	var order models.Order
-	err := r.DB.QueryRow(orderQuery, orderID).Scan(&order.OrderID, &order.UserID, &order.OrderStatus, &order.OrderDate)
+	err := r.DB.QueryRow(orderQuery, orderID).Scan(&order.OrderID, &order.UserID, &order.UserEmail, &order.SessionID, &order.OrderStatus,
+		&order.OrderDate, &order.ShippingMethod, &order.ShippingName, &order.ShippingCost, &order.TaxInclusive)
 	if err != nil { return nil, err }
 	// Then, get all order items with their corresponding products
 	itemsQuery := `
-    SELECT oi.product_id, oi.quantity, p.product_name, p.price, p.description, p.product_image, p.date_created, p.date_modified
+    SELECT oi.product_id, oi.variant_id, oi.quantity, oi.cost, oi.tax_name, oi.tax_rate, oi.tax, p.product_name, p.price, p.tax_class, p.description,
+        p.product_image, p.date_created, p.date_modified
     FROM order_items oi JOIN products p ON oi.product_id = p.product_id WHERE oi.order_id = ?
 	`
 	rows, err := r.DB.Query(itemsQuery, orderID)
 	if err != nil { return nil, err }
 	defer rows.Close()
+	var costs []sql.NullInt64
 	for rows.Next() {
 		var item models.OrderItem
-		err := rows.Scan(&item.ProductID, &item.Quantity, &item.Product.ProductName, &item.Product.Price, &item.Product.Description,
-			&item.Product.ProductImage, &item.Product.DateCreated, &item.Product.DateModified)
+		var cost sql.NullInt64
+		err := rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity, &cost, &item.TaxName, &item.TaxRate, &item.Tax, &item.Product.ProductName,
+			&item.Product.Price, &item.Product.TaxClass, &item.Product.Description, &item.Product.ProductImage, &item.Product.DateCreated, &item.Product.DateModified)
 		if err != nil { return nil, err }
 		item.OrderID = orderID
-		item.Cost = float64(item.Quantity) * item.Product.Price
 		item.Product.ProductID = item.ProductID
 		order.Items = append(order.Items, item)
+		costs = append(costs, cost)
 	}
+	if err = rows.Err(); err != nil { return nil, err }
+
+	// Variants of the items (with their price)
+	if err = attachVariants(r.DB, order.Items); err != nil { return nil, err }
+	paidPrices(order.Items, costs)
+
+	// Shipping and billing addresses
+	if err = loadOrderAddresses(r.DB, &order); err != nil { return nil, err }
 
 	return &order, nil
-}
\ No newline at end of file
+}
+
+// Method that changes the status of an order and records the change in the status history. When the order is cancelled
+// or returned, the units of its items go back to the stock of their products (variants) in the same transaction. It
+// returns ErrInvalidStatusTransition if the order lifecycle does not allow the change.
+func (r *OrderRepository) UpdateOrderStatus(orderID uuid.UUID, status, changedBy string) error {
+	// Begin transaction
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	// Lock the order row so concurrent changes are validated against the latest status
+	var currentStatus string
+	err = tx.QueryRow("SELECT order_status FROM orders WHERE order_id = ? FOR UPDATE", orderID).Scan(&currentStatus)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if !CanChangeOrderStatus(currentStatus, status) {
+		tx.Rollback()
+		return ErrInvalidStatusTransition
+	}
+
+	_, err = tx.Exec("UPDATE orders SET order_status = ? WHERE order_id = ?", status, orderID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if ReleasesStock(status) {
+		if err = releaseItems(tx, orderID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec("INSERT INTO order_status_history (order_id, from_status, to_status, changed_by, date_changed) VALUES (?, ?, ?, ?, ?)",
+		orderID, currentStatus, status, changedBy, time.Now())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Commit transaction
+	return tx.Commit()
+}
+
+// Method that returns the status history of an order (oldest change first).
+func (r *OrderRepository) GetOrderStatusHistory(orderID uuid.UUID) ([]models.OrderStatusChange, error) {
+	query := `SELECT order_id, from_status, to_status, changed_by, date_changed FROM order_status_history WHERE order_id = ? ORDER BY date_changed, id`
+	rows, err := r.DB.Query(query, orderID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	var history []models.OrderStatusChange
+	for rows.Next() {
+		var change models.OrderStatusChange
+		err := rows.Scan(&change.OrderID, &change.FromStatus, &change.ToStatus, &change.ChangedBy, &change.DateChanged)
+		if err != nil { return nil, err }
+		history = append(history, change)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	return history, nil
+}
+
+// Function that returns who is recorded in the status history when a customer (or guest) places an order.
+func ChangedByCustomer(userID string) string {
+	if userID == "" { return "guest" }
+	return "customer " + userID
+}
+
+// Decrements the stock of the products (or variants) of the order items after checking them against the locked rows. It
+// returns an InsufficientStockError with every short line if any item asks for more units than there are in stock, or else
+// a PriceChangedError with every changed line if the price of any item is not the current one (and changes nothing).
+func reserveItems(tx *sql.Tx, items []models.OrderItem) error {
+	var shortages []StockShortage
+	var changes []PriceChange
+	for _, item := range items {
+		name := item.Product.ProductName
+		if item.Variant != nil { name += " (" + item.Variant.Label() + ")" }
+
+		var stock int
+		var price models.Money
+		var err error
+		if item.VariantID == uuid.Nil {
+			err = tx.QueryRow("SELECT stock, price FROM products WHERE product_id = ? FOR UPDATE", item.ProductID).Scan(&stock, &price)
+		} else {
+			err = tx.QueryRow(`SELECT v.stock, COALESCE(v.price, p.price) FROM product_variants v JOIN products p ON v.product_id = p.product_id
+				WHERE v.variant_id = ? AND v.product_id = ? FOR UPDATE`, item.VariantID, item.ProductID).Scan(&stock, &price)
+		}
+		if err == sql.ErrNoRows {
+			shortages = append(shortages, StockShortage{ProductID: item.ProductID, VariantID: item.VariantID, ProductName: name, Requested: item.Quantity})
+			continue
+		}
+		if err != nil { return err }
+		if stock < item.Quantity {
+			shortages = append(shortages, StockShortage{ProductID: item.ProductID, VariantID: item.VariantID, ProductName: name, Requested: item.Quantity, Available: stock})
+		}
+		if price != item.Product.Price {
+			changes = append(changes, PriceChange{ProductID: item.ProductID, VariantID: item.VariantID, ProductName: name, Quantity: item.Quantity,
+				OldPrice: item.Product.Price, NewPrice: price})
+		}
+	}
+	if len(shortages) > 0 { return &InsufficientStockError{Shortages: shortages} }
+	if len(changes) > 0 { return &PriceChangedError{Changes: changes} }
+
+	for _, item := range items {
+		var err error
+		if item.VariantID == uuid.Nil {
+			_, err = tx.Exec("UPDATE products SET stock = stock - ? WHERE product_id = ?", item.Quantity, item.ProductID)
+		} else {
+			_, err = tx.Exec("UPDATE product_variants SET stock = stock - ? WHERE variant_id = ?", item.Quantity, item.VariantID)
+		}
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// Gives the units of the items of an order back to the stock of their products (or variants), the opposite of
+// reserveItems. Items of deleted products (or variants) are skipped.
+func releaseItems(tx *sql.Tx, orderID uuid.UUID) error {
+	rows, err := tx.Query("SELECT product_id, variant_id, quantity FROM order_items WHERE order_id = ?", orderID)
+	if err != nil { return err }
+	var items []models.OrderItem
+	for rows.Next() {
+		var item models.OrderItem
+		if err = rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil { return err }
+
+	for _, item := range items {
+		if item.VariantID == uuid.Nil {
+			_, err = tx.Exec("UPDATE products SET stock = stock + ? WHERE product_id = ?", item.Quantity, item.ProductID)
+		} else {
+			_, err = tx.Exec("UPDATE product_variants SET stock = stock + ? WHERE variant_id = ?", item.Quantity, item.VariantID)
+		}
+		if err != nil { return err }
+	}
+	return nil
+}
+
+// Sets the cost of order items to their stored cost (in the same order) and the price of their products to the price
+// they were ordered at, so the order does not change with the prices. Items stored without a cost (a NULL cost, e.g.
+// orders placed before costs were stored) keep the current price.
+func paidPrices(items []models.OrderItem, costs []sql.NullInt64) {
+	for i := range items {
+		if !costs[i].Valid || items[i].Quantity == 0 {
+			items[i].Cost = items[i].Product.Price.Times(items[i].Quantity)
+			continue
+		}
+		items[i].Cost = models.Money(costs[i].Int64)
+		items[i].Product.Price = items[i].Cost / models.Money(items[i].Quantity)
+	}
+}
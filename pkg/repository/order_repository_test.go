@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Tests ***/
+
+// Tests that the items of an order get the price they were bought at from their stored cost, a cost of 0 included, and
+// the items stored without a cost (NULL) the current price of their product.
+func TestPaidPrices(t *testing.T) {
+	tests := []struct {
+		name      string
+		cost      sql.NullInt64
+		quantity  int
+		wantCost  models.Money
+		wantPrice models.Money
+	}{
+		{name: "bought at an old price", cost: sql.NullInt64{Int64: 3000, Valid: true}, quantity: 2, wantCost: 3000, wantPrice: 1500},
+		{name: "bought for free", cost: sql.NullInt64{Int64: 0, Valid: true}, quantity: 3, wantCost: 0, wantPrice: 0},
+		{name: "stored without a cost", cost: sql.NullInt64{}, quantity: 2, wantCost: 3998, wantPrice: 1999},
+		{name: "without units", cost: sql.NullInt64{Int64: 0, Valid: true}, quantity: 0, wantCost: 0, wantPrice: 1999},
+	}
+	for _, test := range tests {
+		items := []models.OrderItem{{Quantity: test.quantity, Product: models.Product{Price: 1999}}}
+		paidPrices(items, []sql.NullInt64{test.cost})
+		if items[0].Cost != test.wantCost || items[0].Product.Price != test.wantPrice {
+			t.Errorf("%s: cost %d and price %d, want %d and %d", test.name, items[0].Cost, items[0].Product.Price, test.wantCost, test.wantPrice)
+		}
+	}
+}
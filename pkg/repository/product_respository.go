@@ -2,7 +2,9 @@ package repository
 
 import (
 	"database/sql"
+	"strings"
 	"time"
+	"unicode"
 	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
 	"github.com/google/uuid"
 )
@@ -19,30 +21,73 @@ func NewProductRepository(db *sql.DB) *ProductRepository {
 
 // Function that returns a product by its ID from the database.
 func (r *ProductRepository) GetProductByID(productID uuid.UUID) (*models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products WHERE product_id = ?`
+	query := `SELECT product_id, product_name, price, tax_class, stock, weight, length, width, height, description, product_image, date_created,
+		date_modified FROM products WHERE product_id = ?`
 	row := r.DB.QueryRow(query, productID)
 	var product models.Product
-	err := row.Scan(&product.ProductID, &product.ProductName, &product.Price, &product.Description, &product.ProductImage, &product.DateCreated, &product.DateModified)
+	err := row.Scan(&product.ProductID, &product.ProductName, &product.Price, &product.TaxClass, &product.Stock, &product.Weight, &product.Length, &product.Width, &product.Height,
+		&product.Description, &product.ProductImage, &product.DateCreated, &product.DateModified)
 	if err != nil { return nil, err }
-	return &product, nil
+
+	// Categories of the product
+	query = `SELECT c.category_id, c.parent_id, c.name, c.description, c.date_created, c.date_modified FROM categories c
+		JOIN product_categories pc ON pc.category_id = c.category_id WHERE pc.product_id = ? ORDER BY c.name`
+	rows, err := r.DB.Query(query, productID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	for rows.Next() {
+		var c models.Category
+		if err := rows.Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Description, &c.DateCreated, &c.DateModified); err != nil { return nil, err }
+		product.Categories = append(product.Categories, c)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+
+	// Options, variants and images of the product
+	products := []models.Product{product}
+	if err = loadVariants(r.DB, products); err != nil { return nil, err }
+	if err = loadImages(r.DB, products); err != nil { return nil, err }
+	return &products[0], nil
 }
 
 // Function that creates a new product in the database.
 func (r *ProductRepository) CreateProduct(product *models.Product) error {
-	query := `INSERT INTO products (product_id, product_name, price, description, product_image, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	query := `INSERT INTO products (product_id, product_name, price, tax_class, stock, weight, length, width, height, description, product_image, date_created,
+		date_modified) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	product.ProductID = uuid.New()
 	product.DateCreated = time.Now()
 	product.DateModified = time.Now()
-	_, err := r.DB.Exec(query, product.ProductID, product.ProductName, product.Price, product.Description, product.ProductImage, product.DateCreated, product.DateModified)
+	_, err := r.DB.Exec(query, product.ProductID, product.ProductName, product.Price, product.TaxClass, product.Stock, product.Weight, product.Length, product.Width, product.Height,
+		product.Description, product.ProductImage, product.DateCreated, product.DateModified)
 	return err
 }
 
-// Function that updates a product in the database.
-func (r *ProductRepository) UpdateProduct(product *models.Product) error {
-	query := `UPDATE products SET product_name = ?, price = ?, description = ?, date_modified = ? WHERE product_id = ?`
+// Function that updates a product in the database. If the product has an image (file name), it replaces the primary
+// image in the same transaction and returns the file name of the replaced image (empty if there was none), so the old
+// file is only removed once the update is committed.
+func (r *ProductRepository) UpdateProduct(product *models.Product) (string, error) {
+	tx, err := r.DB.Begin()
+	if err != nil { return "", err }
+
+	query := `UPDATE products SET product_name = ?, price = ?, tax_class = ?, stock = ?, weight = ?, length = ?, width = ?, height = ?, description = ?, date_modified = ?
+		WHERE product_id = ?`
 	product.DateModified = time.Now()
-	_, err := r.DB.Exec(query, product.ProductName, product.Price, product.Description, product.DateModified, product.ProductID)
-	return err
+	_, err = tx.Exec(query, product.ProductName, product.Price, product.TaxClass, product.Stock, product.Weight, product.Length, product.Width, product.Height,
+		product.Description, product.DateModified, product.ProductID)
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	var oldImage string
+	if product.ProductImage != "" {
+		if oldImage, err = replacePrimaryImage(tx, product.ProductID, product.ProductImage); err != nil {
+			tx.Rollback()
+			return "", err
+		}
+	}
+
+	if err = tx.Commit(); err != nil { return "", err }
+	return oldImage, nil
 }
 
 // Function that deletes a product from the database.
@@ -54,7 +99,8 @@ func (r *ProductRepository) DeleteProduct(productID uuid.UUID) error {
 
 // Function that returns a list of products from the database. It takes a limit and offset as parameters in order to paginate the results.
 func (r *ProductRepository) ListProducts(limit, offset int) ([]models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products ORDER BY date_created DESC LIMIT ? OFFSET ?`
+	query := `SELECT product_id, product_name, price, tax_class, stock, weight, length, width, height, description, product_image, date_created,
+		date_modified FROM products ORDER BY date_created DESC LIMIT ? OFFSET ?`
 	rows, err := r.DB.Query(query, limit, offset)
 	if err != nil { return nil, err }
 	defer rows.Close()
@@ -62,10 +108,14 @@ func (r *ProductRepository) ListProducts(limit, offset int) ([]models.Product, e
 	var products []models.Product
 	for rows.Next() {
 		var product models.Product
-		err := rows.Scan(&product.ProductID, &product.ProductName, &product.Price, &product.Description, &product.ProductImage, &product.DateCreated, &product.DateModified)
+		err := rows.Scan(&product.ProductID, &product.ProductName, &product.Price, &product.TaxClass, &product.Stock, &product.Weight, &product.Length, &product.Width,
+			&product.Height, &product.Description, &product.ProductImage, &product.DateCreated, &product.DateModified)
 		if err != nil { return nil, err }
 		products = append(products, product)
 	}
+	if err = rows.Err(); err != nil { return nil, err }
+	if err = loadVariants(r.DB, products); err != nil { return nil, err }
+	if err = loadImages(r.DB, products); err != nil { return nil, err }
 	return products, nil
 }
 
@@ -77,22 +127,155 @@ func (r *ProductRepository) GetTotalProductsCount() (int, error) {
 	return count, nil
 }
 
-// Function that returns a list of products from the database based on a where clause.
-func (r *ProductRepository) GetProducts(whereClause string) ([]models.Product, error) {
-	query := `SELECT product_id, product_name, price, description, product_image, date_created, date_modified FROM products`
+// Custom type that contains the conditions to filter products by. Conditions left empty (nil or zero) are not applied
+// and the ones set are combined with AND.
+type ProductFilter struct {
+	NameContains  string      // Products whose name contains the text (case insensitive)
+	MinPrice      *models.Money
+	MaxPrice      *models.Money
+	HasImage      *bool       // Products with (true) or without (false) an image
+	CreatedAfter  time.Time   // Products created at or after the date
+	CreatedBefore time.Time   // Products created before the date
+	IDs           []uuid.UUID // Products with one of the IDs (a non-nil empty slice matches no product)
+	CategoryIDs   []uuid.UUID // Products in at least one of the categories
+}
+
+// Method that returns the WHERE clause (without the WHERE keyword) of the filter and its query parameters. Every value is
+// passed as a parameter, so user input is never part of the SQL text.
+func (f ProductFilter) where() (string, []any) {
+	var conditions []string
+	var args []any
+
+	if f.NameContains != "" {
+		conditions = append(conditions, `product_name LIKE ? ESCAPE '\\'`)
+		args = append(args, "%"+escapeLike(f.NameContains)+"%")
+	}
+	if f.MinPrice != nil {
+		conditions = append(conditions, "price >= ?")
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		conditions = append(conditions, "price <= ?")
+		args = append(args, *f.MaxPrice)
+	}
+	if f.HasImage != nil {
+		if *f.HasImage {
+			conditions = append(conditions, "product_image != ''")
+		} else {
+			conditions = append(conditions, "product_image = ''")
+		}
+	}
+	if !f.CreatedAfter.IsZero() {
+		conditions = append(conditions, "date_created >= ?")
+		args = append(args, f.CreatedAfter)
+	}
+	if !f.CreatedBefore.IsZero() {
+		conditions = append(conditions, "date_created < ?")
+		args = append(args, f.CreatedBefore)
+	}
+	if f.IDs != nil {
+		if len(f.IDs) == 0 {
+			conditions = append(conditions, "1 = 0")
+		} else {
+			conditions = append(conditions, "product_id IN (?"+strings.Repeat(", ?", len(f.IDs)-1)+")")
+			for _, id := range f.IDs {
+				args = append(args, id)
+			}
+		}
+	}
+
+	if len(f.CategoryIDs) > 0 {
+		conditions = append(conditions, "product_id IN (SELECT product_id FROM product_categories WHERE category_id IN (?"+
+			strings.Repeat(", ?", len(f.CategoryIDs)-1)+"))")
+		for _, id := range f.CategoryIDs {
+			args = append(args, id)
+		}
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Escapes the wildcards of a LIKE pattern so they match literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Function that returns a list of products from the database that match the filter.
+func (r *ProductRepository) GetProducts(filter ProductFilter) ([]models.Product, error) {
+	query := `SELECT product_id, product_name, price, tax_class, stock, weight, length, width, height, description, product_image, date_created,
+		date_modified FROM products`
+	whereClause, args := filter.where()
 	if whereClause != "" { query += " WHERE " + whereClause }
 	query += " ORDER BY date_created DESC"
-	rows, err := r.DB.Query(query)
+	rows, err := r.DB.Query(query, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+
+	var products []models.Product
+	for rows.Next() {
+		var p models.Product
+		err := rows.Scan(&p.ProductID, &p.ProductName, &p.Price, &p.TaxClass, &p.Stock, &p.Weight, &p.Length, &p.Width, &p.Height, &p.Description,
+			&p.ProductImage, &p.DateCreated, &p.DateModified)
+		if err != nil { return nil, err }
+		products = append(products, p)
+	}
+	if err = rows.Err(); err != nil { return nil, err }
+	if err = loadVariants(r.DB, products); err != nil { return nil, err }
+	if err = loadImages(r.DB, products); err != nil { return nil, err }
+	return products, nil
+}
+
+// Function that splits a search query into lower case words (letters and digits only), without duplicates.
+func SearchTerms(query string) []string {
+	var terms []string
+	seen := map[string]bool{}
+	for _, term := range strings.FieldsFunc(strings.ToLower(query), func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+		if seen[term] { continue }
+		seen[term] = true
+		terms = append(terms, term)
+	}
+	return terms
+}
+
+// Function that returns up to limit products that match the filter and whose name or description contain words starting
+// with the words of the query (so results show up while the shopper types). The products are ranked by relevance, with
+// matches in the name weighing twice as much as matches in the description. A query without words matches no product.
+func (r *ProductRepository) SearchProducts(query string, filter ProductFilter, limit int) ([]models.Product, error) {
+	terms := SearchTerms(query)
+	if len(terms) == 0 { return nil, nil }
+
+	// Boolean mode query where every word is a prefix (e.g. "red shirt" is "red* shirt*")
+	against := strings.Join(terms, "* ") + "*"
+
+	sqlQuery := `SELECT product_id, product_name, price, tax_class, stock, weight, length, width, height, description, product_image, date_created, date_modified,
+		MATCH(product_name) AGAINST(? IN BOOLEAN MODE) * 2 + MATCH(product_name, description) AGAINST(? IN BOOLEAN MODE) AS relevance
+		FROM products
+		WHERE (MATCH(product_name, description) AGAINST(? IN BOOLEAN MODE) OR product_name LIKE ? ESCAPE '\\')`
+	// The LIKE condition finds the names with words shorter than the minimum length indexed by MySQL
+	args := []any{against, against, against, "%" + escapeLike(strings.TrimSpace(query)) + "%"}
+
+	if whereClause, filterArgs := filter.where(); whereClause != "" {
+		sqlQuery += " AND " + whereClause
+		args = append(args, filterArgs...)
+	}
+	sqlQuery += " ORDER BY relevance DESC, date_created DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := r.DB.Query(sqlQuery, args...)
 	if err != nil { return nil, err }
 	defer rows.Close()
 
 	var products []models.Product
 	for rows.Next() {
 		var p models.Product
-		err := rows.Scan(&p.ProductID, &p.ProductName, &p.Price, &p.Description, &p.ProductImage, &p.DateCreated, &p.DateModified)
+		var relevance float64
+		err := rows.Scan(&p.ProductID, &p.ProductName, &p.Price, &p.TaxClass, &p.Stock, &p.Weight, &p.Length, &p.Width, &p.Height, &p.Description,
+			&p.ProductImage, &p.DateCreated, &p.DateModified, &relevance)
 		if err != nil { return nil, err }
 		products = append(products, p)
 	}
 	if err = rows.Err(); err != nil { return nil, err }
+	if err = loadVariants(r.DB, products); err != nil { return nil, err }
+	if err = loadImages(r.DB, products); err != nil { return nil, err }
 	return products, nil
-}
\ No newline at end of file
+}
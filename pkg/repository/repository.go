@@ -1,17 +1,143 @@
 package repository
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
 
-// Custom type that contains pointers to the ProductRepository and OrderRepository.
+// Custom type that contains the stores of the products, variants, images, categories, orders, carts, customers (and their
+// addresses) and admins.
+// NewRepository returns the MySQL stores (ProductRepository, VariantRepository, ...), the memory package the in-memory ones.
 type Repository struct {
-	Product *ProductRepository
-	Order   *OrderRepository
+	Product  ProductStore
+	Variant  VariantStore
+	Image    ImageStore
+	Category CategoryStore
+	Order    OrderStore
+	Cart     CartStore
+	User     UserStore
+	Address  AddressStore
+	Admin    AdminStore
 }
 
 // Function that returns a new Repository with a pointer to the database connection.
 func NewRepository(db *sql.DB) *Repository {
 	return &Repository{
-		Product: NewProductRepository(db),
-		Order:   NewOrderRepository(db),
+		Product:  NewProductRepository(db),
+		Variant:  NewVariantRepository(db),
+		Image:    NewImageRepository(db),
+		Category: NewCategoryRepository(db),
+		Order:    NewOrderRepository(db),
+		Cart:     NewCartRepository(db),
+		User:     NewUserRepository(db),
+		Address:  NewAddressRepository(db),
+		Admin:    NewAdminRepository(db),
 	}
-}
\ No newline at end of file
+}
+
+/*** Interfaces ***/
+// Every store returns sql.ErrNoRows when the row it looks up does not exist and the errors of this package (e.g.
+// ErrSKUTaken) in the same cases as the MySQL repositories, so the handlers work the same with any implementation.
+
+// Custom type that stores the products (implemented by ProductRepository).
+type ProductStore interface {
+	GetProductByID(productID uuid.UUID) (*models.Product, error)
+	CreateProduct(product *models.Product) error
+	UpdateProduct(product *models.Product) (string, error)
+	DeleteProduct(productID uuid.UUID) error
+	ListProducts(limit, offset int) ([]models.Product, error)
+	GetTotalProductsCount() (int, error)
+	GetProducts(filter ProductFilter) ([]models.Product, error)
+	SearchProducts(query string, filter ProductFilter, limit int) ([]models.Product, error)
+}
+
+// Custom type that stores the options and variants of the products (implemented by VariantRepository).
+type VariantStore interface {
+	SetProductOptions(productID uuid.UUID, names []string) error
+	CreateVariant(variant *models.ProductVariant) error
+	UpdateVariant(variant *models.ProductVariant) error
+	DeleteVariant(productID, variantID uuid.UUID) error
+}
+
+// Custom type that stores the image galleries of the products (implemented by ImageRepository).
+type ImageStore interface {
+	ListImages(productID uuid.UUID) ([]models.ProductImage, error)
+	AddImages(productID uuid.UUID, filenames []string) error
+	SetPrimaryImage(productID, imageID uuid.UUID) error
+	ReorderImages(productID uuid.UUID, imageIDs []uuid.UUID) error
+	DeleteImage(productID, imageID uuid.UUID) (string, error)
+}
+
+// Custom type that stores the categories and the categories of the products (implemented by CategoryRepository).
+type CategoryStore interface {
+	ListCategories() ([]models.Category, error)
+	GetCategoryByID(categoryID uuid.UUID) (*models.Category, error)
+	CreateCategory(category *models.Category) error
+	UpdateCategory(category *models.Category) error
+	DeleteCategory(categoryID uuid.UUID, moveTo uuid.NullUUID) error
+	SetProductCategories(productID uuid.UUID, categoryIDs []uuid.UUID) error
+}
+
+// Custom type that stores the orders, their items and their status history (implemented by OrderRepository).
+type OrderStore interface {
+	PlaceOrderWithItems(order *models.Order, idempotencyKey string) (uuid.UUID, error)
+	GetOrderIDByIdempotencyKey(idempotencyKey string) (uuid.UUID, error)
+	ListOrders(limit, offset int) ([]models.Order, error)
+	GetTotalOrdersCount() (int, error)
+	CreateOrder(order *models.Order) error
+	AddOrderItem(orderItem *models.OrderItem) error
+	GetOrderWithProducts(orderID uuid.UUID) (*models.Order, error)
+	UpdateOrderStatus(orderID uuid.UUID, status, changedBy string) error
+	GetOrderStatusHistory(orderID uuid.UUID) ([]models.OrderStatusChange, error)
+}
+
+// Custom type that stores the carts of the sessions and customers (implemented by CartRepository).
+type CartStore interface {
+	GetCartBySession(sessionID string) (*models.Cart, error)
+	GetCartByUser(userID string) (*models.Cart, error)
+	CreateCart(cart *models.Cart) error
+	AssignCart(cartID uuid.UUID, sessionID, userID string) error
+	AddCartItem(cartID, productID, variantID uuid.UUID, quantity int, price models.Money) error
+	UpdateCartItemQuantity(cartID, productID, variantID uuid.UUID, quantity int) error
+	RemoveCartItem(cartID, productID, variantID uuid.UUID) error
+	DeleteCart(cartID uuid.UUID) error
+	DeleteExpiredCarts(idle time.Duration) (int64, error)
+}
+
+// Custom type that stores the customer accounts (implemented by UserRepository).
+type UserStore interface {
+	CreateUser(user *models.User, password string) error
+	GetUserByID(userID uuid.UUID) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	Authenticate(email, password string) (*models.User, error)
+}
+
+// Custom type that stores the address books of the customers (implemented by AddressRepository).
+type AddressStore interface {
+	ListAddresses(userID uuid.UUID) ([]models.Address, error)
+	GetAddress(userID, addressID uuid.UUID) (*models.Address, error)
+	CreateAddress(address *models.Address) error
+	DeleteAddress(userID, addressID uuid.UUID) error
+}
+
+// Custom type that stores the admins (staff members) (implemented by AdminRepository).
+type AdminStore interface {
+	CreateAdmin(admin *models.AdminUser, password string) error
+	GetAdminByID(adminID uuid.UUID) (*models.AdminUser, error)
+	Authenticate(email, password string) (*models.AdminUser, error)
+	ListAdmins() ([]models.AdminUser, error)
+	GetTotalAdminsCount() (int, error)
+}
+
+// The MySQL repositories implement the stores (checked at compile time).
+var _ ProductStore = (*ProductRepository)(nil)
+var _ VariantStore = (*VariantRepository)(nil)
+var _ ImageStore = (*ImageRepository)(nil)
+var _ CategoryStore = (*CategoryRepository)(nil)
+var _ OrderStore = (*OrderRepository)(nil)
+var _ CartStore = (*CartRepository)(nil)
+var _ UserStore = (*UserRepository)(nil)
+var _ AddressStore = (*AddressRepository)(nil)
+var _ AdminStore = (*AdminRepository)(nil)
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+/*** Errors ***/
+var ErrEmailTaken = errors.New("email is already registered")     // Returned when registering an email that already has an account
+var ErrInvalidCredentials = errors.New("invalid email or password") // Returned when the email does not exist or the password does not match
+
+// Custom type that holds a pointer to the database connection.
+type UserRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new UserRepository (pointer) with the database connection.
+func NewUserRepository(db *sql.DB) *UserRepository {
+	return &UserRepository{DB: db}
+}
+
+// Method that creates a new customer account in the database with the password hashed (bcrypt).
+func (r *UserRepository) CreateUser(user *models.User, password string) error {
+	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
+
+	var count int
+	err := r.DB.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", user.Email).Scan(&count)
+	if err != nil { return err }
+	if count > 0 { return ErrEmailTaken }
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil { return err }
+
+	query := `INSERT INTO users (user_id, email, full_name, password_hash, date_created) VALUES (?, ?, ?, ?, ?)`
+	user.UserID = uuid.New()
+	user.PasswordHash = string(hash)
+	user.DateCreated = time.Now()
+	_, err = r.DB.Exec(query, user.UserID, user.Email, user.FullName, user.PasswordHash, user.DateCreated)
+	return err
+}
+
+// Method that returns a customer by its ID from the database.
+func (r *UserRepository) GetUserByID(userID uuid.UUID) (*models.User, error) {
+	query := `SELECT user_id, email, full_name, password_hash, date_created FROM users WHERE user_id = ?`
+	var user models.User
+	err := r.DB.QueryRow(query, userID).Scan(&user.UserID, &user.Email, &user.FullName, &user.PasswordHash, &user.DateCreated)
+	if err != nil { return nil, err }
+	return &user, nil
+}
+
+// Method that returns a customer by its email from the database.
+func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
+	query := `SELECT user_id, email, full_name, password_hash, date_created FROM users WHERE email = ?`
+	var user models.User
+	err := r.DB.QueryRow(query, strings.ToLower(strings.TrimSpace(email))).Scan(&user.UserID, &user.Email, &user.FullName, &user.PasswordHash, &user.DateCreated)
+	if err != nil { return nil, err }
+	return &user, nil
+}
+
+// Method that returns the customer with the email if the password matches. It returns ErrInvalidCredentials otherwise.
+func (r *UserRepository) Authenticate(email, password string) (*models.User, error) {
+	user, err := r.GetUserByEmail(email)
+	if err == sql.ErrNoRows { return nil, ErrInvalidCredentials }
+	if err != nil { return nil, err }
+
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil { return nil, ErrInvalidCredentials }
+	return user, nil
+}
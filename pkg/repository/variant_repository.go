@@ -0,0 +1,302 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+	"github.com/google/uuid"
+)
+
+/*** Errors ***/
+var ErrSKUTaken = errors.New("the SKU is already used by another variant")       // Returned when saving a variant with the SKU of another one
+var ErrVariantValues = errors.New("the variant needs a value for every option") // Returned when a variant does not have one value per option
+
+// Custom type that holds a pointer to the database connection.
+type VariantRepository struct {
+	DB *sql.DB
+}
+
+// Function that returns a new VariantRepository (pointer) with the database connection.
+func NewVariantRepository(db *sql.DB) *VariantRepository {
+	return &VariantRepository{DB: db}
+}
+
+// Method that replaces the options of a product by the names (in order). Options that keep their name keep the values of
+// the variants, the values of removed options are deleted and variants get an empty value for new options.
+func (r *VariantRepository) SetProductOptions(productID uuid.UUID, names []string) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	rows, err := tx.Query(`SELECT option_id, name FROM product_options WHERE product_id = ?`, productID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	existing := map[string]uuid.UUID{}
+	for rows.Next() {
+		var optionID uuid.UUID
+		var name string
+		if err = rows.Scan(&optionID, &name); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		existing[strings.ToLower(name)] = optionID
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// Remove the options that are not in the new list
+	kept := map[string]bool{}
+	for _, name := range names {
+		kept[strings.ToLower(name)] = true
+	}
+	for name, optionID := range existing {
+		if kept[name] { continue }
+		if _, err = tx.Exec(`DELETE FROM product_options WHERE option_id = ?`, optionID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Update (rename and reorder) the kept options and insert the new ones
+	for position, name := range names {
+		if optionID, ok := existing[strings.ToLower(name)]; ok {
+			_, err = tx.Exec(`UPDATE product_options SET name = ?, position = ? WHERE option_id = ?`, name, position, optionID)
+		} else {
+			_, err = tx.Exec(`INSERT INTO product_options (option_id, product_id, name, position) VALUES (?, ?, ?, ?)`,
+				uuid.New(), productID, name, position)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Method that creates a new variant of a product with its option values. It returns ErrSKUTaken if another variant has
+// the SKU and ErrVariantValues if it does not have one (non-empty) value per option of the product.
+func (r *VariantRepository) CreateVariant(variant *models.ProductVariant) error {
+	variant.VariantID = uuid.New()
+	variant.DateCreated = time.Now()
+	variant.DateModified = time.Now()
+
+	return r.saveVariant(variant, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`INSERT INTO product_variants (variant_id, product_id, sku, price, stock, date_created, date_modified) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			variant.VariantID, variant.ProductID, variant.SKU, variant.PriceOverride, variant.Stock, variant.DateCreated, variant.DateModified)
+		return err
+	})
+}
+
+// Method that updates the SKU, price, stock and option values of a variant. It returns the same errors as CreateVariant.
+func (r *VariantRepository) UpdateVariant(variant *models.ProductVariant) error {
+	variant.DateModified = time.Now()
+
+	return r.saveVariant(variant, func(tx *sql.Tx) error {
+		result, err := tx.Exec(`UPDATE product_variants SET sku = ?, price = ?, stock = ?, date_modified = ? WHERE variant_id = ? AND product_id = ?`,
+			variant.SKU, variant.PriceOverride, variant.Stock, variant.DateModified, variant.VariantID, variant.ProductID)
+		if err != nil { return err }
+		if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+			// No row changed: the variant does not exist or nothing changed
+			var exists int
+			return tx.QueryRow(`SELECT 1 FROM product_variants WHERE variant_id = ? AND product_id = ?`, variant.VariantID, variant.ProductID).Scan(&exists)
+		}
+		return nil
+	})
+}
+
+// Method that deletes a variant and removes it from the carts. Orders keep the ID of the variant, but no longer show it.
+func (r *VariantRepository) DeleteVariant(productID, variantID uuid.UUID) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	if _, err = tx.Exec(`DELETE FROM cart_items WHERE product_id = ? AND variant_id = ?`, productID, variantID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err = tx.Exec(`DELETE FROM product_variants WHERE variant_id = ? AND product_id = ?`, variantID, productID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Saves a variant (inserted or updated by the save function) and replaces its option values in a transaction.
+func (r *VariantRepository) saveVariant(variant *models.ProductVariant, save func(tx *sql.Tx) error) error {
+	tx, err := r.DB.Begin()
+	if err != nil { return err }
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM product_variants WHERE sku = ? AND variant_id != ?`, variant.SKU, variant.VariantID).Scan(&count)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count > 0 {
+		tx.Rollback()
+		return ErrSKUTaken
+	}
+
+	// Options of the product (in order), to pair them with the values
+	rows, err := tx.Query(`SELECT option_id FROM product_options WHERE product_id = ? ORDER BY position`, variant.ProductID)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var optionIDs []uuid.UUID
+	for rows.Next() {
+		var optionID uuid.UUID
+		if err = rows.Scan(&optionID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		optionIDs = append(optionIDs, optionID)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if len(optionIDs) == 0 || len(variant.Values) != len(optionIDs) {
+		tx.Rollback()
+		return ErrVariantValues
+	}
+	for _, value := range variant.Values {
+		if strings.TrimSpace(value) == "" {
+			tx.Rollback()
+			return ErrVariantValues
+		}
+	}
+
+	if err = save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM product_variant_values WHERE variant_id = ?`, variant.VariantID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for i, optionID := range optionIDs {
+		_, err = tx.Exec(`INSERT INTO product_variant_values (variant_id, option_id, value) VALUES (?, ?, ?)`, variant.VariantID, optionID, variant.Values[i])
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Loads the options and variants (with their values in option order) of the products.
+func loadVariants(db *sql.DB, products []models.Product) error {
+	if len(products) == 0 { return nil }
+
+	index := map[uuid.UUID]int{}
+	args := make([]any, len(products))
+	for i, p := range products {
+		index[p.ProductID] = i
+		args[i] = p.ProductID
+		products[i].Options = nil
+		products[i].Variants = nil
+	}
+	in := "(?" + strings.Repeat(", ?", len(products)-1) + ")"
+
+	// Options
+	rows, err := db.Query(`SELECT option_id, product_id, name, position FROM product_options WHERE product_id IN `+in+` ORDER BY position`, args...)
+	if err != nil { return err }
+	optionPositions := map[uuid.UUID]int{} // Index of every option in its product options
+	for rows.Next() {
+		var o models.ProductOption
+		if err = rows.Scan(&o.OptionID, &o.ProductID, &o.Name, &o.Position); err != nil {
+			rows.Close()
+			return err
+		}
+		p := &products[index[o.ProductID]]
+		optionPositions[o.OptionID] = len(p.Options)
+		p.Options = append(p.Options, o)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil { return err }
+
+	// Variants
+	rows, err = db.Query(`SELECT variant_id, product_id, sku, price, stock, date_created, date_modified FROM product_variants
+		WHERE product_id IN `+in+` ORDER BY date_created, sku`, args...)
+	if err != nil { return err }
+	type variantRef struct{ product, variant int }
+	variants := map[uuid.UUID]variantRef{}
+	for rows.Next() {
+		var v models.ProductVariant
+		var price sql.NullInt64
+		if err = rows.Scan(&v.VariantID, &v.ProductID, &v.SKU, &price, &v.Stock, &v.DateCreated, &v.DateModified); err != nil {
+			rows.Close()
+			return err
+		}
+		if price.Valid {
+			override := models.Money(price.Int64)
+			v.PriceOverride = &override
+		}
+		p := &products[index[v.ProductID]]
+		v.Values = make([]string, len(p.Options))
+		variants[v.VariantID] = variantRef{product: index[v.ProductID], variant: len(p.Variants)}
+		p.Variants = append(p.Variants, v)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil { return err }
+	if len(variants) == 0 { return nil }
+
+	// Option values of the variants
+	rows, err = db.Query(`SELECT vv.variant_id, vv.option_id, vv.value FROM product_variant_values vv
+		JOIN product_variants v ON vv.variant_id = v.variant_id WHERE v.product_id IN `+in, args...)
+	if err != nil { return err }
+	defer rows.Close()
+	for rows.Next() {
+		var variantID, optionID uuid.UUID
+		var value string
+		if err = rows.Scan(&variantID, &optionID, &value); err != nil { return err }
+		ref, ok := variants[variantID]
+		position, hasOption := optionPositions[optionID]
+		if !ok || !hasOption { continue }
+		products[ref.product].Variants[ref.variant].Values[position] = value
+	}
+	return rows.Err()
+}
+
+// Sets the variant of the items that reference one, with the price and stock of the variant on their product. Items of
+// a variant that no longer exists keep the price and stock of the product.
+func attachVariants(db *sql.DB, items []models.OrderItem) error {
+	var products []models.Product
+	index := map[uuid.UUID]int{}
+	for _, item := range items {
+		if item.VariantID == uuid.Nil { continue }
+		if _, ok := index[item.ProductID]; ok { continue }
+		index[item.ProductID] = len(products)
+		products = append(products, item.Product)
+	}
+	if err := loadVariants(db, products); err != nil { return err }
+
+	for i := range items {
+		if items[i].VariantID == uuid.Nil { continue }
+		product, variant, ok := products[index[items[i].ProductID]].WithVariant(items[i].VariantID)
+		if !ok { continue }
+		items[i].Product = product
+		items[i].Variant = variant
+	}
+	return nil
+}
+
+// Returns the value stored in the variant_id columns of cart and order items (empty for products without variants).
+func variantValue(variantID uuid.UUID) string {
+	if variantID == uuid.Nil { return "" }
+	return variantID.String()
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Custom type that signs and verifies the values stored in cookies, so the client can read them but not forge them.
+// New cookies are signed with the first secret and cookies signed with any of the secrets are accepted, so a secret can
+// be rotated by adding the new one first and removing the old one once its cookies have expired.
+type Manager struct {
+	Secrets [][]byte
+}
+
+// Function that returns a new Manager that signs cookies with the secrets.
+func NewManager(secrets ...[]byte) *Manager {
+	return &Manager{Secrets: secrets}
+}
+
+// Method that stores a signed value in a cookie that expires after maxAge.
+func (m *Manager) SetValue(w http.ResponseWriter, name, value string, maxAge time.Duration) {
+	expires := time.Now().Add(maxAge)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(value)) + "." + strconv.FormatInt(expires.Unix(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    payload + "." + m.sign(m.Secrets[0], name, payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Method that returns the value stored in a cookie. It returns false if the cookie does not exist, has expired or has been tampered with.
+func (m *Manager) Value(r *http.Request, name string) (string, bool) {
+	cookie, err := r.Cookie(name)
+	if err != nil { return "", false }
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 { return "", false }
+
+	payload := parts[0] + "." + parts[1]
+	valid := false
+	for _, secret := range m.Secrets {
+		if hmac.Equal([]byte(parts[2]), []byte(m.sign(secret, name, payload))) { valid = true }
+	}
+	if !valid { return "", false }
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires { return "", false }
+
+	value, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil { return "", false }
+	return string(value), true
+}
+
+// Method that deletes a cookie.
+func (m *Manager) Clear(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Returns the signature of a cookie payload. The cookie name is signed too, so a value can not be moved to another cookie.
+func (m *Manager) sign(secret []byte, name, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(name + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
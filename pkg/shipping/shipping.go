@@ -0,0 +1,151 @@
+package shipping
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Errors ***/
+var ErrUnknownMethod = errors.New("unknown shipping method")                        // Returned when the code is not the code of a shipping method
+var ErrMethodUnavailable = errors.New("the shipping method can not take the order") // Returned when the parcel is heavier than the method takes
+
+/*** Rates ***/
+const (
+	RateFlat     = "flat"      // The same cost for every order
+	RateWeight   = "weight"    // A base cost plus a cost per started kilogram of the billable weight of the parcel
+	RateFreeOver = "free_over" // A flat cost, free when the items cost at least a threshold
+	RatePickup   = "pickup"    // Free, the customer picks the order up at the store
+)
+
+/*** Constants ***/
+const volumetricDivisor = 5 // Cubic centimetres per gram of volumetric weight (the 5000 cm³ per kg of the couriers)
+
+/*** Structs ***/
+
+// Custom type that represents a shipping method the shopper can choose at checkout and how its cost is calculated. Amounts
+// of money are in cents and weights in grams.
+type Method struct {
+	Code        string       `json:"code"` // Stable identifier, stored with the orders (e.g. "standard")
+	Name        string       `json:"name"`
+	Description string       `json:"description"` // e.g. "3 to 5 business days"
+	Rate        string       `json:"rate"`        // flat, weight, free_over or pickup
+	Cost        models.Money `json:"cost"`        // Cost of flat and free_over rates, base cost of weight rates
+	CostPerKg   models.Money `json:"cost_per_kg"` // Cost of every started kilogram (weight rates)
+	FreeOver    models.Money `json:"free_over"`   // Cost of the items from which shipping is free (free_over rates)
+	MaxWeight   int          `json:"max_weight"`  // Heaviest parcel (billable weight) the method takes, 0 for no limit
+}
+
+// Custom type that describes the items of an order as a single parcel.
+type Parcel struct {
+	Subtotal models.Money // Cost of the items
+	Weight   int          // Weight of the items in grams
+	Volume   int          // Volume of the items in cubic centimetres
+}
+
+// Custom type that represents the cost of shipping an order with a method.
+type Quote struct {
+	Method Method       `json:"method"`
+	Cost   models.Money `json:"cost"`  // In cents
+	Total  models.Money `json:"total"` // Cost of the items plus the shipping, in cents
+}
+
+// Function that returns the shipping methods used when the config file does not list any.
+func DefaultMethods() []Method {
+	return []Method{
+		{Code: "standard", Name: "Standard Shipping", Description: "5 to 7 business days", Rate: RateFreeOver, Cost: 599, FreeOver: 5000},
+		{Code: "express", Name: "Express Shipping", Description: "1 to 2 business days", Rate: RateWeight, Cost: 999, CostPerKg: 250, MaxWeight: 30000},
+		{Code: "pickup", Name: "Local Pickup", Description: "Pick your order up at the store", Rate: RatePickup},
+	}
+}
+
+// Function that checks the settings of the shipping methods and returns their problems.
+func Validate(methods []Method) []string {
+	var problems []string
+	if len(methods) == 0 { problems = append(problems, "there must be at least one shipping method") }
+
+	codes := map[string]bool{}
+	for i, m := range methods {
+		name := fmt.Sprintf("shipping method %d", i+1)
+		if m.Code != "" { name = fmt.Sprintf("shipping method %q", m.Code) }
+
+		if m.Code == "" { problems = append(problems, name+": the code can not be empty") }
+		if codes[m.Code] && m.Code != "" { problems = append(problems, name+": the code is repeated") }
+		codes[m.Code] = true
+		if m.Name == "" { problems = append(problems, name+": the name can not be empty") }
+		switch m.Rate {
+			case RateFlat, RateWeight, RateFreeOver, RatePickup:
+			default:
+				problems = append(problems, fmt.Sprintf("%s: the rate must be flat, weight, free_over or pickup, not %q", name, m.Rate))
+		}
+		if m.Cost < 0 || m.CostPerKg < 0 || m.FreeOver < 0 || m.MaxWeight < 0 { problems = append(problems, name+": the amounts can not be negative") }
+	}
+	return problems
+}
+
+// Function that returns the parcel of the items of a cart or order.
+func ParcelOf(items []models.OrderItem) Parcel {
+	var p Parcel
+	for _, item := range items {
+		p.Subtotal += item.Product.Price.Times(item.Quantity)
+		p.Weight += item.Product.Weight * item.Quantity
+		p.Volume += item.Product.Length * item.Product.Width * item.Product.Height * item.Quantity
+	}
+	return p
+}
+
+// Method that returns the weight the couriers charge for: the weight of the parcel or its volumetric weight, whichever is
+// greater (a big and light parcel costs like a heavy one).
+func (p Parcel) BillableWeight() int {
+	return max(p.Weight, p.Volume/volumetricDivisor)
+}
+
+// Method that returns the cost of shipping a parcel with the method, or false if the method can not take it.
+func (m Method) Quote(p Parcel) (models.Money, bool) {
+	if m.MaxWeight > 0 && p.BillableWeight() > m.MaxWeight { return 0, false }
+
+	switch m.Rate {
+		case RateWeight:
+			kilograms := (p.BillableWeight() + 999) / 1000
+			return m.Cost + m.CostPerKg.Times(kilograms), true
+		case RateFreeOver:
+			if p.Subtotal >= m.FreeOver { return 0, true }
+			return m.Cost, true
+		case RatePickup:
+			return 0, true
+		default:
+			return m.Cost, true
+	}
+}
+
+// Function that returns the quotes of the methods that can take the items (in the order of the methods).
+func Quotes(methods []Method, items []models.OrderItem) []Quote {
+	parcel := ParcelOf(items)
+	var quotes []Quote
+	for _, m := range methods {
+		if cost, ok := m.Quote(parcel); ok { quotes = append(quotes, Quote{Method: m, Cost: cost, Total: parcel.Subtotal + cost}) }
+	}
+	return quotes
+}
+
+// Function that returns the quote of the method with the code for the items. It returns ErrUnknownMethod if there is no
+// method with the code and ErrMethodUnavailable if the method can not take the items.
+func QuoteFor(methods []Method, code string, items []models.OrderItem) (Quote, error) {
+	for _, m := range methods {
+		if m.Code != code { continue }
+		parcel := ParcelOf(items)
+		cost, ok := m.Quote(parcel)
+		if !ok { return Quote{}, ErrMethodUnavailable }
+		return Quote{Method: m, Cost: cost, Total: parcel.Subtotal + cost}, nil
+	}
+	return Quote{}, ErrUnknownMethod
+}
+
+// Function that returns whether there is a method with the code.
+func HasMethod(methods []Method, code string) bool {
+	for _, m := range methods {
+		if m.Code == code { return true }
+	}
+	return false
+}
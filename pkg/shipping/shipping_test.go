@@ -0,0 +1,112 @@
+package shipping
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Global Variables ***/
+var testMethods = map[string]Method{ // Methods of a shop with one method of every rate
+	"flat":      {Code: "flat", Name: "Flat", Rate: RateFlat, Cost: 500},
+	"weight":    {Code: "weight", Name: "By Weight", Rate: RateWeight, Cost: 999, CostPerKg: 250, MaxWeight: 30000},
+	"free_over": {Code: "free_over", Name: "Free Over", Rate: RateFreeOver, Cost: 599, FreeOver: 5000},
+	"pickup":    {Code: "pickup", Name: "Pickup", Rate: RatePickup},
+	"light":     {Code: "light", Name: "Light Parcels", Rate: RateFreeOver, Cost: 299, FreeOver: 1000, MaxWeight: 1000},
+}
+
+/*** Tests ***/
+
+// Tests that the billable weight of a parcel is its weight or its volumetric weight (5000 cm³ per kilogram), whichever is
+// greater.
+func TestBillableWeight(t *testing.T) {
+	tests := []struct {
+		parcel Parcel
+		want   int
+	}{
+		{parcel: Parcel{}, want: 0},
+		{parcel: Parcel{Weight: 1000}, want: 1000},
+		{parcel: Parcel{Volume: 5000}, want: 1000},
+		{parcel: Parcel{Weight: 1000, Volume: 4999}, want: 1000},
+		{parcel: Parcel{Weight: 100, Volume: 5004}, want: 1000}, // Less than a gram is not billed
+		{parcel: Parcel{Weight: 500, Volume: 10000}, want: 2000},
+		{parcel: Parcel{Weight: 3000, Volume: 10000}, want: 3000},
+	}
+	for _, test := range tests {
+		if got := test.parcel.BillableWeight(); got != test.want { t.Errorf("%+v: billable weight %d, want %d", test.parcel, got, test.want) }
+	}
+}
+
+// Tests the cost of every rate: every started kilogram of the billable weight is charged, the free_over rates are free
+// from their threshold on, and the parcels heavier than the maximum weight of a method are not taken.
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		method string
+		parcel Parcel
+		want   models.Money
+		ok     bool // Whether the method takes the parcel
+	}{
+		{method: "flat", parcel: Parcel{Subtotal: 100000, Weight: 100000}, want: 500, ok: true},
+		{method: "pickup", parcel: Parcel{Subtotal: 100, Weight: 100000}, want: 0, ok: true},
+
+		// Started kilograms
+		{method: "weight", parcel: Parcel{}, want: 999, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 1}, want: 1249, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 1000}, want: 1249, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 1001}, want: 1499, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 2500}, want: 1749, ok: true},
+
+		// Volumetric weight
+		{method: "weight", parcel: Parcel{Weight: 500, Volume: 10000}, want: 1499, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 500, Volume: 10005}, want: 1749, ok: true},
+
+		// Maximum weight
+		{method: "weight", parcel: Parcel{Weight: 30000}, want: 8499, ok: true},
+		{method: "weight", parcel: Parcel{Weight: 30001}},
+		{method: "weight", parcel: Parcel{Weight: 1000, Volume: 150005}},
+		{method: "light", parcel: Parcel{Subtotal: 5000, Weight: 1001}},
+		{method: "light", parcel: Parcel{Subtotal: 5000, Weight: 1000}, want: 0, ok: true},
+
+		// Free from the threshold on
+		{method: "free_over", parcel: Parcel{Subtotal: 4999}, want: 599, ok: true},
+		{method: "free_over", parcel: Parcel{Subtotal: 5000}, want: 0, ok: true},
+		{method: "free_over", parcel: Parcel{Subtotal: 5001}, want: 0, ok: true},
+		{method: "free_over", parcel: Parcel{Subtotal: 0}, want: 599, ok: true},
+	}
+	for _, test := range tests {
+		got, ok := testMethods[test.method].Quote(test.parcel)
+		if got != test.want || ok != test.ok { t.Errorf("%s %+v: cost %d (%t), want %d (%t)", test.method, test.parcel, got, ok, test.want, test.ok) }
+	}
+}
+
+// Tests that the settings of the shipping methods are checked: every problem of a method is reported with its code (or
+// its position when it has no code).
+func TestValidate(t *testing.T) {
+	if problems := Validate(DefaultMethods()); len(problems) > 0 { t.Fatalf("the default methods have problems: %v", problems) }
+	for _, m := range testMethods {
+		if problems := Validate([]Method{m}); len(problems) > 0 { t.Fatalf("the test method %q has problems: %v", m.Code, problems) }
+	}
+
+	flat := testMethods["flat"]
+	tests := []struct {
+		name    string
+		methods []Method
+		want    string // The only problem of the methods
+	}{
+		{name: "no methods", methods: nil, want: "there must be at least one shipping method"},
+		{name: "empty code", methods: []Method{flat, {Name: "No Code", Rate: RateFlat}}, want: "shipping method 2: the code can not be empty"},
+		{name: "repeated code", methods: []Method{flat, flat}, want: `shipping method "flat": the code is repeated`},
+		{name: "empty name", methods: []Method{{Code: "flat", Rate: RateFlat}}, want: `shipping method "flat": the name can not be empty`},
+		{name: "unknown rate", methods: []Method{{Code: "flat", Name: "Flat", Rate: "per_item"}}, want: `the rate must be flat, weight, free_over or pickup, not "per_item"`},
+		{name: "empty rate", methods: []Method{{Code: "flat", Name: "Flat"}}, want: `the rate must be flat, weight, free_over or pickup, not ""`},
+		{name: "negative cost", methods: []Method{{Code: "flat", Name: "Flat", Rate: RateFlat, Cost: -1}}, want: "the amounts can not be negative"},
+		{name: "negative cost per kg", methods: []Method{{Code: "w", Name: "W", Rate: RateWeight, CostPerKg: -1}}, want: "the amounts can not be negative"},
+		{name: "negative threshold", methods: []Method{{Code: "f", Name: "F", Rate: RateFreeOver, FreeOver: -1}}, want: "the amounts can not be negative"},
+		{name: "negative maximum weight", methods: []Method{{Code: "p", Name: "P", Rate: RatePickup, MaxWeight: -1}}, want: "the amounts can not be negative"},
+	}
+	for _, test := range tests {
+		problems := Validate(test.methods)
+		if len(problems) != 1 || !strings.Contains(problems[0], test.want) { t.Errorf("%s: problems %q, want one with %q", test.name, problems, test.want) }
+	}
+}
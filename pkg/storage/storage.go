@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Custom type that saves and deletes the uploaded files (by name) and returns the URLs they are served from, so the
+// handlers do not depend on where the files are kept.
+type Storage interface {
+	Save(name string, data []byte) error // Saves a file, replacing a file with the same name
+	Delete(name string) error            // Deletes a file, a file that does not exist is not an error
+	URL(name string) string              // Returns the URL of a file
+}
+
+/*** Local Disk ***/
+
+// Custom type that keeps the files in a directory of the server, which must be served (e.g. by an http.FileServer) from
+// the base URL. Only one instance of the app can use it.
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// Function that returns a new Local storage (pointer) that keeps the files in the directory served from the base URL.
+func NewLocal(dir, baseURL string) *Local {
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/") + "/"}
+}
+
+// Method that saves a file in the directory.
+func (s *Local) Save(name string, data []byte) error {
+	return os.WriteFile(filepath.Join(s.Dir, filepath.Base(name)), data, 0644)
+}
+
+// Method that deletes a file from the directory.
+func (s *Local) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.Dir, filepath.Base(name)))
+	if errors.Is(err, os.ErrNotExist) { return nil }
+	return err
+}
+
+// Method that returns the URL of a file.
+func (s *Local) URL(name string) string {
+	return s.BaseURL + url.PathEscape(name)
+}
+
+/*** S3 Compatible ***/
+
+// Custom type that keeps the files as objects of a bucket of an S3 compatible service (e.g. AWS S3 or MinIO), so several
+// instances of the app can share them.
+type S3 struct {
+	Client  *minio.Client
+	Bucket  string
+	BaseURL string // URL the objects of the bucket are served from (e.g. a CDN)
+}
+
+// Custom type that contains the settings to connect to an S3 compatible service.
+type S3Options struct {
+	Endpoint  string // Host (and port) of the service, e.g. "s3.amazonaws.com" or "localhost:9000"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	PublicURL string // URL the objects are served from, the endpoint and bucket (path style) if empty
+}
+
+// Function that returns a new S3 storage (pointer). It checks the bucket exists, so wrong settings are found at startup.
+func NewS3(opts S3Options) (*S3, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil { return nil, err }
+
+	exists, err := client.BucketExists(context.Background(), opts.Bucket)
+	if err != nil { return nil, fmt.Errorf("storage: bucket %s: %v", opts.Bucket, err) }
+	if !exists { return nil, fmt.Errorf("storage: bucket %s does not exist", opts.Bucket) }
+
+	baseURL := opts.PublicURL
+	if baseURL == "" { baseURL = client.EndpointURL().String() + "/" + opts.Bucket }
+	return &S3{Client: client, Bucket: opts.Bucket, BaseURL: strings.TrimSuffix(baseURL, "/") + "/"}, nil
+}
+
+// Method that uploads a file as an object of the bucket, with the content type of its extension.
+func (s *S3) Save(name string, data []byte) error {
+	_, err := s.Client.PutObject(context.Background(), s.Bucket, name, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: mime.TypeByExtension(filepath.Ext(name))})
+	return err
+}
+
+// Method that deletes an object of the bucket (deleting an object that does not exist succeeds).
+func (s *S3) Delete(name string) error {
+	return s.Client.RemoveObject(context.Background(), s.Bucket, name, minio.RemoveObjectOptions{})
+}
+
+// Method that returns the URL of an object.
+func (s *S3) URL(name string) string {
+	return s.BaseURL + url.PathEscape(name)
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+/*** Local Disk ***/
+
+// Tests that a saved file is written to the directory, replaced by a new save and removed by Delete.
+func TestLocalSaveAndDelete(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocal(dir, "/static/uploads")
+
+	if err := s.Save("photo.jpg", []byte("first")); err != nil { t.Fatalf("Save: %v", err) }
+	if err := s.Save("photo.jpg", []byte("second")); err != nil { t.Fatalf("Save again: %v", err) }
+	data, err := os.ReadFile(filepath.Join(dir, "photo.jpg"))
+	if err != nil { t.Fatalf("reading the saved file: %v", err) }
+	if string(data) != "second" { t.Errorf("saved file = %q, want %q", data, "second") }
+
+	if err = s.Delete("photo.jpg"); err != nil { t.Fatalf("Delete: %v", err) }
+	if _, err = os.Stat(filepath.Join(dir, "photo.jpg")); !os.IsNotExist(err) { t.Errorf("the file still exists after Delete (%v)", err) }
+}
+
+// Tests that deleting a file that does not exist is not an error.
+func TestLocalDeleteMissingFile(t *testing.T) {
+	s := NewLocal(t.TempDir(), "/static/uploads/")
+	if err := s.Delete("missing.jpg"); err != nil { t.Errorf("Delete of a missing file = %v, want nil", err) }
+}
+
+// Tests that the names can not leave the directory (only their base name is used).
+func TestLocalKeepsFilesInTheDirectory(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocal(filepath.Join(dir, "uploads"), "/static/uploads/")
+	if err := os.Mkdir(s.Dir, 0755); err != nil { t.Fatal(err) }
+
+	if err := s.Save("../escape.jpg", []byte("data")); err != nil { t.Fatalf("Save: %v", err) }
+	if _, err := os.Stat(filepath.Join(dir, "escape.jpg")); !os.IsNotExist(err) { t.Errorf("the file was saved outside the directory") }
+	if _, err := os.Stat(filepath.Join(s.Dir, "escape.jpg")); err != nil { t.Errorf("the file was not saved in the directory: %v", err) }
+}
+
+// Tests that URL joins the base URL (with or without a trailing slash) and the escaped name.
+func TestLocalURL(t *testing.T) {
+	for _, baseURL := range []string{"/static/uploads", "/static/uploads/"} {
+		s := NewLocal(t.TempDir(), baseURL)
+		if got, want := s.URL("photo.jpg"), "/static/uploads/photo.jpg"; got != want { t.Errorf("URL with base %q = %q, want %q", baseURL, got, want) }
+		if got, want := s.URL("my photo?#1.jpg"), "/static/uploads/my%20photo%3F%231.jpg"; got != want { t.Errorf("URL with base %q = %q, want %q", baseURL, got, want) }
+	}
+}
+
+/*** S3 Compatible ***/
+
+// Custom type that stands in for an S3 compatible service with a single bucket (path style requests), keeping the
+// objects in memory.
+type s3Stub struct {
+	bucket       string
+	mu           sync.Mutex
+	objects      map[string][]byte
+	contentTypes map[string]string
+}
+
+// Returns a new S3 stub server with an empty bucket, closed when the test ends.
+func newS3Stub(t *testing.T, bucket string) (*s3Stub, *httptest.Server) {
+	stub := &s3Stub{bucket: bucket, objects: map[string][]byte{}, contentTypes: map[string]string{}}
+	server := httptest.NewServer(stub)
+	t.Cleanup(server.Close)
+	return stub, server
+}
+
+// Method that answers the requests the S3 storage sends: bucket exists (HEAD), put object (PUT) and remove object
+// (DELETE, which succeeds for missing objects like S3 does).
+func (s *s3Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.bucket {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		if r.Method != http.MethodHead { io.WriteString(w, `<Error><Code>NoSuchBucket</Code><Message>The specified bucket does not exist</Message></Error>`) }
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+		case r.Method == http.MethodHead && key == "":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodPut && key != "":
+			data, err := readObject(r)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			s.objects[key] = data
+			s.contentTypes[key] = r.Header.Get("Content-Type")
+			w.Header().Set("ETag", `"stub"`)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodDelete && key != "":
+			delete(s.objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// Returns the content of an uploaded object, decoding the signed chunks the client sends over plain HTTP.
+func readObject(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil { return nil, err }
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") { return body, nil }
+
+	var data []byte
+	for len(body) > 0 {
+		header, rest, ok := strings.Cut(string(body), "\r\n")
+		if !ok { return nil, fmt.Errorf("chunk without a header") }
+		size, err := strconv.ParseInt(strings.Split(header, ";")[0], 16, 64)
+		if err != nil || int64(len(rest)) < size+2 { return nil, fmt.Errorf("invalid chunk %q", header) }
+		if size == 0 { break }
+		data = append(data, rest[:size]...)
+		body = []byte(rest[size+2:])
+	}
+	return data, nil
+}
+
+// Returns the S3 storage of the stub server.
+func newStubS3(server *httptest.Server, bucket, publicURL string) (*S3, error) {
+	return NewS3(S3Options{
+		Endpoint:  strings.TrimPrefix(server.URL, "http://"),
+		Region:    "us-east-1",
+		Bucket:    bucket,
+		AccessKey: "access",
+		SecretKey: "secret",
+		PublicURL: publicURL,
+	})
+}
+
+// Tests that NewS3 refuses a bucket that does not exist.
+func TestS3MissingBucket(t *testing.T) {
+	_, server := newS3Stub(t, "products")
+	if _, err := newStubS3(server, "other", ""); err == nil { t.Fatal("NewS3 with a missing bucket succeeded, want an error") }
+}
+
+// Tests that a saved file is uploaded as an object with the content type of its extension and removed by Delete, and that
+// deleting a missing object is not an error.
+func TestS3SaveAndDelete(t *testing.T) {
+	stub, server := newS3Stub(t, "products")
+	s, err := newStubS3(server, "products", "")
+	if err != nil { t.Fatalf("NewS3: %v", err) }
+
+	if err = s.Save("photo.png", []byte("image data")); err != nil { t.Fatalf("Save: %v", err) }
+	stub.mu.Lock()
+	data, contentType := string(stub.objects["photo.png"]), stub.contentTypes["photo.png"]
+	stub.mu.Unlock()
+	if data != "image data" { t.Errorf("object = %q, want %q", data, "image data") }
+	if contentType != "image/png" { t.Errorf("content type = %q, want image/png", contentType) }
+
+	if err = s.Delete("photo.png"); err != nil { t.Fatalf("Delete: %v", err) }
+	stub.mu.Lock()
+	_, exists := stub.objects["photo.png"]
+	stub.mu.Unlock()
+	if exists { t.Error("the object still exists after Delete") }
+	if err = s.Delete("missing.png"); err != nil { t.Errorf("Delete of a missing object = %v, want nil", err) }
+}
+
+// Tests that the URLs of the objects use the endpoint and bucket (path style) or the public URL, with escaped names.
+func TestS3URL(t *testing.T) {
+	_, server := newS3Stub(t, "products")
+
+	s, err := newStubS3(server, "products", "")
+	if err != nil { t.Fatalf("NewS3: %v", err) }
+	if got, want := s.URL("my photo.jpg"), server.URL+"/products/my%20photo.jpg"; got != want { t.Errorf("URL = %q, want %q", got, want) }
+
+	s, err = newStubS3(server, "products", "https://cdn.example.com/images/")
+	if err != nil { t.Fatalf("NewS3: %v", err) }
+	if got, want := s.URL("photo.jpg"), "https://cdn.example.com/images/photo.jpg"; got != want { t.Errorf("URL = %q, want %q", got, want) }
+}
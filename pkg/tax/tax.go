@@ -0,0 +1,131 @@
+package tax
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Pricing Modes ***/
+const (
+	ModeExclusive = "exclusive" // The prices do not include the tax, it is added to the total (e.g. US sales tax)
+	ModeInclusive = "inclusive" // The prices include the tax, the total shows how much of it is tax (e.g. VAT)
+)
+
+/*** Tax Classes ***/
+const (
+	ClassStandard = "standard" // Products taxed at the standard rate of the region (the class of products without one)
+	ClassReduced  = "reduced"  // Products taxed at a reduced rate (e.g. books or food)
+	ClassExempt   = "exempt"   // Products that are never taxed
+)
+
+/*** Constants ***/
+const maxRate = 10000 // 100%, in hundredths of a percent
+
+/*** Structs ***/
+
+// Custom type that represents the tax rate of a tax class in a country, or in a region (state, province or county) of
+// it, which replaces the rate of the whole country there.
+type Rule struct {
+	Country string         `json:"country"` // ISO code of the country (e.g. "US")
+	Region  string         `json:"region"`  // Code of the region (e.g. "TX", see models.Country.Regions), empty for the whole country
+	Class   string         `json:"class"`   // Tax class of the products it applies to (standard or reduced)
+	Name    string         `json:"name"`    // Shown in the tax breakdown and stored with the orders (e.g. "Texas Sales Tax")
+	Rate    models.Percent `json:"rate"`    // In hundredths of a percent (825 is 8.25%)
+}
+
+// Function that returns the tax classes of the products (in the order they are shown in the product forms).
+func Classes() []string {
+	return []string{ClassStandard, ClassReduced, ClassExempt}
+}
+
+// Function that returns whether the class is one of the tax classes.
+func IsClass(class string) bool {
+	for _, c := range Classes() {
+		if c == class { return true }
+	}
+	return false
+}
+
+// Function that checks the pricing mode and the tax rules and returns their problems.
+func Validate(mode string, rules []Rule) []string {
+	var problems []string
+	if mode != ModeExclusive && mode != ModeInclusive {
+		problems = append(problems, fmt.Sprintf("tax mode: must be exclusive or inclusive, not %q", mode))
+	}
+
+	seen := map[string]bool{}
+	for i, rule := range rules {
+		name := fmt.Sprintf("tax rule %d", i+1)
+		if rule.Name != "" { name = fmt.Sprintf("tax rule %q", rule.Name) }
+
+		country, ok := models.CountryByCode(rule.Country)
+		if !ok { problems = append(problems, name+": the country must be one the shop delivers to") }
+		if ok && rule.Region != "" {
+			region, found := country.FindRegion(rule.Region)
+			switch {
+				case country.RegionLabel == "":
+					problems = append(problems, fmt.Sprintf("%s: the addresses of %s have no region", name, country.Name))
+				case len(country.Regions) > 0 && (!found || region.Code != rule.Region):
+					problems = append(problems, fmt.Sprintf("%s: the region must be the code of a %s of %s (e.g. %q), not %q", name,
+						strings.ToLower(country.RegionLabel), country.Name, country.Regions[0].Code, rule.Region))
+			}
+		}
+		if rule.Class != ClassStandard && rule.Class != ClassReduced {
+			problems = append(problems, fmt.Sprintf("%s: the class must be standard or reduced, not %q", name, rule.Class))
+		}
+		if rule.Name == "" { problems = append(problems, name+": the name can not be empty") }
+		if rule.Rate < 0 || rule.Rate > maxRate { problems = append(problems, name+": the rate must be between 0 and 10000 (100%)") }
+
+		key := strings.ToUpper(rule.Country + "/" + rule.Region + "/" + rule.Class)
+		if seen[key] { problems = append(problems, name+": there is already a rule for the class in the region") }
+		seen[key] = true
+	}
+	return problems
+}
+
+// Function that returns the rule of a tax class for an address: the rule of its region if there is one, otherwise the
+// rule of its country. The region of the address is matched by its code, so it can be written with its name (e.g.
+// "Texas" for "TX"). It returns false if the products of the class are not taxed there.
+func RuleFor(rules []Rule, address models.Address, class string) (Rule, bool) {
+	if class == "" { class = ClassStandard }
+	if class == ClassExempt { return Rule{}, false }
+
+	region := address.Region
+	if country, ok := models.CountryByCode(address.Country); ok {
+		if found, ok := country.FindRegion(region); ok { region = found.Code }
+	}
+
+	var countryRule *Rule
+	for i, rule := range rules {
+		if rule.Class != class || !strings.EqualFold(rule.Country, address.Country) { continue }
+		if rule.Region == "" {
+			countryRule = &rules[i]
+		} else if strings.EqualFold(strings.TrimSpace(rule.Region), strings.TrimSpace(region)) {
+			return rule, true
+		}
+	}
+	if countryRule == nil { return Rule{}, false }
+	return *countryRule, true
+}
+
+// Function that returns the tax of a line that costs an amount at a rate, rounded to the nearest cent (halves up). With
+// inclusive prices it is the part of the cost that is tax, otherwise the tax added to the cost.
+func LineTax(cost models.Money, rate models.Percent, inclusive bool) models.Money {
+	divisor := models.Money(maxRate)
+	if inclusive { divisor += models.Money(rate) }
+	return (2*cost*models.Money(rate) + divisor) / (2 * divisor)
+}
+
+// Function that calculates the tax of every item of an order (or cart) shipped to an address, with the rule of the tax
+// class of its product, and stores it in the item with the name and rate of the rule (which are empty for untaxed items).
+func Apply(rules []Rule, inclusive bool, address models.Address, items []models.OrderItem) {
+	for i := range items {
+		items[i].TaxName, items[i].TaxRate, items[i].Tax = "", 0, 0
+		rule, ok := RuleFor(rules, address, items[i].Product.TaxClass)
+		if !ok { continue }
+		cost := items[i].Product.Price.Times(items[i].Quantity)
+		items[i].TaxName, items[i].TaxRate, items[i].Tax = rule.Name, rule.Rate, LineTax(cost, rule.Rate, inclusive)
+	}
+}
@@ -0,0 +1,75 @@
+package tax
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thegera4/go-htmx-ecommerce/pkg/models"
+)
+
+/*** Global Variables ***/
+var testRules = []Rule{ // Rules of a shop that taxes Texas, Ontario and the rest of Mexico
+	{Country: "US", Region: "TX", Class: ClassStandard, Name: "Texas Sales Tax", Rate: 825},
+	{Country: "CA", Region: "ON", Class: ClassStandard, Name: "HST", Rate: 1300},
+	{Country: "MX", Class: ClassStandard, Name: "IVA", Rate: 1600},
+	{Country: "MX", Region: "ROO", Class: ClassStandard, Name: "IVA (Border)", Rate: 800},
+}
+
+/*** Tests ***/
+
+// Tests that the rule of a region is found whether the address has its code or its name, once it is normalized or not.
+func TestRuleForRegion(t *testing.T) {
+	tests := []struct {
+		country string
+		region  string
+		want    string // Name of the rule, empty if the address is not taxed
+	}{
+		{country: "US", region: "TX", want: "Texas Sales Tax"},
+		{country: "US", region: "tx", want: "Texas Sales Tax"},
+		{country: "US", region: "Texas", want: "Texas Sales Tax"},
+		{country: "us", region: " TEXAS ", want: "Texas Sales Tax"},
+		{country: "US", region: "US-TX", want: "Texas Sales Tax"},
+		{country: "US", region: "California"},
+		{country: "CA", region: "Ontario", want: "HST"},
+		{country: "MX", region: "Quintana Roo", want: "IVA (Border)"},
+		{country: "MX", region: "Querétaro", want: "IVA"},
+		{country: "MX", region: "CDMX", want: "IVA"},
+	}
+	for _, test := range tests {
+		address := models.Address{Country: test.country, Region: test.region}
+		for _, normalize := range []bool{false, true} {
+			if normalize { address.Normalize() }
+			rule, ok := RuleFor(testRules, address, ClassStandard)
+			if ok != (test.want != "") || rule.Name != test.want {
+				t.Errorf("%s %q (normalized: %t): rule %q (%t), want %q", test.country, test.region, normalize, rule.Name, ok, test.want)
+			}
+		}
+	}
+}
+
+// Tests that the tax rules must name the regions by their code, in the countries with a list of regions.
+func TestValidateRegion(t *testing.T) {
+	if problems := Validate(ModeExclusive, testRules); len(problems) > 0 { t.Fatalf("the test rules have problems: %v", problems) }
+
+	tests := []struct {
+		rule Rule
+		want string // Part of the problem of the rule
+	}{
+		{rule: Rule{Country: "US", Region: "Texas"}, want: `the region must be the code of a state of United States (e.g. "AL"), not "Texas"`},
+		{rule: Rule{Country: "US", Region: "tx"}, want: "the region must be the code of a state"},
+		{rule: Rule{Country: "US", Region: "ZZ"}, want: "the region must be the code of a state"},
+		{rule: Rule{Country: "CA", Region: "US-ON"}, want: "the region must be the code of a province of Canada"},
+		{rule: Rule{Country: "DE", Region: "BY"}, want: "the addresses of Germany have no region"},
+	}
+	for _, test := range tests {
+		test.rule.Class, test.rule.Name, test.rule.Rate = ClassStandard, "Sales Tax", 500
+		problems := Validate(ModeExclusive, []Rule{test.rule})
+		if len(problems) != 1 || !strings.Contains(problems[0], test.want) {
+			t.Errorf("%s %q: problems %q, want one with %q", test.rule.Country, test.rule.Region, problems, test.want)
+		}
+	}
+
+	// The counties of the countries without a list of regions are written freely
+	rule := Rule{Country: "GB", Region: "Kent", Class: ClassReduced, Name: "VAT", Rate: 500}
+	if problems := Validate(ModeExclusive, []Rule{rule}); len(problems) > 0 { t.Errorf("a county of the United Kingdom: problems %q, want none", problems) }
+}